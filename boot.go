@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BootInfo is what boot analysis found out about a media.
+type BootInfo struct {
+	ISO9660         bool     // an ISO 9660 file system starts at the beginning of the media
+	ISOHybrid       bool     // ... and it also carries an MBR or GPT, as isohybrid writes
+	ElTorito        []string // platforms of the El Torito boot catalog, e.g. "x86", "EFI"
+	EFILoaders      []string // removable media loaders, e.g. "EFI/BOOT/BOOTX64.EFI"
+	MBRBootCode     bool     // the MBR has boot code in front of the partition table
+	ActivePartition int      // partition marked active (MBR) or legacy BIOS bootable (GPT)
+	BIOSBootPart    bool     // a GPT BIOS boot partition for GRUB's core image
+	OS              *OSInfo  // may be nil
+}
+
+// OSInfo identifies the operating system an installer media carries.
+type OSInfo struct {
+	Name    string // e.g. "Oracle Linux"
+	Version string // e.g. "9.2"
+	Arch    string // e.g. "x86_64"
+	Source  string // file it was read from, e.g. ".treeinfo"
+}
+
+// Bootable tells whether a firmware would boot the media: UEFI through a
+// removable media loader or an El Torito EFI entry, BIOS through boot code
+// and an active partition, a BIOS boot partition or an isohybrid MBR.
+func (b BootInfo) Bootable() bool {
+	return len(b.EFILoaders) > 0 || len(b.ElTorito) > 0 ||
+		(b.MBRBootCode && (b.ActivePartition != 0 || b.BIOSBootPart || b.ISOHybrid))
+}
+
+func (b BootInfo) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sBootable: %t\n", prefix, b.Bootable())
+	if b.ISO9660 {
+		fmt.Fprintf(&buf, "%s  ISO 9660: hybrid %t\n", prefix, b.ISOHybrid)
+	}
+	if len(b.ElTorito) > 0 {
+		fmt.Fprintf(&buf, "%s  El Torito: %s\n", prefix, strings.Join(b.ElTorito, ", "))
+	}
+	for _, l := range b.EFILoaders {
+		fmt.Fprintf(&buf, "%s  EFI loader: %s\n", prefix, l)
+	}
+	if b.MBRBootCode {
+		fmt.Fprintf(&buf, "%s  MBR boot code: yes\n", prefix)
+	}
+	if b.ActivePartition != 0 {
+		fmt.Fprintf(&buf, "%s  Active partition: #%d\n", prefix, b.ActivePartition)
+	}
+	if b.BIOSBootPart {
+		fmt.Fprintf(&buf, "%s  BIOS boot partition: yes\n", prefix)
+	}
+	if b.OS != nil {
+		fmt.Fprintf(&buf, "%s  OS: %s\n", prefix, b.OS)
+	}
+	return buf.String()
+}
+
+func (b BootInfo) String() string {
+	return b.ToString("")
+}
+
+func (o OSInfo) String() string {
+	s := strings.TrimSpace(o.Name + " " + o.Version)
+	if o.Arch != "" {
+		s += " (" + o.Arch + ")"
+	}
+	if o.Source != "" {
+		s += " from " + o.Source
+	}
+	return s
+}
+
+// bootFS is the little of a file system that boot analysis needs: files
+// looked up by slash-separated path.
+type bootFS interface {
+	stat(name string) (int64, error)
+	readFile(name string, limit int64) ([]byte, error)
+}
+
+// dirFS is a mounted volume.
+type dirFS string
+
+func (d dirFS) stat(name string) (int64, error) {
+	fi, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (d dirFS) readFile(name string, limit int64) ([]byte, error) {
+	f, err := os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
+
+// efiLoaders are the removable media paths UEFI firmware boots from.
+var efiLoaders = []string{
+	"EFI/BOOT/BOOTX64.EFI",
+	"EFI/BOOT/BOOTIA32.EFI",
+	"EFI/BOOT/BOOTAA64.EFI",
+	"EFI/BOOT/BOOTARM.EFI",
+	"EFI/BOOT/BOOTRISCV64.EFI",
+}
+
+// AnalyzeBoot decides whether a media is bootable and which OS it installs.
+// It reads the disk or image r of the given size if r is not nil, and the
+// mounted volumes of mi if mi is not nil; at least one must be given.
+func AnalyzeBoot(r io.ReaderAt, size int64, mi *MediaInfo) (*BootInfo, error) {
+	b := &BootInfo{}
+	fss := make([]bootFS, 0)
+	if r != nil {
+		imgFSs, err := b.analyzeImage(r, size)
+		if err != nil {
+			return nil, err
+		}
+		fss = append(fss, imgFSs...)
+	}
+	if mi != nil {
+		for _, vi := range mi.Volumes {
+			if vi.Mounted && vi.MountPoint != "" {
+				fss = append(fss, dirFS(vi.MountPoint))
+			}
+		}
+	}
+	for _, fsys := range fss {
+		for _, l := range efiLoaders {
+			if _, err := fsys.stat(l); err == nil && !containsString(b.EFILoaders, l) {
+				b.EFILoaders = append(b.EFILoaders, l)
+			}
+		}
+		if b.OS == nil {
+			b.OS = detectOS(fsys)
+		}
+	}
+	if mi != nil {
+		mi.Boot = b
+	}
+	return b, nil
+}
+
+// BootEnricher analyzes whether media are bootable and which OS they
+// install, from their block devices and mounted volumes. Without the
+// privileges to open a block device it looks at the mounted volumes only,
+// and at nothing if there are none, leaving Boot nil.
+type BootEnricher struct {
+	// DevDir is where the device nodes are, "/dev" by default.
+	DevDir string
+}
+
+// Enrich sets the Boot field of the media of uis.
+func (e BootEnricher) Enrich(ctx context.Context, uis []*USBInfo) error {
+	dir := e.DevDir
+	if dir == "" {
+		dir = "/dev"
+	}
+	var errs []string
+	for _, ui := range uis {
+		for _, mi := range ui.Media {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if mi.DevName == "" {
+				continue
+			}
+			f, size, err := OpenImage(filepath.Join(dir, mi.DevName))
+			switch {
+			case errors.Is(err, fs.ErrPermission):
+				debugf("analyzing the mounted volumes of %s only: %v\n", mi.DevName, err)
+				err = nil
+				if hasMounted(mi) {
+					_, err = AnalyzeBoot(nil, 0, mi)
+				}
+			case err == nil:
+				_, err = AnalyzeBoot(f, size, mi)
+				f.Close()
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", mi.DevName, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to analyze boot media: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func hasMounted(mi *MediaInfo) bool {
+	for _, vi := range mi.Volumes {
+		if vi.Mounted && vi.MountPoint != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// analyzeImage looks at the boot sector, the partition table and the ISO
+// 9660 descriptors of an image, and returns the file systems to look into.
+func (b *BootInfo) analyzeImage(r io.ReaderAt, size int64) ([]bootFS, error) {
+	mbr, err := readAt(r, 0, 512)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boot sector: %w", err)
+	}
+	fss := make([]bootFS, 0)
+	if iso, err := openISO9660(r); err == nil {
+		b.ISO9660 = true
+		if b.ElTorito, err = iso.bootPlatforms(); err != nil {
+			return nil, fmt.Errorf("failed to read El Torito boot catalog: %w", err)
+		}
+		fss = append(fss, iso)
+	}
+	pt, err := ReadPartitionTable(r, size)
+	if err != nil || len(pt.Partitions) == 0 {
+		// a superfloppy: a file system without a partition table, whose
+		// boot sector may well look like an empty MBR
+		if f, err := openFAT(r); err == nil {
+			fss = append(fss, f)
+		}
+		return fss, nil
+	}
+	b.ISOHybrid = b.ISO9660
+	b.MBRBootCode = len(mbr) == 512 && bytes.Count(mbr[:440], []byte{0}) < 440
+	for _, p := range pt.Partitions {
+		if b.ActivePartition == 0 && p.Bootable() {
+			b.ActivePartition = p.Number
+		}
+		if p.TypeName == "BIOS Boot" {
+			b.BIOSBootPart = true
+		}
+		if p.TypeName == "Extended" || p.Offset+p.Size > size {
+			continue
+		}
+		// the ESP of an isohybrid image is a FAT image embedded in the ISO
+		if f, err := openFAT(io.NewSectionReader(r, p.Offset, p.Size)); err == nil {
+			fss = append(fss, f)
+		}
+	}
+	return fss, nil
+}
+
+// detectOS identifies the OS from the files installer media carry.
+func detectOS(fsys bootFS) *OSInfo {
+	if b, err := fsys.readFile(".treeinfo", 64*1024); err == nil {
+		if o := parseTreeInfo(b); o != nil {
+			return o
+		}
+	}
+	if b, err := fsys.readFile(".disk/info", 4096); err == nil {
+		if o := parseDiskInfo(b); o != nil {
+			return o
+		}
+	}
+	const sysVersion = "System/Library/CoreServices/SystemVersion.plist"
+	if b, err := fsys.readFile(sysVersion, 64*1024); err == nil {
+		if v, err := DecodePlist(bytes.NewReader(b)); err == nil {
+			if m, ok := v.(map[string]any); ok {
+				name, _ := m["ProductName"].(string)
+				version, _ := m["ProductVersion"].(string)
+				if name != "" {
+					return &OSInfo{Name: name, Version: version, Source: sysVersion}
+				}
+			}
+		}
+	}
+	for _, wim := range []string{"sources/install.wim", "sources/install.esd"} {
+		if _, err := fsys.stat(wim); err == nil {
+			return &OSInfo{Name: "Windows", Source: wim}
+		}
+	}
+	return nil
+}
+
+// parseTreeInfo reads the .treeinfo of Red Hat style installer trees, in both
+// the productmd ([release], [tree]) and the older ([general]) format.
+func parseTreeInfo(b []byte) *OSInfo {
+	sections := make(map[string]map[string]string)
+	var cur map[string]string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			cur = make(map[string]string)
+			sections[strings.ToLower(line[1:len(line)-1])] = cur
+		case cur != nil:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				cur[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+	o := &OSInfo{Source: ".treeinfo"}
+	if rel := sections["release"]; rel != nil {
+		o.Name, o.Version = rel["name"], rel["version"]
+		o.Arch = sections["tree"]["arch"]
+	}
+	if gen := sections["general"]; gen != nil {
+		if o.Name == "" {
+			o.Name, o.Version = gen["family"], gen["version"]
+		}
+		if o.Arch == "" {
+			o.Arch = gen["arch"]
+		}
+	}
+	if o.Name == "" {
+		return nil
+	}
+	return o
+}
+
+// debianArchs are the architecture names found in .disk/info.
+var debianArchs = map[string]bool{
+	"amd64": true, "i386": true, "arm64": true, "armhf": true, "armel": true,
+	"ppc64el": true, "s390x": true, "riscv64": true, "mips64el": true,
+}
+
+// parseDiskInfo reads the one line .disk/info of Debian and Ubuntu media,
+// e.g. `Ubuntu 22.04.3 LTS "Jammy Jellyfish" - Release amd64 (20230807.2)`.
+func parseDiskInfo(b []byte) *OSInfo {
+	line, _, _ := strings.Cut(string(b), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	o := &OSInfo{Source: ".disk/info"}
+	name := make([]string, 0)
+	for _, f := range fields {
+		switch {
+		case debianArchs[f]:
+			o.Arch = f
+		case o.Version == "" && f[0] >= '0' && f[0] <= '9':
+			o.Version = f
+		case o.Version == "" && !strings.HasPrefix(f, `"`):
+			name = append(name, f)
+		}
+	}
+	o.Name = strings.Join(name, " ")
+	if o.Name == "" {
+		o.Name = line
+	}
+	return o
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// isoDirRecord writes an ISO 9660 directory record.
+func isoDirRecord(name string, extent, size uint32, dir bool) []byte {
+	n := len(name)
+	b := make([]byte, (33+n+1)&^1)
+	b[0] = byte(len(b))
+	binary.LittleEndian.PutUint32(b[2:], extent)
+	binary.BigEndian.PutUint32(b[6:], extent)
+	binary.LittleEndian.PutUint32(b[10:], size)
+	binary.BigEndian.PutUint32(b[14:], size)
+	if dir {
+		b[25] = 0x02
+	}
+	b[32] = byte(n)
+	copy(b[33:], name)
+	return b
+}
+
+const testTreeInfo = `[general]
+family = Oracle Linux
+version = 9.2
+arch = x86_64
+
+[release]
+name = Oracle Linux
+version = 9.2
+
+[tree]
+arch = x86_64
+`
+
+// makeISOHybrid returns an image like isohybrid and xorriso write: an ISO
+// 9660 file system with an El Torito catalog for BIOS and EFI, and an MBR
+// with boot code, an active partition over the ISO and an EFI system
+// partition holding a FAT image.
+func makeISOHybrid() []byte {
+	const espStart = 64 // in 512-byte sectors
+	esp := makeFAT16("EFIBOOT", 0x0badcafe, map[string]string{"EFI/BOOT/BOOTX64.EFI": "MZ"})
+	img := makeMBR(espStart*512+int64(len(esp)), []testPartition{
+		{typ: "17", first: 0, size: espStart, attrs: 0x80},
+		{typ: "ef", first: espStart, size: uint64(len(esp) / 512)},
+	})
+	copy(img[0:], []byte{0x33, 0xed, 0xfa, 0x8e, 0xd5}) // boot code
+	copy(img[espStart*512:], esp)
+
+	sector := func(n int) []byte { return img[n*2048 : (n+1)*2048] }
+	vd := func(n int, typ byte) []byte {
+		b := sector(n)
+		b[0] = typ
+		copy(b[1:], "CD001")
+		b[6] = 1
+		return b
+	}
+	pvd := vd(16, 0x01)
+	copy(pvd[40:72], "OL-9.2-0-BaseOS-x86_64          ")
+	copy(pvd[156:], isoDirRecord("\x00", 20, 2048, true))
+	br := vd(17, 0x00)
+	copy(br[7:], "EL TORITO SPECIFICATION")
+	binary.LittleEndian.PutUint32(br[71:], 19)
+	vd(18, 0xff)
+
+	cat := sector(19)
+	cat[0], cat[1], cat[30], cat[31] = 0x01, 0x00, 0x55, 0xaa
+	cat[32] = 0x88
+	cat[64], cat[65], cat[66] = 0x91, 0xef, 1
+	cat[96] = 0x88
+
+	dir := func(n int, records ...[]byte) {
+		b := sector(n)
+		off := 0
+		for _, r := range records {
+			off += copy(b[off:], r)
+		}
+	}
+	dir(20, isoDirRecord("\x00", 20, 2048, true), isoDirRecord("\x01", 20, 2048, true),
+		isoDirRecord(".TREEINFO;1", 23, uint32(len(testTreeInfo)), false),
+		isoDirRecord("EFI", 21, 2048, true))
+	dir(21, isoDirRecord("\x00", 21, 2048, true), isoDirRecord("\x01", 20, 2048, true),
+		isoDirRecord("BOOT", 22, 2048, true))
+	dir(22, isoDirRecord("\x00", 22, 2048, true), isoDirRecord("\x01", 21, 2048, true),
+		isoDirRecord("BOOTX64.EFI;1", 24, 2, false))
+	copy(sector(23), testTreeInfo)
+	copy(sector(24), "MZ")
+	return img
+}
+
+func TestAnalyzeBootISOHybrid(t *testing.T) {
+	img := makeISOHybrid()
+	mi := &MediaInfo{DevName: "sdb"}
+	b, err := AnalyzeBoot(bytes.NewReader(img), int64(len(img)), mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BootInfo{
+		ISO9660:         true,
+		ISOHybrid:       true,
+		ElTorito:        []string{"x86", "EFI"},
+		EFILoaders:      []string{"EFI/BOOT/BOOTX64.EFI"},
+		MBRBootCode:     true,
+		ActivePartition: 1,
+		OS:              &OSInfo{Name: "Oracle Linux", Version: "9.2", Arch: "x86_64", Source: ".treeinfo"},
+	}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("got %+v\nwant %+v", b, want)
+	}
+	if mi.Boot != b || !b.Bootable() {
+		t.Error("the media should have the bootable result")
+	}
+}
+
+func TestAnalyzeBootData(t *testing.T) {
+	// a partitioned stick with a FAT file system and no loaders
+	img := testGPTImage()
+	copy(img[6144*512:], makeFAT16("DATA", 1, map[string]string{"DOCS/NOTES.TXT": "x"}))
+	b, err := AnalyzeBoot(bytes.NewReader(img), int64(len(img)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the EFI partition of testGPTImage is flagged legacy BIOS bootable,
+	// but without boot code in the MBR nothing boots
+	if b.Bootable() || b.ISO9660 || len(b.EFILoaders) != 0 || b.OS != nil {
+		t.Errorf("got %+v", b)
+	}
+}
+
+func TestAnalyzeBootMounted(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"EFI/BOOT/BOOTAA64.EFI": "MZ",
+		".disk/info":            `Ubuntu 22.04.3 LTS "Jammy Jellyfish" - Release arm64 (20230807.2)`,
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mi := &MediaInfo{Volumes: []*VolumeInfo{{Mounted: true, MountPoint: dir}}}
+	b, err := AnalyzeBoot(nil, 0, mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOS := OSInfo{Name: "Ubuntu", Version: "22.04.3", Arch: "arm64", Source: ".disk/info"}
+	if !b.Bootable() || b.OS == nil || *b.OS != wantOS {
+		t.Errorf("got %+v with OS %v", b, b.OS)
+	}
+}
+
+func TestBootEnricher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sdb"), makeISOHybrid(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sdb := &MediaInfo{DevName: "sdb"}
+	ui := &USBInfo{Media: []*MediaInfo{sdb}}
+	if err := (BootEnricher{DevDir: dir}).Enrich(context.Background(), []*USBInfo{ui}); err != nil {
+		t.Fatal(err)
+	}
+	if sdb.Boot == nil || !sdb.Boot.Bootable() || sdb.Boot.OS == nil {
+		t.Errorf("got boot info %+v", sdb.Boot)
+	}
+}
+
+func TestParseTreeInfo(t *testing.T) {
+	old := "[general]\nfamily = CentOS\nversion = 7\narch = x86_64\n"
+	for in, want := range map[string]OSInfo{
+		testTreeInfo: {Name: "Oracle Linux", Version: "9.2", Arch: "x86_64", Source: ".treeinfo"},
+		old:          {Name: "CentOS", Version: "7", Arch: "x86_64", Source: ".treeinfo"},
+	} {
+		if got := parseTreeInfo([]byte(in)); got == nil || *got != want {
+			t.Errorf("parseTreeInfo(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if got := parseTreeInfo([]byte("[stage2]\nmainimage = images/install.img\n")); got != nil {
+		t.Errorf("got %v for a .treeinfo without a release", got)
+	}
+}
@@ -0,0 +1,1001 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Exit codes of the command line interface.
+const (
+	ExitOK       = 0 // success; for diff: no differences
+	ExitError    = 1 // discovery or output failed
+	ExitUsage    = 2 // invalid command line
+	ExitNotFound = 3 // show: no stick matches
+	ExitPartial  = 4 // results are incomplete as a source failed
+	ExitDiffer   = 5 // diff: the inputs differ
+)
+
+// logLevel gates diagnostics on stderr: 0 errors only (-q), 1 warnings too
+// (the default), 2 and up progress (-v).
+var (
+	logLevel            = 1
+	logOutput io.Writer = os.Stderr
+)
+
+func debugf(format string, args ...any) {
+	if logLevel >= 2 {
+		fmt.Fprintf(logOutput, format, args...)
+	}
+}
+
+func warnf(format string, args ...any) {
+	if logLevel >= 1 {
+		fmt.Fprintf(logOutput, "warning: "+format, args...)
+	}
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// countFlag is a flag that counts its repetitions, like -v -v.
+type countFlag int
+
+func (c *countFlag) String() string {
+	return strconv.Itoa(int(*c))
+}
+
+func (c *countFlag) Set(s string) error {
+	if s == "true" {
+		*c++
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("not a count: %s", s)
+	}
+	*c = countFlag(n)
+	return nil
+}
+
+func (c *countFlag) IsBoolFlag() bool {
+	return true
+}
+
+// redactFlag is the redaction mode of -redact, which alone means mask.
+type redactFlag RedactMode
+
+func (f *redactFlag) String() string {
+	return string(*f)
+}
+
+func (f *redactFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*f = redactFlag(RedactMask)
+	case "false":
+		*f = ""
+	case string(RedactDrop), string(RedactMask), string(RedactHMAC):
+		*f = redactFlag(s)
+	default:
+		return fmt.Errorf("not a redaction mode: %s", s)
+	}
+	return nil
+}
+
+func (f *redactFlag) IsBoolFlag() bool {
+	return true
+}
+
+// cliOptions are the global flags, accepted before and after the command.
+type cliOptions struct {
+	source  string
+	inputs  stringList
+	format  string
+	verbose countFlag
+	quiet   bool
+	timeout time.Duration
+	// -template and -template-file
+	template     string
+	templateFile string
+	redact       redactFlag
+}
+
+func (o *cliOptions) register(fs *flag.FlagSet) {
+	for _, name := range []string{"s", "source"} {
+		fs.StringVar(&o.source, name, o.source, "provider: auto, "+strings.Join(providerNames(), ", "))
+	}
+	for _, name := range []string{"i", "input"} {
+		fs.Var(&o.inputs, name, "snapshot file, directory, glob or - for stdin (repeatable)")
+	}
+	for _, name := range []string{"o", "format"} {
+		fs.StringVar(&o.format, name, o.format, "output format: text (the default), json, yaml or toml; csv and tsv for list, dot and mermaid for tree, html and markdown for report")
+	}
+	fs.Var(&o.verbose, "v", "verbose progress on stderr (repeatable)")
+	fs.BoolVar(&o.quiet, "q", o.quiet, "no warnings on stderr")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "discovery timeout")
+	fs.StringVar(&o.template, "template", o.template, "format the output with a Go text/template, see -help")
+	fs.StringVar(&o.templateFile, "template-file", o.templateFile, "like -template, read from a file")
+	fs.Var(&o.redact, "redact", "hide serial numbers, UUIDs, volume labels and user names: -redact masks them, -redact=drop|mask|hmac picks how; hmac pseudonyms are keyed by $"+RedactKeyEnv)
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for _, pi := range providers {
+		names = append(names, pi.Name)
+	}
+	return names
+}
+
+// cli is one invocation of the command line interface.
+type cli struct {
+	opts     cliOptions
+	tmpl     *template.Template // parsed by checkFormat
+	redactor *Redactor          // nil unless -redact
+	errs     []error            // what failed in a partial discovery
+	stdout   io.Writer
+	stderr   io.Writer
+	stdin    io.Reader
+}
+
+type cliCommand struct {
+	name    string
+	args    string
+	summary string
+	flags   func(fs *flag.FlagSet) // command specific flags; may be nil
+	run     func(c *cli, ctx context.Context, args []string) int
+}
+
+var cliCommands []*cliCommand
+
+func init() {
+	var interval time.Duration
+	var count, width int
+	var columns, sortKeys, charset, color, title, names, out string
+	var prune bool
+	cliCommands = []*cliCommand{
+		{
+			name: "list", summary: "list the USB sticks, one per line",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&columns, "columns", defaultListColumns,
+					"comma separated columns: "+strings.Join(listColumnNames(), ", "))
+				fs.StringVar(&sortKeys, "sort", "", "comma separated columns to sort by, - prefixed for descending")
+				fs.IntVar(&width, "width", 0, "truncate the table to this many characters; 0 means $COLUMNS if set")
+			},
+			run: func(c *cli, ctx context.Context, args []string) int {
+				return c.list(ctx, args, columns, sortKeys, width)
+			},
+		},
+		{name: "show", args: "<serial|disk|mount point>", summary: "show the details of a USB stick", run: (*cli).show},
+		{
+			name: "tree", summary: "show the USB topology with the sticks in it",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&charset, "charset", "auto", "draw with unicode or ascii; auto is unicode in UTF-8 locales")
+				fs.StringVar(&color, "color", "auto", "highlight storage devices: always, never, or auto on terminals")
+			},
+			run: func(c *cli, ctx context.Context, args []string) int {
+				return c.tree(ctx, args, charset, color)
+			},
+		},
+		{
+			name: "report", summary: "write an inventory report of the sticks and the topology",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&title, "title", "", "title of the report; the default names the sources")
+			},
+			run: func(c *cli, ctx context.Context, args []string) int {
+				return c.report(ctx, args, title)
+			},
+		},
+		{name: "export", summary: "export everything found in a machine format (default json)", run: (*cli).export},
+		{name: "schema", summary: "print the JSON Schema of the export format", run: (*cli).schema},
+		{name: "validate", args: "<file>...", summary: "check exported documents against the JSON Schema", run: (*cli).validate},
+		{name: "diff", args: "<old> [new]", summary: "compare two snapshots, or a snapshot with the system", run: (*cli).diff},
+		{
+			name: "fixture", args: "[snapshot]", summary: "write an anonymized system_profiler fixture",
+			flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&names, "names", FixtureNamesVolumes, "names to replace: keep, volumes or all")
+				fs.BoolVar(&prune, "prune", false, "drop buses and devices with no storage below them")
+				fs.StringVar(&out, "out", "", "file to write instead of stdout, e.g. testdata/name.json")
+			},
+			run: func(c *cli, ctx context.Context, args []string) int {
+				return c.fixture(ctx, args, names, prune, out)
+			},
+		},
+		{
+			name: "watch", summary: "report sticks as they come, go and change",
+			flags: func(fs *flag.FlagSet) {
+				fs.DurationVar(&interval, "interval", 2*time.Second, "polling interval")
+				fs.IntVar(&count, "count", 0, "stop after this many polls; 0 means never")
+			},
+			run: func(c *cli, ctx context.Context, args []string) int {
+				return c.watch(ctx, args, interval, count)
+			},
+		},
+	}
+}
+
+const cliExitCodes = `Exit codes:
+  0  success; diff: no differences
+  1  discovery or output failed
+  2  invalid command line
+  3  show: no stick matches
+  4  results are incomplete as a source failed
+  5  diff: the inputs differ
+`
+
+const cliTemplates = `Templates:
+  -template runs a Go text/template on the sticks found (list, show) or the
+  USB buses (tree), e.g. '{{range .}}{{.Name}} {{hex .VendorID}}{{"\n"}}{{end}}'.
+  Besides the builtins there are humanize, hex, id, join, volumes,
+  volumeNames, mountPoints, firstMounted, size and free.
+`
+
+func (c *cli) usage(fs *flag.FlagSet) {
+	fmt.Fprintf(c.stderr, "usage: %s [flags] <command> [flags] [args]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(c.stderr, "  %-8s %-26s %s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintf(c.stderr, "\nFlags:\n")
+	fs.SetOutput(c.stderr)
+	fs.PrintDefaults()
+	fmt.Fprintf(c.stderr, "\n%s\n%s", cliExitCodes, cliTemplates)
+}
+
+// runCLI runs the command line interface and returns the exit code.
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr, stdin: stdin}
+	fs := flag.NewFlagSet("usbinfo", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			c.usage(fs)
+			return ExitOK
+		}
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if fs.NArg() == 0 {
+		c.usage(fs)
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	if name == "help" {
+		c.usage(fs)
+		return ExitOK
+	}
+	var cmd *cliCommand
+	for _, cc := range cliCommands {
+		if cc.name == name {
+			cmd = cc
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "error: unknown command %q\n", name)
+		c.usage(fs)
+		return ExitUsage
+	}
+
+	sub := flag.NewFlagSet(name, flag.ContinueOnError)
+	sub.SetOutput(stderr)
+	c.opts.register(sub)
+	if cmd.flags != nil {
+		cmd.flags(sub)
+	}
+	sub.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s %s [flags] %s\n\n%s.\n\nFlags:\n", filepath.Base(os.Args[0]), name, cmd.args, cmd.summary)
+		sub.PrintDefaults()
+	}
+	if err := sub.Parse(fs.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	switch {
+	case c.opts.quiet:
+		logLevel = 0
+	default:
+		logLevel = 1 + int(c.opts.verbose)
+	}
+	logOutput = stderr
+	if c.opts.redact != "" {
+		r, err := NewRedactor(RedactMode(c.opts.redact), []byte(os.Getenv(RedactKeyEnv)))
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return ExitUsage
+		}
+		c.redactor = r
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return cmd.run(c, ctx, sub.Args())
+}
+
+// fail reports an error and returns the exit code for it.
+func (c *cli) fail(code int, format string, args ...any) int {
+	fmt.Fprintf(c.stderr, "error: "+format+"\n", args...)
+	return code
+}
+
+// checkFormat validates the output format against what a command supports;
+// the first one is the default.
+func (c *cli) checkFormat(formats ...string) (string, bool) {
+	if c.opts.template != "" || c.opts.templateFile != "" {
+		return c.checkTemplate(formats)
+	}
+	if c.opts.format == "template" {
+		fmt.Fprintf(c.stderr, "error: -o template needs -template or -template-file\n")
+		return "", false
+	}
+	if c.opts.format == "" {
+		return formats[0], true
+	}
+	if containsString(formats, c.opts.format) {
+		return c.opts.format, true
+	}
+	fmt.Fprintf(c.stderr, "error: unsupported output format %q, supported are: %s\n", c.opts.format, strings.Join(formats, ", "))
+	return "", false
+}
+
+// checkTemplate parses -template or -template-file for checkFormat.
+func (c *cli) checkTemplate(formats []string) (string, bool) {
+	var err error
+	switch {
+	case !containsString(formats, "template"):
+		err = fmt.Errorf("this command does not support templates")
+	case c.opts.format != "" && c.opts.format != "template":
+		err = fmt.Errorf("-template and -o %s are exclusive", c.opts.format)
+	case c.opts.template != "" && c.opts.templateFile != "":
+		err = fmt.Errorf("-template and -template-file are exclusive")
+	case c.opts.templateFile != "":
+		var b []byte
+		if b, err = os.ReadFile(c.opts.templateFile); err == nil {
+			c.tmpl, err = parseTemplate(filepath.Base(c.opts.templateFile), string(b))
+		}
+	default:
+		c.tmpl, err = parseTemplate("template", c.opts.template)
+	}
+	if err != nil {
+		fmt.Fprintf(c.stderr, "error: %v\n", err)
+		return "", false
+	}
+	return "template", true
+}
+
+func (c *cli) writeTemplate(data any) int {
+	if err := c.tmpl.Execute(c.stdout, data); err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	return ExitOK
+}
+
+// findProvider resolves -source and -input: inputs imply the snapshot
+// provider.
+func (c *cli) findProvider(name string, inputs []string) (ProviderInfo, ProviderOptions, error) {
+	opts := ProviderOptions{Paths: inputs, Stdin: c.stdin, snapshots: &snapshotCache{}}
+	if len(inputs) > 0 {
+		if name != "" && name != "auto" && name != "snapshot" {
+			return ProviderInfo{}, opts, fmt.Errorf("-input cannot be combined with -source %s", name)
+		}
+		name = "snapshot"
+	}
+	pi, err := FindProvider(name, opts)
+	if err != nil {
+		return ProviderInfo{}, opts, err
+	}
+	debugf("using provider %s\n", pi.Name)
+	return pi, opts, nil
+}
+
+// discover runs the provider selected by -source and -input. A partial
+// result is returned with ExitPartial after a warning; a failure with
+// ExitError.
+func (c *cli) discover(ctx context.Context) ([]*USBInfo, int) {
+	return c.discoverFrom(ctx, c.opts.source, c.opts.inputs)
+}
+
+func (c *cli) discoverFrom(ctx context.Context, source string, inputs []string) ([]*USBInfo, int) {
+	pi, opts, err := c.findProvider(source, inputs)
+	if err != nil {
+		return nil, c.fail(ExitUsage, "%v", err)
+	}
+	return c.discoverWith(ctx, pi, opts)
+}
+
+// discoverWith runs a provider found by findProvider; a topology from the
+// same options reuses the snapshots read here.
+func (c *cli) discoverWith(ctx context.Context, pi ProviderInfo, opts ProviderOptions) ([]*USBInfo, int) {
+	if c.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.timeout)
+		defer cancel()
+	}
+	uis, err := pi.Build(opts).Discover(ctx)
+	var perr *PartialError
+	switch {
+	case errors.As(err, &perr) && uis != nil:
+		for _, e := range perr.Errs {
+			warnf("%v\n", e)
+		}
+		c.errs = perr.Errs
+		return uis, ExitPartial
+	case err != nil:
+		return nil, c.fail(ExitError, "%v", err)
+	}
+	return uis, ExitOK
+}
+
+// topology discovers the USB buses with a provider that can.
+func (c *cli) topology(ctx context.Context, pi ProviderInfo, opts ProviderOptions) ([]*USBBus, error) {
+	if c.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.timeout)
+		defer cancel()
+	}
+	return pi.NewTopology(opts).Topology(ctx)
+}
+
+// writeDocument writes a Document as JSON, YAML or TOML.
+func (c *cli) writeDocument(format string, uis []*USBInfo, buses []*USBBus) int {
+	doc := NewDocument(uis, buses)
+	var err error
+	switch format {
+	case "yaml":
+		err = EncodeYAML(c.stdout, doc)
+	case "toml":
+		err = EncodeTOML(c.stdout, doc)
+	default:
+		err = doc.Encode(c.stdout)
+	}
+	if err != nil {
+		return c.fail(ExitError, "failed to write %s: %v", strings.ToUpper(format), err)
+	}
+	return ExitOK
+}
+
+func (c *cli) writeJSON(v any) int {
+	e := json.NewEncoder(c.stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return c.fail(ExitError, "failed to write JSON: %v", err)
+	}
+	return ExitOK
+}
+
+func (c *cli) list(ctx context.Context, args []string, columns, sortKeys string, width int) int {
+	format, ok := c.checkFormat("text", "json", "yaml", "toml", "csv", "tsv", "template")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "list takes no arguments")
+	}
+	cols, err := parseListColumns(columns)
+	if err != nil {
+		return c.fail(ExitUsage, "%v", err)
+	}
+	var keys []listSortKey
+	if sortKeys != "" {
+		if keys, err = parseListSortKeys(sortKeys); err != nil {
+			return c.fail(ExitUsage, "%v", err)
+		}
+	}
+	if width == 0 {
+		width, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	}
+	uis, code := c.discover(ctx)
+	if uis == nil {
+		return code
+	}
+	sortUSBInfos(uis, keys)
+	c.redactor.Redact(uis, nil)
+	switch format {
+	case "json", "yaml", "toml":
+		if rc := c.writeDocument(format, uis, nil); rc != ExitOK {
+			return rc
+		}
+		return code
+	case "template":
+		if rc := c.writeTemplate(uis); rc != ExitOK {
+			return rc
+		}
+		return code
+	case "csv":
+		err = writeDelimited(c.stdout, cols, uis, ',')
+	case "tsv":
+		err = writeDelimited(c.stdout, cols, uis, '\t')
+	default:
+		err = writeTable(c.stdout, cols, uis, width)
+	}
+	if err != nil {
+		return c.fail(ExitError, "failed to write list: %v", err)
+	}
+	return code
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// humanSize formats a byte count in decimal units like the Finder does.
+func humanSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// matchUSBInfo tells whether a stick is the one a user named by serial
+// number, disk or partition device name (with or without /dev/), or mount
+// point.
+func matchUSBInfo(ui *USBInfo, arg string) bool {
+	if ui.SerialNumber != "" && ui.SerialNumber == arg {
+		return true
+	}
+	dev := strings.TrimPrefix(arg, "/dev/")
+	for _, mi := range ui.Media {
+		if mi.DevName == dev {
+			return true
+		}
+		for _, vi := range mi.Volumes {
+			if vi.DevName == dev || (vi.Mounted && filepath.Clean(arg) == filepath.Clean(vi.MountPoint)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *cli) show(ctx context.Context, args []string) int {
+	format, ok := c.checkFormat("text", "json", "yaml", "toml", "template")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) != 1 {
+		return c.fail(ExitUsage, "show takes one serial number, disk or mount point")
+	}
+	uis, code := c.discover(ctx)
+	if uis == nil {
+		return code
+	}
+	matches := make([]*USBInfo, 0)
+	for _, ui := range uis {
+		if matchUSBInfo(ui, args[0]) {
+			matches = append(matches, ui)
+		}
+	}
+	if len(matches) == 0 {
+		return c.fail(ExitNotFound, "no USB stick matches %q", args[0])
+	}
+	c.redactor.Redact(matches, nil)
+	switch format {
+	case "json", "yaml", "toml":
+		if rc := c.writeDocument(format, matches, nil); rc != ExitOK {
+			return rc
+		}
+		return code
+	case "template":
+		if rc := c.writeTemplate(matches); rc != ExitOK {
+			return rc
+		}
+		return code
+	}
+	for _, ui := range matches {
+		fmt.Fprintf(c.stdout, "%s\n", ui.ToString(""))
+	}
+	return code
+}
+
+func (c *cli) tree(ctx context.Context, args []string, charset, color string) int {
+	format, ok := c.checkFormat("text", "json", "yaml", "toml", "dot", "mermaid", "template")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "tree takes no arguments")
+	}
+	var style treeOptions
+	switch charset {
+	case "auto":
+		style.ASCII = !unicodeLocale()
+	case "unicode", "ascii":
+		style.ASCII = charset == "ascii"
+	default:
+		return c.fail(ExitUsage, "invalid charset %q", charset)
+	}
+	switch color {
+	case "auto":
+		style.Color = isTerminal(c.stdout) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	case "always", "never":
+		style.Color = color == "always"
+	default:
+		return c.fail(ExitUsage, "invalid color %q", color)
+	}
+	pi, opts, err := c.findProvider(c.opts.source, c.opts.inputs)
+	if err != nil {
+		return c.fail(ExitUsage, "%v", err)
+	}
+	if pi.NewTopology == nil {
+		return c.fail(ExitError, "provider %s cannot discover the USB topology", pi.Name)
+	}
+	uis, code := c.discoverWith(ctx, pi, opts)
+	if uis == nil {
+		return code
+	}
+	buses, err := c.topology(ctx, pi, opts)
+	if err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	for _, ui := range AttachStorage(buses, uis) {
+		warnf("USB stick %q (%s) not found in the topology\n", ui.Name, USBKey(ui))
+	}
+	c.redactor.Redact(uis, buses)
+	switch format {
+	case "json", "yaml", "toml":
+		if rc := c.writeDocument(format, uis, buses); rc != ExitOK {
+			return rc
+		}
+		return code
+	case "template":
+		if rc := c.writeTemplate(buses); rc != ExitOK {
+			return rc
+		}
+		return code
+	case "dot":
+		err = writeDOT(c.stdout, buildTopologyGraph(buses))
+	case "mermaid":
+		err = writeMermaid(c.stdout, buildTopologyGraph(buses))
+	default:
+		err = writeTree(c.stdout, buses, style)
+	}
+	if err != nil {
+		return c.fail(ExitError, "failed to write tree: %v", err)
+	}
+	return code
+}
+
+func (c *cli) report(ctx context.Context, args []string, title string) int {
+	format, ok := c.checkFormat("html", "markdown")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "report takes no arguments")
+	}
+	pi, opts, err := c.findProvider(c.opts.source, c.opts.inputs)
+	if err != nil {
+		return c.fail(ExitUsage, "%v", err)
+	}
+	uis, code := c.discoverWith(ctx, pi, opts)
+	if uis == nil {
+		return code
+	}
+	// the report is still worth having without the topology
+	var buses []*USBBus
+	var terr error
+	if pi.NewTopology != nil {
+		if buses, terr = c.topology(ctx, pi, opts); terr != nil {
+			warnf("%v\n", terr)
+			code = ExitPartial
+		}
+	}
+	var unmatched []*USBInfo
+	if buses != nil {
+		unmatched = AttachStorage(buses, uis)
+	}
+	c.redactor.Redact(uis, buses)
+	r := newReport(title, uis, buses)
+	if r.Title == "" {
+		r.Title = "USB inventory of " + strings.Join(r.Sources, ", ")
+	}
+	for _, ui := range unmatched {
+		r.warn(stickLabel(ui), "not found in the USB topology")
+	}
+	for _, e := range c.errs {
+		r.warn("discovery", "%v", e)
+	}
+	if terr != nil {
+		r.warn("topology", "%v", terr)
+	}
+	for i, w := range r.Warnings {
+		r.Warnings[i] = ReportWarning{Subject: c.redactor.Text(w.Subject), Message: c.redactor.Text(w.Message)}
+	}
+	if format == "markdown" {
+		err = writeMarkdownReport(c.stdout, r)
+	} else {
+		err = writeHTMLReport(c.stdout, r)
+	}
+	if err != nil {
+		return c.fail(ExitError, "failed to write report: %v", err)
+	}
+	return code
+}
+
+func (c *cli) export(ctx context.Context, args []string) int {
+	format, ok := c.checkFormat("json", "yaml", "toml")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "export takes no arguments")
+	}
+	uis, code := c.discover(ctx)
+	if uis == nil {
+		return code
+	}
+	c.redactor.Redact(uis, nil)
+	if rc := c.writeDocument(format, uis, nil); rc != ExitOK {
+		return rc
+	}
+	return code
+}
+
+func (c *cli) schema(ctx context.Context, args []string) int {
+	if _, ok := c.checkFormat("json"); !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "schema takes no arguments")
+	}
+	return c.writeJSON(DocumentSchema())
+}
+
+func (c *cli) validate(ctx context.Context, args []string) int {
+	if _, ok := c.checkFormat("text"); !ok {
+		return ExitUsage
+	}
+	if len(args) == 0 {
+		return c.fail(ExitUsage, "validate takes one or more files")
+	}
+	docs, err := SnapshotBackend{Paths: args, Stdin: c.stdin}.documents(ctx)
+	if err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	code := ExitOK
+	for _, d := range docs {
+		b := d.data
+		var err error
+		if format, _ := DetectSnapshotFormat(b); format == FormatYAML {
+			b, err = yamlToJSON(b)
+		}
+		if err == nil {
+			err = ValidateDocument(b)
+		}
+		var verr *ValidationError
+		switch {
+		case errors.As(err, &verr):
+			for _, e := range verr.Errs {
+				fmt.Fprintf(c.stdout, "%s: %s\n", d.label, e)
+			}
+			code = ExitError
+		case err != nil:
+			fmt.Fprintf(c.stdout, "%s: %v\n", d.label, err)
+			code = ExitError
+		default:
+			fmt.Fprintf(c.stdout, "%s: valid\n", d.label)
+		}
+	}
+	return code
+}
+
+// writeChanges writes changes one per line. With -redact, the values the
+// redactor learnt are scrubbed from them.
+func (c *cli) writeChanges(changes []Change, format string, stamp time.Time) error {
+	for _, ch := range changes {
+		if c.redactor != nil {
+			ch.Device, ch.Old, ch.New = c.redactor.Text(ch.Device), c.redactor.Text(ch.Old), c.redactor.Text(ch.New)
+		}
+		if format == "json" {
+			v := struct {
+				Change
+				Time *time.Time `json:"time,omitempty"`
+			}{Change: ch}
+			if !stamp.IsZero() {
+				v.Time = &stamp
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(c.stdout, "%s\n", b); err != nil {
+				return err
+			}
+			continue
+		}
+		prefix := ""
+		if !stamp.IsZero() {
+			prefix = stamp.Format("15:04:05") + " "
+		}
+		if _, err := fmt.Fprintf(c.stdout, "%s%s\n", prefix, ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cli) diff(ctx context.Context, args []string) int {
+	format, ok := c.checkFormat("text", "json")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return c.fail(ExitUsage, "diff takes an old and optionally a new snapshot")
+	}
+	old, code := c.discoverFrom(ctx, "snapshot", args[:1])
+	if old == nil {
+		return code
+	}
+	// without a second snapshot, compare with what -source or -input finds
+	var new []*USBInfo
+	var code2 int
+	if len(args) == 2 {
+		new, code2 = c.discoverFrom(ctx, "snapshot", args[1:])
+	} else {
+		new, code2 = c.discover(ctx)
+	}
+	if new == nil {
+		return code2
+	}
+	changes := DiffUSBInfos(old, new)
+	c.redactor.Learn(old, nil)
+	c.redactor.Learn(new, nil)
+	if err := c.writeChanges(changes, format, time.Time{}); err != nil {
+		return c.fail(ExitError, "failed to write changes: %v", err)
+	}
+	switch {
+	case code != ExitOK:
+		return code
+	case code2 != ExitOK:
+		return code2
+	case len(changes) > 0:
+		return ExitDiffer
+	}
+	return ExitOK
+}
+
+func (c *cli) watch(ctx context.Context, args []string, interval time.Duration, count int) int {
+	format, ok := c.checkFormat("text", "json")
+	if !ok {
+		return ExitUsage
+	}
+	if len(args) > 0 {
+		return c.fail(ExitUsage, "watch takes no arguments")
+	}
+	if interval <= 0 {
+		return c.fail(ExitUsage, "invalid interval %v", interval)
+	}
+	prev := make([]*USBInfo, 0)
+	for n := 1; ; n++ {
+		uis, code := c.discover(ctx)
+		if uis == nil {
+			if ctx.Err() != nil {
+				return ExitOK // interrupted
+			}
+			return code
+		}
+		c.redactor.Learn(uis, nil)
+		if err := c.writeChanges(DiffUSBInfos(prev, uis), format, time.Now()); err != nil {
+			return c.fail(ExitError, "failed to write changes: %v", err)
+		}
+		prev = uis
+		if count > 0 && n >= count {
+			return ExitOK
+		}
+		select {
+		case <-ctx.Done():
+			return ExitOK
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fixture reads a system_profiler snapshot, or runs system_profiler, and
+// writes it anonymized. Serial numbers and UUIDs get HMAC pseudonyms
+// unless -redact says otherwise, keyed by $USBINFO_REDACT_KEY or else a
+// random key.
+func (c *cli) fixture(ctx context.Context, args []string, names string, prune bool, out string) int {
+	if _, ok := c.checkFormat("json"); !ok {
+		return ExitUsage
+	}
+	if len(args) > 1 {
+		return c.fail(ExitUsage, "fixture takes at most one snapshot")
+	}
+	switch names {
+	case FixtureNamesKeep, FixtureNamesVolumes, FixtureNamesAll:
+	default:
+		return c.fail(ExitUsage, "invalid names policy %q, supported are: keep, volumes, all", names)
+	}
+	red := c.redactor
+	if red == nil {
+		key := []byte(os.Getenv(RedactKeyEnv))
+		if len(key) == 0 {
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return c.fail(ExitError, "%v", err)
+			}
+		}
+		red, _ = NewRedactor(RedactHMAC, key)
+	}
+	var data any
+	var err error
+	if len(args) == 1 {
+		docs, err := SnapshotBackend{Paths: args, Stdin: c.stdin}.documents(ctx)
+		if err != nil {
+			return c.fail(ExitError, "%v", err)
+		}
+		if len(docs) != 1 {
+			return c.fail(ExitUsage, "fixture takes one snapshot, %s has %d", args[0], len(docs))
+		}
+		if _, _, ok, _ := parseDocument(docs[0].data); ok {
+			return c.fail(ExitError, "%s: an exported document, not system_profiler output", docs[0].label)
+		}
+		if data, err = decodeSnapshot(docs[0].data); err != nil {
+			return c.fail(ExitError, "%s: %v", docs[0].label, err)
+		}
+		if data == nil {
+			return c.fail(ExitError, "%s: lsblk output, not system_profiler output", docs[0].label)
+		}
+	} else if data, err = (SystemProfilerBackend{Timeout: c.opts.timeout}).run(ctx); err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	if data, err = AnonymizeSystemProfiler(data, FixturePolicy{Redactor: red, Names: names, Prune: prune}); err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+	e.SetIndent("", "\t")
+	if err := e.Encode(data); err != nil {
+		return c.fail(ExitError, "failed to write JSON: %v", err)
+	}
+	// fixtures go to testdata, which the sample provider embeds and the
+	// tests load, so they must parse
+	if _, err := ParseSnapshot(buf.Bytes()); err != nil {
+		return c.fail(ExitError, "the fixture does not parse: %v", err)
+	}
+	if _, err := parseSnapshotTopology(buf.Bytes()); err != nil {
+		return c.fail(ExitError, "the fixture does not parse: %v", err)
+	}
+	if out == "" {
+		if _, err := c.stdout.Write(buf.Bytes()); err != nil {
+			return c.fail(ExitError, "failed to write JSON: %v", err)
+		}
+		return ExitOK
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
+		return c.fail(ExitError, "%v", err)
+	}
+	return ExitOK
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateExports(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			var doc, stderr bytes.Buffer
+			if code := runCLI([]string{"-s", "sample", "-o", format, "export"}, nil, &doc, &stderr); code != ExitOK {
+				t.Fatalf("export exited with %d: %s", code, stderr.String())
+			}
+			var out bytes.Buffer
+			if code := runCLI([]string{"validate", "-"}, &doc, &out, &stderr); code != ExitOK {
+				t.Fatalf("validate exited with %d: %s%s", code, out.String(), stderr.String())
+			}
+			if !strings.HasSuffix(out.String(), ": valid\n") {
+				t.Errorf("got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestExportTOML(t *testing.T) {
+	var out, stderr bytes.Buffer
+	if code := runCLI([]string{"-s", "sample", "-o", "toml", "export"}, nil, &out, &stderr); code != ExitOK {
+		t.Fatalf("export exited with %d: %s", code, stderr.String())
+	}
+	doc := out.String()
+	if !strings.HasPrefix(doc, "schema_version = 1\n\n[[devices]]\n") {
+		t.Errorf("the document starts with %q", doc[:40])
+	}
+	for _, want := range []string{
+		"\nvendor_id = { hex = \"0x1f75\", value = 8053 }\n",
+		"\n[[devices.media]]\n",
+		"\nsize = { bytes = 63909113344, human = \"63.9 GB\" }\n",
+		"\n[[devices.media.volumes]]\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("the document lacks %q", want)
+		}
+	}
+	if strings.Contains(doc, "null") {
+		t.Error("TOML has no null")
+	}
+}
+
+func TestValidateInvalidYAML(t *testing.T) {
+	doc := "schema_version: 1\ndevices:\n  - name: Stick\n    vendor_id:\n      hex: \"0x1f75\"\n      value: \"8053\"\n"
+	var out, stderr bytes.Buffer
+	if code := runCLI([]string{"validate", "-"}, strings.NewReader(doc), &out, &stderr); code != ExitError {
+		t.Fatalf("validate exited with %d: %s%s", code, out.String(), stderr.String())
+	}
+	if !strings.Contains(out.String(), "$.devices[0].vendor_id.value: expected integer") {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestTreeFromStdin(t *testing.T) {
+	// the sticks and the buses come from a single read of stdin
+	snap, err := os.ReadFile("testdata/GPTPartitioned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, stderr bytes.Buffer
+	if code := runCLI([]string{"-i", "-", "tree", "-color", "never"}, bytes.NewReader(snap), &out, &stderr); code != ExitOK {
+		t.Fatalf("tree exited with %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(out.String(), "PenDrive") {
+		t.Errorf("the stick is missing from the tree:\n%s", out.String())
+	}
+}
+
+func TestReportFromStdin(t *testing.T) {
+	// the topology comes from the same read of stdin as the sticks
+	snap, err := os.ReadFile("testdata/GPTPartitioned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out, stderr bytes.Buffer
+	if code := runCLI([]string{"-i", "-", "report"}, bytes.NewReader(snap), &out, &stderr); code != ExitOK {
+		t.Fatalf("report exited with %d: %s", code, stderr.String())
+	}
+	html := out.String()
+	if !strings.Contains(html, "AppleUSBXHCIFL1100") {
+		t.Error("the report lacks the topology")
+	}
+	if strings.Contains(html, "empty snapshot") || strings.Contains(html, "not found in the USB topology") {
+		t.Error("the report warns about the topology")
+	}
+}
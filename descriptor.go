@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// USB descriptor types, USB 3.2 spec table 9-6
+const (
+	descDevice        = 0x01
+	descConfiguration = 0x02
+	descString        = 0x03
+	descInterface     = 0x04
+	descEndpoint      = 0x05
+	descBOS           = 0x0f
+	descDeviceCap     = 0x10
+)
+
+// BOS device capability types, USB 3.2 spec table 9-14
+const (
+	capUSB20Extension = 0x02
+	capSuperSpeed     = 0x03
+	capContainerID    = 0x04
+	capSuperSpeedPlus = 0x0a
+)
+
+// DeviceDescriptor is the standard USB device descriptor.
+type DeviceDescriptor struct {
+	USBVersion        uint16 // bcdUSB
+	Class             uint8
+	SubClass          uint8
+	Protocol          uint8
+	MaxPacketSize0    uint8
+	VendorID          uint16
+	ProductID         uint16
+	DeviceVersion     uint16 // bcdDevice
+	ManufacturerIndex uint8
+	ProductIndex      uint8
+	SerialNumberIndex uint8
+	NumConfigs        uint8
+}
+
+// DeviceCapability is a BOS device capability; the well known ones are
+// decoded into the typed fields, all keep their raw bytes.
+type DeviceCapability struct {
+	Type uint8
+	Data []byte // after bDevCapabilityType
+	// USB 2.0 extension
+	LPM bool
+	// SuperSpeed USB
+	SpeedsSupported uint16 // bit 0 low, 1 full, 2 high, 3 5 Gbit/s
+	// SuperSpeedPlus USB
+	SublinkSpeeds []uint32 // lane speed attributes
+	// container ID
+	ContainerID string
+}
+
+// BOSInfo is a binary device object store with its capabilities.
+type BOSInfo struct {
+	Capabilities []*DeviceCapability
+}
+
+// USBDescriptors is the decoded set of raw descriptors of a device.
+type USBDescriptors struct {
+	Device    DeviceDescriptor
+	Configs   []*ConfigInfo
+	BOS       *BOSInfo
+	Languages []uint16 // from string descriptor 0
+	Strings   map[uint8]string
+}
+
+// bcdString formats a binary coded decimal version such as 0x0210 as "2.10".
+func bcdString(v uint16) string {
+	return fmt.Sprintf("%x.%02x", v>>8, v&0xff)
+}
+
+// MaxSpeed returns the highest speed the device is capable of, in
+// system_profiler naming: from the BOS capabilities if present, else guessed
+// from bcdUSB.
+func (d USBDescriptors) MaxSpeed() string {
+	if d.BOS != nil {
+		best := ""
+		for _, c := range d.BOS.Capabilities {
+			switch c.Type {
+			case capSuperSpeedPlus:
+				return "super_speed_plus"
+			case capSuperSpeed:
+				switch {
+				case c.SpeedsSupported&0x08 != 0:
+					best = "super_speed"
+				case c.SpeedsSupported&0x04 != 0 && best == "":
+					best = "high_speed"
+				}
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	switch {
+	case d.Device.USBVersion >= 0x0310:
+		return "super_speed_plus"
+	case d.Device.USBVersion >= 0x0300:
+		return "super_speed"
+	case d.Device.USBVersion >= 0x0200:
+		return "high_speed"
+	case d.Device.USBVersion != 0:
+		return "full_speed"
+	}
+	return ""
+}
+
+func (d USBDescriptors) ToString(prefix string) string {
+	var buf strings.Builder
+	dd := d.Device
+	fmt.Fprintf(&buf, "%sDescriptors:\n", prefix)
+	fmt.Fprintf(&buf, "%s  USB Version: %s\n", prefix, bcdString(dd.USBVersion))
+	fmt.Fprintf(&buf, "%s  Device Version: %s\n", prefix, bcdString(dd.DeviceVersion))
+	fmt.Fprintf(&buf, "%s  Device Class: %#02x/%#02x/%#02x (%s)\n",
+		prefix, dd.Class, dd.SubClass, dd.Protocol, USBClassName(dd.Class))
+	fmt.Fprintf(&buf, "%s  Max Speed: %s\n", prefix, d.MaxSpeed())
+	for _, c := range d.Configs {
+		fmt.Fprintf(&buf, "%s", c.ToString(prefix+indent))
+	}
+	if d.BOS != nil {
+		for _, c := range d.BOS.Capabilities {
+			fmt.Fprintf(&buf, "%s  Capability %#02x", prefix, c.Type)
+			switch c.Type {
+			case capUSB20Extension:
+				fmt.Fprintf(&buf, " (USB 2.0 Extension): LPM %t", c.LPM)
+			case capSuperSpeed:
+				fmt.Fprintf(&buf, " (SuperSpeed): speeds %#04x", c.SpeedsSupported)
+			case capSuperSpeedPlus:
+				fmt.Fprintf(&buf, " (SuperSpeedPlus): %d sublink speeds", len(c.SublinkSpeeds))
+			case capContainerID:
+				fmt.Fprintf(&buf, " (Container ID): %s", c.ContainerID)
+			}
+			fmt.Fprintf(&buf, "\n")
+		}
+	}
+	return buf.String()
+}
+
+func (d USBDescriptors) String() string {
+	return d.ToString("")
+}
+
+// DecodeDescriptors decodes a stream of raw USB descriptors, such as the
+// content of /sys/bus/usb/devices/*/descriptors (a device descriptor
+// followed by the full configuration descriptors) or captured GET_DESCRIPTOR
+// responses, which may also contain BOS and string descriptors. A string
+// descriptor does not carry its index, so they must follow in index order
+// without gaps, starting with descriptor 0 and its language IDs.
+func DecodeDescriptors(b []byte) (*USBDescriptors, error) {
+	d := &USBDescriptors{Strings: make(map[uint8]string)}
+	var cfg *ConfigInfo
+	var ifc *InterfaceInfo
+	var strIndex uint8 // see above, the n-th string descriptor is index n
+	// names are resolved once all string descriptors are known
+	type strRef struct {
+		name  *string
+		index uint8
+	}
+	var refs []strRef
+	seenDevice := false
+	for off := 0; off < len(b); {
+		if len(b)-off < 2 {
+			return nil, fmt.Errorf("truncated descriptor header at offset %d", off)
+		}
+		l, typ := int(b[off]), b[off+1]
+		if l < 2 || off+l > len(b) {
+			return nil, fmt.Errorf("invalid length %d of descriptor type %#02x at offset %d", l, typ, off)
+		}
+		desc := b[off : off+l]
+		switch typ {
+		case descDevice:
+			if l < 18 {
+				return nil, fmt.Errorf("device descriptor at offset %d too short: %d bytes", off, l)
+			}
+			d.Device = DeviceDescriptor{
+				USBVersion:        binary.LittleEndian.Uint16(desc[2:]),
+				Class:             desc[4],
+				SubClass:          desc[5],
+				Protocol:          desc[6],
+				MaxPacketSize0:    desc[7],
+				VendorID:          binary.LittleEndian.Uint16(desc[8:]),
+				ProductID:         binary.LittleEndian.Uint16(desc[10:]),
+				DeviceVersion:     binary.LittleEndian.Uint16(desc[12:]),
+				ManufacturerIndex: desc[14],
+				ProductIndex:      desc[15],
+				SerialNumberIndex: desc[16],
+				NumConfigs:        desc[17],
+			}
+			seenDevice = true
+		case descConfiguration:
+			if l < 9 {
+				return nil, fmt.Errorf("configuration descriptor at offset %d too short: %d bytes", off, l)
+			}
+			total := int(binary.LittleEndian.Uint16(desc[2:]))
+			if off+total > len(b) {
+				return nil, fmt.Errorf("configuration at offset %d truncated: %d of %d bytes", off, len(b)-off, total)
+			}
+			cfg = &ConfigInfo{
+				Value:      desc[5],
+				Attributes: desc[7],
+				MaxPower:   int(desc[8]) * 2,
+			}
+			if d.Device.USBVersion >= 0x0300 {
+				cfg.MaxPower = int(desc[8]) * 8 // SuperSpeed units are 8 mA
+			}
+			refs = append(refs, strRef{&cfg.Name, desc[6]})
+			d.Configs = append(d.Configs, cfg)
+			ifc = nil
+		case descInterface:
+			if l < 9 {
+				return nil, fmt.Errorf("interface descriptor at offset %d too short: %d bytes", off, l)
+			}
+			if cfg == nil {
+				return nil, fmt.Errorf("interface descriptor at offset %d outside of a configuration", off)
+			}
+			ifc = &InterfaceInfo{
+				Number:           desc[2],
+				AlternateSetting: desc[3],
+				Class:            desc[5],
+				SubClass:         desc[6],
+				Protocol:         desc[7],
+			}
+			refs = append(refs, strRef{&ifc.Name, desc[8]})
+			cfg.Interfaces = append(cfg.Interfaces, ifc)
+		case descEndpoint:
+			if l < 7 {
+				return nil, fmt.Errorf("endpoint descriptor at offset %d too short: %d bytes", off, l)
+			}
+			if ifc == nil {
+				return nil, fmt.Errorf("endpoint descriptor at offset %d outside of an interface", off)
+			}
+			ifc.Endpoints = append(ifc.Endpoints, &EndpointInfo{
+				Address:       desc[2],
+				Attributes:    desc[3],
+				MaxPacketSize: binary.LittleEndian.Uint16(desc[4:]),
+				Interval:      desc[6],
+			})
+		case descBOS:
+			if l < 5 {
+				return nil, fmt.Errorf("BOS descriptor at offset %d too short: %d bytes", off, l)
+			}
+			d.BOS = &BOSInfo{}
+			cfg, ifc = nil, nil
+		case descDeviceCap:
+			if l < 3 {
+				return nil, fmt.Errorf("device capability at offset %d too short: %d bytes", off, l)
+			}
+			if d.BOS == nil {
+				return nil, fmt.Errorf("device capability at offset %d outside of a BOS", off)
+			}
+			c, err := decodeDeviceCapability(desc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode device capability at offset %d: %w", off, err)
+			}
+			d.BOS.Capabilities = append(d.BOS.Capabilities, c)
+		case descString:
+			if l%2 != 0 {
+				return nil, fmt.Errorf("string descriptor at offset %d has odd length %d", off, l)
+			}
+			u := make([]uint16, 0, (l-2)/2)
+			for i := 2; i < l; i += 2 {
+				u = append(u, binary.LittleEndian.Uint16(desc[i:]))
+			}
+			if strIndex == 0 {
+				d.Languages = u
+			} else {
+				d.Strings[strIndex] = string(utf16.Decode(u))
+			}
+			strIndex++
+		default:
+			// class specific, interface association, SuperSpeed endpoint
+			// companion and other descriptors are skipped
+		}
+		off += l
+	}
+	if !seenDevice {
+		return nil, fmt.Errorf("no device descriptor found")
+	}
+	for _, r := range refs {
+		if r.index != 0 {
+			*r.name = d.Strings[r.index]
+		}
+	}
+	return d, nil
+}
+
+func decodeDeviceCapability(desc []byte) (*DeviceCapability, error) {
+	c := &DeviceCapability{Type: desc[2], Data: append([]byte(nil), desc[3:]...)}
+	switch c.Type {
+	case capUSB20Extension:
+		if len(desc) < 7 {
+			return nil, fmt.Errorf("USB 2.0 extension too short: %d bytes", len(desc))
+		}
+		c.LPM = binary.LittleEndian.Uint32(desc[3:])&0x02 != 0
+	case capSuperSpeed:
+		if len(desc) < 10 {
+			return nil, fmt.Errorf("SuperSpeed capability too short: %d bytes", len(desc))
+		}
+		c.SpeedsSupported = binary.LittleEndian.Uint16(desc[4:])
+	case capSuperSpeedPlus:
+		if len(desc) < 12 {
+			return nil, fmt.Errorf("SuperSpeedPlus capability too short: %d bytes", len(desc))
+		}
+		n := int(binary.LittleEndian.Uint32(desc[4:])&0x1f) + 1 // SSAC
+		if len(desc) < 12+4*n {
+			return nil, fmt.Errorf("SuperSpeedPlus capability too short for %d sublink speeds: %d bytes", n, len(desc))
+		}
+		for i := 0; i < n; i++ {
+			c.SublinkSpeeds = append(c.SublinkSpeeds, binary.LittleEndian.Uint32(desc[12+4*i:]))
+		}
+	case capContainerID:
+		if len(desc) < 20 {
+			return nil, fmt.Errorf("container ID too short: %d bytes", len(desc))
+		}
+		c.ContainerID = formatGUID(desc[4:20])
+	}
+	return c, nil
+}
+
+// formatGUID formats a 16 byte mixed-endian GUID as used by UEFI and USB.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%04X-%X",
+		binary.LittleEndian.Uint32(b[0:]), binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]), binary.BigEndian.Uint16(b[8:]), b[10:16])
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDescriptors is the descriptor set of a USB 3.2 Gen 2 stick, laid out
+// as GET_DESCRIPTOR returns it: the device descriptor, the configuration
+// with its SuperSpeed endpoint companions, the BOS and the string
+// descriptors 0 to 3.
+const testDescriptors = "" +
+	// device: bcdUSB 3.20, 0781:5581, bcdDevice 1.00, strings 1 2 3
+	"120120030000000981078155000101020301" +
+	// configuration 1, bus powered, 112 * 8 mA
+	"09022c0001010080" + "70" +
+	"090400000208065000" +
+	"0705810200040006300f000000" +
+	"0705020200040006300f000000" +
+	// BOS with USB 2.0 extension, SuperSpeed, SuperSpeedPlus and container ID
+	"050f3e0004" +
+	"071002" + "1ef40000" +
+	"0a100300" + "0e00010aff07" +
+	"14100a00" + "01000000" + "00110000" + "30400a00" + "b0400a00" +
+	"14100400" + "2a9e3c5b471d0b4f9a613e2d8c7b6a50" +
+	// strings: US English, "SanDisk", "Extreme", "1234"
+	"04030904" +
+	"100353006100" + "6e0044006900" + "73006b00" +
+	"100345007800" + "740072006500" + "6d006500" +
+	"0a0331003200" + "33003400"
+
+func testDescriptorBlob(t *testing.T) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(testDescriptors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeDescriptors(t *testing.T) {
+	d, err := DecodeDescriptors(testDescriptorBlob(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeviceDescriptor{
+		USBVersion: 0x0320, MaxPacketSize0: 9, VendorID: 0x0781, ProductID: 0x5581, DeviceVersion: 0x0100,
+		ManufacturerIndex: 1, ProductIndex: 2, SerialNumberIndex: 3, NumConfigs: 1,
+	}
+	if d.Device != want {
+		t.Errorf("device descriptor is %+v, want %+v", d.Device, want)
+	}
+	if len(d.Configs) != 1 {
+		t.Fatalf("got %d configurations, want 1", len(d.Configs))
+	}
+	c := d.Configs[0]
+	if c.Value != 1 || c.Attributes != 0x80 || c.MaxPower != 896 || len(c.Interfaces) != 1 {
+		t.Fatalf("configuration is %+v", *c)
+	}
+	// the endpoint companions are skipped
+	if ifc := c.Interfaces[0]; ifc.Class != 8 || ifc.SubClass != 6 || ifc.Protocol != 0x50 || len(ifc.Endpoints) != 2 {
+		t.Errorf("interface is %+v", *ifc)
+	}
+
+	if d.BOS == nil || len(d.BOS.Capabilities) != 4 {
+		t.Fatalf("got BOS %+v, want 4 capabilities", d.BOS)
+	}
+	caps := d.BOS.Capabilities
+	if caps[0].Type != capUSB20Extension || !caps[0].LPM {
+		t.Errorf("USB 2.0 extension is %+v", *caps[0])
+	}
+	if caps[1].Type != capSuperSpeed || caps[1].SpeedsSupported != 0x0e {
+		t.Errorf("SuperSpeed capability is %+v", *caps[1])
+	}
+	if caps[2].Type != capSuperSpeedPlus || !reflect.DeepEqual(caps[2].SublinkSpeeds, []uint32{0x000a4030, 0x000a40b0}) {
+		t.Errorf("SuperSpeedPlus capability is %+v", *caps[2])
+	}
+	if caps[3].Type != capContainerID || caps[3].ContainerID != "5B3C9E2A-1D47-4F0B-9A61-3E2D8C7B6A50" {
+		t.Errorf("container ID is %q", caps[3].ContainerID)
+	}
+	if d.MaxSpeed() != "super_speed_plus" {
+		t.Errorf("max speed is %q", d.MaxSpeed())
+	}
+
+	if !reflect.DeepEqual(d.Languages, []uint16{0x0409}) {
+		t.Errorf("languages are %04x", d.Languages)
+	}
+	wantStrings := map[uint8]string{1: "SanDisk", 2: "Extreme", 3: "1234"}
+	if !reflect.DeepEqual(d.Strings, wantStrings) {
+		t.Errorf("strings are %q, want %q", d.Strings, wantStrings)
+	}
+}
+
+func TestDecodeDescriptorsSysfs(t *testing.T) {
+	// the sysfs descriptors file: device and configuration only
+	b := testDescriptorBlob(t)[:18+44]
+	d, err := DecodeDescriptors(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.BOS != nil || len(d.Strings) != 0 || len(d.Configs) != 1 {
+		t.Errorf("got %+v", d)
+	}
+	// a lower bcdUSB counts MaxPower in 2 mA units
+	b[2], b[3] = 0x00, 0x02
+	if d, err = DecodeDescriptors(b); err != nil || d.Configs[0].MaxPower != 224 || d.MaxSpeed() != "high_speed" {
+		t.Errorf("got %v, %v", d, err)
+	}
+}
+
+func TestDecodeDescriptorsErrors(t *testing.T) {
+	blob := testDescriptorBlob(t)
+	for name, tt := range map[string]struct {
+		b    []byte
+		want string
+	}{
+		"empty":                {nil, "no device descriptor"},
+		"half a header":        {blob[:1], "truncated descriptor header"},
+		"zero length":          {[]byte{0, 1}, "invalid length 0"},
+		"past the end":         {blob[:10], "invalid length 18"},
+		"short device":         {[]byte{4, descDevice, 0, 3}, "device descriptor at offset 0 too short"},
+		"truncated config":     {blob[:18+30], "configuration at offset 18 truncated"},
+		"orphan interface":     {append(append([]byte(nil), blob[:18]...), blob[27:36]...), "outside of a configuration"},
+		"orphan capability":    {append(append([]byte(nil), blob[:18]...), blob[67:74]...), "outside of a BOS"},
+		"short SuperSpeedPlus": {append(append([]byte(nil), blob[:18+44+5]...), 0x0c, 0x10, 0x0a, 0, 1, 0, 0, 0, 0, 0x11, 0, 0), "too short for 2 sublink speeds"},
+		"odd string":           {append(append([]byte(nil), blob[:18]...), 3, descString, 9), "odd length"},
+	} {
+		_, err := DecodeDescriptors(tt.b)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Change is one difference between two discoveries.
+type Change struct {
+	Kind   string `json:"kind"`   // "added", "removed" or "changed"
+	Device string `json:"device"` // key of the stick, see USBKey
+	Name   string `json:"name"`
+	Field  string `json:"field,omitempty"` // e.g. "volume[disk5s2].mount_point"
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s %q", c.Device, c.Name)
+	case "removed":
+		return fmt.Sprintf("- %s %q", c.Device, c.Name)
+	}
+	return fmt.Sprintf("~ %s %q %s: %q -> %q", c.Device, c.Name, c.Field, c.Old, c.New)
+}
+
+// USBKey identifies a stick across discoveries: by vendor, product and
+// serial number, or by location ID for sticks without a serial number.
+func USBKey(ui *USBInfo) string {
+	switch {
+	case ui.SerialNumber != "":
+		return fmt.Sprintf("%04x:%04x/%s", ui.VendorID, ui.ProductID, ui.SerialNumber)
+	case ui.LocationID != 0:
+		return fmt.Sprintf("%04x:%04x@%08x", ui.VendorID, ui.ProductID, ui.LocationID)
+	}
+	return fmt.Sprintf("%04x:%04x", ui.VendorID, ui.ProductID)
+}
+
+// DiffUSBInfos lists the sticks removed from old, added in new and the
+// fields changed on those in both, in a stable order.
+func DiffUSBInfos(old, new []*USBInfo) []Change {
+	oldByKey := make(map[string]*USBInfo, len(old))
+	for _, ui := range old {
+		oldByKey[USBKey(ui)] = ui
+	}
+	newByKey := make(map[string]*USBInfo, len(new))
+	for _, ui := range new {
+		newByKey[USBKey(ui)] = ui
+	}
+	changes := make([]Change, 0)
+	for _, ui := range old {
+		k := USBKey(ui)
+		if _, ok := newByKey[k]; !ok {
+			changes = append(changes, Change{Kind: "removed", Device: k, Name: ui.Name})
+		}
+	}
+	for _, ui := range new {
+		k := USBKey(ui)
+		o, ok := oldByKey[k]
+		if !ok {
+			changes = append(changes, Change{Kind: "added", Device: k, Name: ui.Name})
+			continue
+		}
+		of, nf := flattenUSBInfo(o), flattenUSBInfo(ui)
+		fields := make([]string, 0, len(of)+len(nf))
+		for f := range of {
+			fields = append(fields, f)
+		}
+		for f := range nf {
+			if _, ok := of[f]; !ok {
+				fields = append(fields, f)
+			}
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			if of[f] != nf[f] {
+				changes = append(changes, Change{
+					Kind: "changed", Device: k, Name: ui.Name, Field: f, Old: of[f], New: nf[f],
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// flattenUSBInfo maps the comparable fields of a stick, its media and
+// volumes to their values. Where the info came from is not compared.
+func flattenUSBInfo(ui *USBInfo) map[string]string {
+	m := map[string]string{
+		"name":         ui.Name,
+		"manufacturer": ui.Manufacturer,
+		"location_id":  fmt.Sprintf("%#08x", ui.LocationID),
+		"speed":        ui.Speed,
+	}
+	for _, mi := range ui.Media {
+		p := fmt.Sprintf("media[%s].", mi.DevName)
+		m[p+"name"] = mi.Name
+		m[p+"partition_map"] = mi.PartitionName
+		m[p+"size"] = strconv.FormatInt(mi.Size, 10)
+		for _, vi := range mi.Volumes {
+			p := fmt.Sprintf("volume[%s].", vi.DevName)
+			m[p+"name"] = vi.Name
+			m[p+"size"] = strconv.FormatInt(vi.Size, 10)
+			m[p+"file_system"] = vi.FileSystem
+			m[p+"uuid"] = vi.UUID
+			m[p+"mounted"] = strconv.FormatBool(vi.Mounted)
+			if vi.Mounted {
+				m[p+"mount_point"] = vi.MountPoint
+				m[p+"free"] = strconv.FormatInt(vi.Free, 10)
+				m[p+"writable"] = strconv.FormatBool(vi.Writable)
+			}
+		}
+	}
+	return m
+}
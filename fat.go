@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf16"
+)
+
+// fatFS is a minimal read-only FAT12/16/32 reader, enough to find the volume
+// label and to look up files by path.
+type fatFS struct {
+	r           io.ReaderAt
+	bps         int64  // bytes per sector
+	spc         int64  // sectors per cluster
+	fatStart    int64  // byte offset of the first FAT
+	rootStart   int64  // byte offset of the fixed FAT12/16 root directory
+	rootSize    int64  // byte size of the fixed FAT12/16 root directory
+	dataStart   int64  // byte offset of cluster 2
+	rootCluster uint32 // FAT32 only
+	clusters    uint32
+	bits        int // 12, 16 or 32
+	serial      uint32
+	bpbLabel    string
+}
+
+// fatDirEntry is a directory entry with its long name, if any.
+type fatDirEntry struct {
+	name    string
+	attr    byte
+	cluster uint32
+	size    uint32
+}
+
+// openFAT parses the boot sector of a FAT file system.
+func openFAT(r io.ReaderAt) (*fatFS, error) {
+	b := make([]byte, 512)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("failed to read boot sector: %w", err)
+	}
+	if b[510] != 0x55 || b[511] != 0xaa {
+		return nil, fmt.Errorf("missing boot sector signature")
+	}
+	bps := int64(binary.LittleEndian.Uint16(b[11:]))
+	spc := int64(b[13])
+	reserved := int64(binary.LittleEndian.Uint16(b[14:]))
+	nfats := int64(b[16])
+	rootEntries := int64(binary.LittleEndian.Uint16(b[17:]))
+	total := int64(binary.LittleEndian.Uint16(b[19:]))
+	if total == 0 {
+		total = int64(binary.LittleEndian.Uint32(b[32:]))
+	}
+	fatSize := int64(binary.LittleEndian.Uint16(b[22:]))
+	if fatSize == 0 {
+		fatSize = int64(binary.LittleEndian.Uint32(b[36:]))
+	}
+	switch bps {
+	case 512, 1024, 2048, 4096:
+	default:
+		return nil, fmt.Errorf("invalid bytes per sector %d", bps)
+	}
+	if spc == 0 || spc&(spc-1) != 0 || reserved == 0 || nfats == 0 || fatSize == 0 || total == 0 {
+		return nil, fmt.Errorf("invalid BIOS parameter block")
+	}
+	f := &fatFS{r: r, bps: bps, spc: spc}
+	f.fatStart = reserved * bps
+	f.rootStart = (reserved + nfats*fatSize) * bps
+	f.rootSize = rootEntries * 32
+	rootSectors := (f.rootSize + bps - 1) / bps
+	f.dataStart = f.rootStart + rootSectors*bps
+	dataSectors := total - reserved - nfats*fatSize - rootSectors
+	if dataSectors <= 0 {
+		return nil, fmt.Errorf("invalid BIOS parameter block: no data area")
+	}
+	f.clusters = uint32(dataSectors / spc)
+	ext := 36 // extended BPB of FAT12/16
+	switch {
+	case f.clusters < 4085:
+		f.bits = 12
+	case f.clusters < 65525:
+		f.bits = 16
+	default:
+		f.bits = 32
+		f.rootCluster = binary.LittleEndian.Uint32(b[44:])
+		ext = 64
+	}
+	if b[ext+2] == 0x29 { // extended boot signature
+		f.serial = binary.LittleEndian.Uint32(b[ext+3:])
+		f.bpbLabel = strings.TrimRight(string(b[ext+7:ext+18]), " \x00")
+	}
+	return f, nil
+}
+
+// next returns the cluster following c in the FAT, or 0 at the end of the
+// chain.
+func (f *fatFS) next(c uint32) (uint32, error) {
+	var b [4]byte
+	switch f.bits {
+	case 12:
+		off := int64(c) + int64(c)/2
+		if _, err := f.r.ReadAt(b[:2], f.fatStart+off); err != nil {
+			return 0, err
+		}
+		v := uint32(binary.LittleEndian.Uint16(b[:]))
+		if c&1 != 0 {
+			v >>= 4
+		}
+		c = v & 0xfff
+		if c >= 0xff8 {
+			return 0, nil
+		}
+	case 16:
+		if _, err := f.r.ReadAt(b[:2], f.fatStart+int64(c)*2); err != nil {
+			return 0, err
+		}
+		c = uint32(binary.LittleEndian.Uint16(b[:]))
+		if c >= 0xfff8 {
+			return 0, nil
+		}
+	default:
+		if _, err := f.r.ReadAt(b[:], f.fatStart+int64(c)*4); err != nil {
+			return 0, err
+		}
+		c = binary.LittleEndian.Uint32(b[:]) & 0x0fffffff
+		if c >= 0x0ffffff8 {
+			return 0, nil
+		}
+	}
+	if c < 2 {
+		return 0, fmt.Errorf("corrupt FAT chain")
+	}
+	return c, nil
+}
+
+// readChain reads up to limit bytes of the cluster chain starting at c.
+func (f *fatFS) readChain(c uint32, limit int64) ([]byte, error) {
+	csize := f.bps * f.spc
+	buf := make([]byte, 0)
+	for n := uint32(0); c >= 2 && int64(len(buf)) < limit; n++ {
+		if c-2 >= f.clusters || n > f.clusters {
+			return nil, fmt.Errorf("corrupt FAT chain at cluster %d", c)
+		}
+		b := make([]byte, csize)
+		if _, err := f.r.ReadAt(b, f.dataStart+int64(c-2)*csize); err != nil {
+			return nil, fmt.Errorf("failed to read cluster %d: %w", c, err)
+		}
+		buf = append(buf, b...)
+		next, err := f.next(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow cluster %d: %w", c, err)
+		}
+		c = next
+	}
+	if int64(len(buf)) > limit {
+		buf = buf[:limit]
+	}
+	return buf, nil
+}
+
+// readDir returns the entries of the directory starting at cluster c, or of
+// the root directory if c is 0; the volume label entry is returned too.
+func (f *fatFS) readDir(c uint32) ([]fatDirEntry, error) {
+	var b []byte
+	var err error
+	switch {
+	case c != 0:
+		b, err = f.readChain(c, 1<<22)
+	case f.bits == 32:
+		b, err = f.readChain(f.rootCluster, 1<<22)
+	default:
+		b = make([]byte, f.rootSize)
+		_, err = f.r.ReadAt(b, f.rootStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fatDirEntry, 0)
+	var lfn []uint16
+	for off := 0; off+32 <= len(b); off += 32 {
+		e := b[off : off+32]
+		if e[0] == 0x00 {
+			break
+		}
+		if e[0] == 0xe5 {
+			lfn = nil
+			continue
+		}
+		attr := e[11]
+		if attr == 0x0f {
+			// long name entries come in reverse order before the short entry
+			part := make([]uint16, 0, 13)
+			for _, r := range [][2]int{{1, 11}, {14, 26}, {28, 32}} {
+				for i := r[0]; i < r[1]; i += 2 {
+					part = append(part, binary.LittleEndian.Uint16(e[i:]))
+				}
+			}
+			if e[0]&0x40 != 0 {
+				lfn = nil
+			}
+			lfn = append(part, lfn...)
+			continue
+		}
+		name := ""
+		if lfn != nil {
+			for i, u := range lfn {
+				if u == 0 || u == 0xffff {
+					lfn = lfn[:i]
+					break
+				}
+			}
+			name = string(utf16.Decode(lfn))
+			lfn = nil
+		}
+		if name == "" {
+			base := strings.TrimRight(string(e[0:8]), " ")
+			extn := strings.TrimRight(string(e[8:11]), " ")
+			if e[0] == 0x05 {
+				base = "\xe5" + base[1:]
+			}
+			name = base
+			if extn != "" {
+				name += "." + extn
+			}
+			if attr&0x08 != 0 {
+				name = strings.TrimRight(string(e[0:11]), " ")
+			}
+		}
+		cluster := uint32(binary.LittleEndian.Uint16(e[26:]))
+		if f.bits == 32 {
+			cluster |= uint32(binary.LittleEndian.Uint16(e[20:])) << 16
+		}
+		entries = append(entries, fatDirEntry{
+			name:    name,
+			attr:    attr,
+			cluster: cluster,
+			size:    binary.LittleEndian.Uint32(e[28:]),
+		})
+	}
+	return entries, nil
+}
+
+// label returns the volume label from the root directory, falling back to
+// the one in the boot sector like blkid does.
+func (f *fatFS) label() string {
+	if entries, err := f.readDir(0); err == nil {
+		for _, e := range entries {
+			if e.attr&0x08 != 0 && e.attr&0x10 == 0 && e.attr != 0x0f {
+				return e.name
+			}
+		}
+	}
+	if f.bpbLabel == "NO NAME" {
+		return ""
+	}
+	return f.bpbLabel
+}
+
+// lookup finds a file or directory by slash-separated path; FAT names are
+// case-insensitive.
+func (f *fatFS) lookup(name string) (*fatDirEntry, error) {
+	var dir uint32
+	var found *fatDirEntry
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if found != nil && found.attr&0x10 == 0 {
+			return nil, fmt.Errorf("%s: not a directory", found.name)
+		}
+		entries, err := f.readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		found = nil
+		for i := range entries {
+			if entries[i].attr&0x08 == 0 && strings.EqualFold(entries[i].name, part) {
+				found = &entries[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+		dir = found.cluster
+	}
+	return found, nil
+}
+
+func (f *fatFS) stat(name string) (int64, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return int64(e.size), nil
+}
+
+func (f *fatFS) readFile(name string, limit int64) ([]byte, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if e.attr&0x10 != 0 {
+		return nil, fmt.Errorf("%s: is a directory", name)
+	}
+	if int64(e.size) < limit {
+		limit = int64(e.size)
+	}
+	return f.readChain(e.cluster, limit)
+}
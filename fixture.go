@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Fixture name policies: which names AnonymizeSystemProfiler replaces.
+const (
+	FixtureNamesKeep    = "keep"    // none
+	FixtureNamesVolumes = "volumes" // volume labels, which users choose
+	FixtureNamesAll     = "all"     // also device, media and manufacturer names
+)
+
+// FixturePolicy is what AnonymizeSystemProfiler changes in a document.
+type FixturePolicy struct {
+	Redactor *Redactor // serial numbers, UUIDs and user names in mount points
+	Names    string    // one of the FixtureNames policies
+	Prune    bool      // drop buses and devices with no storage below them
+}
+
+// AnonymizeSystemProfiler rewrites a system_profiler -json document, as
+// decodeSnapshot returns it, for use as a fixture. The same name always
+// gets the same replacement, so the structure of the document is kept.
+func AnonymizeSystemProfiler(data any, p FixturePolicy) (any, error) {
+	d, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("data (%T) is not map[string]interface{} type", data)
+	}
+	dta, ok := d["SPUSBDataType"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("data[SPUSBDataType] (%T) is not []interface{} type", d["SPUSBDataType"])
+	}
+	a := &anonymizer{policy: p, names: make(map[string]string), counts: make(map[string]int)}
+	buses := make([]any, 0, len(dta))
+	for _, bus := range dta {
+		m, ok := bus.(map[string]any)
+		if !ok {
+			continue
+		}
+		if p.Prune && !a.hasStorage(m) {
+			continue
+		}
+		a.items(m)
+		buses = append(buses, m)
+	}
+	d["SPUSBDataType"] = buses
+	return d, nil
+}
+
+type anonymizer struct {
+	policy FixturePolicy
+	names  map[string]string // kind and name -> replacement
+	counts map[string]int    // replacements by kind
+}
+
+// name returns the replacement of a name of a kind, e.g. "Volume 2".
+func (a *anonymizer) name(kind, name string) string {
+	if name == "" {
+		return ""
+	}
+	k := kind + "\x00" + name
+	if rv, ok := a.names[k]; ok {
+		return rv
+	}
+	a.counts[kind]++
+	rv := fmt.Sprintf("%s %d", kind, a.counts[kind])
+	a.names[k] = rv
+	return rv
+}
+
+// hasStorage tells whether a device or any device below it has media.
+func (a *anonymizer) hasStorage(m map[string]any) bool {
+	if _, ok := m["Media"]; ok {
+		return true
+	}
+	items, _ := m["_items"].([]any)
+	for _, it := range items {
+		if im, ok := it.(map[string]any); ok && a.hasStorage(im) {
+			return true
+		}
+	}
+	return false
+}
+
+// items anonymizes the devices below a bus or hub, dropping those without
+// storage if pruning.
+func (a *anonymizer) items(m map[string]any) {
+	items, ok := m["_items"].([]any)
+	if !ok {
+		return
+	}
+	kept := make([]any, 0, len(items))
+	for _, it := range items {
+		dm, ok := it.(map[string]any)
+		if !ok || (a.policy.Prune && !a.hasStorage(dm)) {
+			continue
+		}
+		a.device(dm)
+		kept = append(kept, dm)
+	}
+	m["_items"] = kept
+}
+
+func (a *anonymizer) device(m map[string]any) {
+	a.redact(m, "serial_num")
+	if a.policy.Names == FixtureNamesAll {
+		// hub_device is what system_profiler calls hubs without a name
+		if m["_name"] != "hub_device" {
+			a.rename(m, "_name", "Device")
+		}
+		a.rename(m, "manufacturer", "Manufacturer")
+	}
+	media, _ := m["Media"].([]any)
+	for _, mi := range media {
+		mm, ok := mi.(map[string]any)
+		if !ok {
+			continue
+		}
+		if a.policy.Names == FixtureNamesAll {
+			a.rename(mm, "_name", "Media")
+		}
+		vols, _ := mm["volumes"].([]any)
+		for _, vi := range vols {
+			if vm, ok := vi.(map[string]any); ok {
+				a.volume(vm)
+			}
+		}
+	}
+	a.items(m)
+}
+
+func (a *anonymizer) volume(m map[string]any) {
+	for k := range m {
+		if strings.HasSuffix(k, "_uuid") {
+			a.redact(m, k)
+		}
+	}
+	mp, _ := m["mount_point"].(string)
+	if mp != "" && a.policy.Redactor != nil {
+		mp = a.policy.Redactor.path(mp)
+	}
+	// a name that is the partition's content, such as EFI, is no label
+	if name, _ := m["_name"].(string); a.policy.Names != FixtureNamesKeep && name != "" && name != m["iocontent"] {
+		rv := a.name("Volume", name)
+		m["_name"] = rv
+		// macOS mounts volumes by their name
+		if path.Base(mp) == name {
+			mp = path.Join(path.Dir(mp), rv)
+		}
+	}
+	if mp != "" {
+		m["mount_point"] = mp
+	}
+}
+
+func (a *anonymizer) redact(m map[string]any, key string) {
+	if s, ok := m[key].(string); ok && a.policy.Redactor != nil {
+		m[key] = a.policy.Redactor.value(s)
+	}
+}
+
+func (a *anonymizer) rename(m map[string]any, key, kind string) {
+	if s, ok := m[key].(string); ok {
+		m[key] = a.name(kind, s)
+	}
+}
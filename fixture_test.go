@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// twoSnapshots decodes GPTPartitioned.json and appends its buses once more,
+// so every serial number, UUID and volume name is there twice.
+func twoSnapshots(t *testing.T) any {
+	t.Helper()
+	b, err := os.ReadFile("testdata/GPTPartitioned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs [2]map[string]any
+	for i := range docs {
+		data, err := decodeSnapshot(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[i] = data.(map[string]any)
+	}
+	docs[0]["SPUSBDataType"] = append(docs[0]["SPUSBDataType"].([]any), docs[1]["SPUSBDataType"].([]any)...)
+	return docs[0]
+}
+
+func anonymize(t *testing.T, key string) ([]byte, []*USBInfo) {
+	t.Helper()
+	r, err := NewRedactor(RedactHMAC, []byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := AnonymizeSystemProfiler(twoSnapshots(t), FixturePolicy{Redactor: r, Names: FixtureNamesVolumes, Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uis, err := ParseSnapshot(b)
+	if err != nil {
+		t.Fatalf("the fixture does not parse: %v", err)
+	}
+	return b, uis
+}
+
+func TestAnonymizeSystemProfiler(t *testing.T) {
+	b, uis := anonymize(t, "fixture")
+	for _, s := range []string{"000000000000004010", "0E239BC6-F960-3107-89CF-1C97F78BB46B", "6ABA678A-0FF6-3876-83B7-FE44B24110EB", "OEL9"} {
+		if strings.Contains(string(b), s) {
+			t.Errorf("the fixture still contains %q", s)
+		}
+	}
+	if len(uis) != 2 {
+		t.Fatalf("got %d sticks, want 2", len(uis))
+	}
+	a, c := uis[0], uis[1]
+	if a.SerialNumber == "" || a.SerialNumber != c.SerialNumber || len(a.SerialNumber) != len("000000000000004010") {
+		t.Errorf("serial numbers %q and %q should be the same pseudonym", a.SerialNumber, c.SerialNumber)
+	}
+	// names and IDs of the device are no secret under FixtureNamesVolumes
+	if a.Name != "PenDrive" || a.VendorID != 0x1f75 || a.LocationID != 0x40110000 {
+		t.Errorf("got %q %04x at %#08x", a.Name, a.VendorID, a.LocationID)
+	}
+	for i, want := range []struct{ name, mountPoint string }{
+		{"EFI", ""}, // the partition content, not a label
+		{"Volume 1", "/Volumes/Volume 1"},
+	} {
+		va, vc := a.Media[0].Volumes[i], c.Media[0].Volumes[i]
+		if va.Name != want.name || va.MountPoint != want.mountPoint {
+			t.Errorf("volume %d is %q at %q, want %q at %q", i+1, va.Name, va.MountPoint, want.name, want.mountPoint)
+		}
+		if va.UUID == "" || va.UUID != vc.UUID || va.Name != vc.Name || va.MountPoint != vc.MountPoint {
+			t.Errorf("volume %d was replaced differently: %+v vs. %+v", i+1, *va, *vc)
+		}
+	}
+	if a.Media[0].Volumes[0].UUID == a.Media[0].Volumes[1].UUID {
+		t.Error("different UUIDs got the same pseudonym")
+	}
+
+	again, _ := anonymize(t, "fixture")
+	if string(again) != string(b) {
+		t.Error("the same key gave a different fixture")
+	}
+	if other, _ := anonymize(t, "other"); string(other) == string(b) {
+		t.Error("another key gave the same fixture")
+	}
+}
+
+func TestAnonymizeSystemProfilerNames(t *testing.T) {
+	data, err := AnonymizeSystemProfiler(twoSnapshots(t), FixturePolicy{Names: FixtureNamesAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(data)
+	uis, err := ParseSnapshot(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui := uis[0]
+	if uis[1].Name != ui.Name || uis[1].Manufacturer != ui.Manufacturer {
+		t.Errorf("the same stick got the names %q and %q", ui.Name, uis[1].Name)
+	}
+	if !strings.HasPrefix(ui.Name, "Device ") || !strings.HasPrefix(ui.Manufacturer, "Manufacturer ") || ui.Media[0].Name != "Media 1" {
+		t.Errorf("got device %q by %q with media %q", ui.Name, ui.Manufacturer, ui.Media[0].Name)
+	}
+	// without a redactor, serial numbers are kept
+	if ui.SerialNumber != "000000000000004010" {
+		t.Errorf("serial number is %q", ui.SerialNumber)
+	}
+}
+
+func TestAnonymizeSystemProfilerInvalid(t *testing.T) {
+	for _, data := range []any{nil, []any{}, map[string]any{"SPUSBDataType": "x"}} {
+		if _, err := AnonymizeSystemProfiler(data, FixturePolicy{}); err == nil {
+			t.Errorf("got no error for %#v", data)
+		}
+	}
+}
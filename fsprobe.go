@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// FSProbe is what a superblock probe found out about a file system, in the
+// manner of blkid.
+type FSProbe struct {
+	Type       string // blkid type: vfat, exfat, ntfs, ext2/3/4, hfsplus, apfs, iso9660
+	FileSystem string // system_profiler naming, e.g. "MS-DOS FAT32"
+	Label      string
+	UUID       string
+}
+
+// Apply fills the empty name, file system and UUID fields of a volume.
+func (p FSProbe) Apply(vi *VolumeInfo) {
+	if vi.Name == "" {
+		vi.Name = p.Label
+	}
+	if vi.FileSystem == "" {
+		vi.FileSystem = p.FileSystem
+	}
+	if vi.UUID == "" {
+		vi.UUID = p.UUID
+	}
+}
+
+// fileSystemName maps a blkid file system type and version, as found in
+// ID_FS_TYPE and ID_FS_VERSION or lsblk's FSTYPE and FSVER, to the names used
+// by system_profiler. Types system_profiler does not know are kept.
+func fileSystemName(typ, version string) string {
+	switch typ {
+	case "vfat", "msdos":
+		switch version {
+		case "FAT12", "FAT16", "FAT32":
+			return "MS-DOS " + version
+		}
+		return "MS-DOS"
+	case "exfat":
+		return "ExFAT"
+	case "ntfs", "ntfs3":
+		return "NTFS"
+	case "hfsplus":
+		return "HFS+"
+	case "apfs":
+		return "APFS"
+	case "iso9660":
+		return "ISO 9660"
+	case "udf":
+		return "UDF"
+	}
+	return typ
+}
+
+// ProbeFilesystem identifies the file system of a partition or unpartitioned
+// disk by its superblock.
+func ProbeFilesystem(r io.ReaderAt, size int64) (*FSProbe, error) {
+	// ISO 9660 goes first: hybrid images also carry an MBR and FAT-like
+	// boot sectors
+	for _, probe := range []func(io.ReaderAt) (*FSProbe, error){
+		probeISO9660, probeExFAT, probeNTFS, probeFAT, probeExt, probeHFSPlus, probeAPFS,
+	} {
+		p, err := probe(r)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown file system")
+}
+
+// ProbeVolumes probes every unmounted volume of a media that has a known
+// offset on the disk or image r, or the whole media if it has no
+// partitions, and fills in what system_profiler would have reported.
+// Mounted volumes are skipped: the kernel knows them better than a
+// superblock that may be stale on the device.
+func ProbeVolumes(r io.ReaderAt, size int64, mi *MediaInfo) error {
+	if len(mi.Volumes) == 0 {
+		p, err := ProbeFilesystem(r, size)
+		if err != nil {
+			return nil // raw media without a file system
+		}
+		vi := &VolumeInfo{DevName: mi.DevName, Size: size}
+		p.Apply(vi)
+		mi.Volumes = append(mi.Volumes, vi)
+		return nil
+	}
+	for _, vi := range mi.Volumes {
+		if vi.Mounted || vi.Offset == 0 || vi.Size == 0 {
+			continue
+		}
+		p, err := ProbeFilesystem(io.NewSectionReader(r, vi.Offset, vi.Size), vi.Size)
+		if err != nil {
+			continue
+		}
+		p.Apply(vi)
+	}
+	return nil
+}
+
+// FSProbeEnricher probes the file systems of unmounted volumes from their
+// block devices, for the labels, types and UUIDs that the Linux backends
+// only get from udev. Opening block devices needs privileges, so a device
+// that cannot be opened for lack of them is skipped.
+type FSProbeEnricher struct {
+	// DevDir is where the device nodes are, "/dev" by default.
+	DevDir string
+}
+
+// Enrich probes the media of uis that have unmounted volumes, or no
+// volumes at all, by their device name.
+func (e FSProbeEnricher) Enrich(ctx context.Context, uis []*USBInfo) error {
+	dir := e.DevDir
+	if dir == "" {
+		dir = "/dev"
+	}
+	var errs []string
+	for _, ui := range uis {
+		for _, mi := range ui.Media {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if mi.DevName == "" || !hasUnmounted(mi) {
+				continue
+			}
+			f, size, err := OpenImage(filepath.Join(dir, mi.DevName))
+			if errors.Is(err, fs.ErrPermission) {
+				debugf("skipping file system probe: %v\n", err)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			err = ProbeVolumes(f, size, mi)
+			f.Close()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", mi.DevName, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to probe file systems: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func hasUnmounted(mi *MediaInfo) bool {
+	if len(mi.Volumes) == 0 {
+		return true
+	}
+	for _, vi := range mi.Volumes {
+		if !vi.Mounted {
+			return true
+		}
+	}
+	return false
+}
+
+// readAt reads n bytes at off; short reads past the end of small partitions
+// are not errors, they just do not match.
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	m, err := r.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b[:m], nil
+}
+
+func probeFAT(r io.ReaderAt) (*FSProbe, error) {
+	b, err := readAt(r, 0, 512)
+	if err != nil || len(b) < 512 {
+		return nil, err
+	}
+	// a jump instruction and a sane BPB, as there is no real magic
+	if (b[0] != 0xeb && b[0] != 0xe9) || bytes.Equal(b[3:11], []byte("NTFS    ")) || bytes.Equal(b[3:11], []byte("EXFAT   ")) {
+		return nil, nil
+	}
+	f, err := openFAT(r)
+	if err != nil {
+		return nil, nil
+	}
+	p := &FSProbe{
+		Type:       "vfat",
+		FileSystem: fileSystemName("vfat", fmt.Sprintf("FAT%d", f.bits)),
+		Label:      f.label(),
+	}
+	if f.serial != 0 {
+		p.UUID = fmt.Sprintf("%04X-%04X", f.serial>>16, f.serial&0xffff)
+	}
+	return p, nil
+}
+
+func probeExFAT(r io.ReaderAt) (*FSProbe, error) {
+	b, err := readAt(r, 0, 512)
+	if err != nil || len(b) < 512 || !bytes.Equal(b[3:11], []byte("EXFAT   ")) {
+		return nil, err
+	}
+	serial := binary.LittleEndian.Uint32(b[100:])
+	p := &FSProbe{
+		Type:       "exfat",
+		FileSystem: fileSystemName("exfat", ""),
+		UUID:       fmt.Sprintf("%04X-%04X", serial>>16, serial&0xffff),
+	}
+	// the label is an entry of type 0x83 in the first cluster of the root
+	// directory
+	// the specification allows 512-4096 byte sectors and clusters of up
+	// to 32 MiB, shifts beyond that would overflow
+	if b[108] < 9 || b[108] > 12 || int(b[108])+int(b[109]) > 25 {
+		return p, nil
+	}
+	bps := int64(1) << b[108]
+	cs := bps << b[109]
+	heap := int64(binary.LittleEndian.Uint32(b[88:])) * bps
+	root := int64(binary.LittleEndian.Uint32(b[96:]))
+	if root < 2 {
+		return p, nil
+	}
+	dir, err := readAt(r, heap+(root-2)*cs, int(cs))
+	if err != nil {
+		return p, nil
+	}
+	for off := 0; off+32 <= len(dir) && dir[off] != 0; off += 32 {
+		if dir[off] != 0x83 {
+			continue
+		}
+		n := int(dir[off+1])
+		if n > 11 {
+			n = 11
+		}
+		u := make([]uint16, n)
+		for i := range u {
+			u[i] = binary.LittleEndian.Uint16(dir[off+2+2*i:])
+		}
+		p.Label = string(utf16.Decode(u))
+		break
+	}
+	return p, nil
+}
+
+func probeNTFS(r io.ReaderAt) (*FSProbe, error) {
+	b, err := readAt(r, 0, 512)
+	if err != nil || len(b) < 512 || !bytes.Equal(b[3:11], []byte("NTFS    ")) {
+		return nil, err
+	}
+	p := &FSProbe{
+		Type:       "ntfs",
+		FileSystem: fileSystemName("ntfs", ""),
+		UUID:       fmt.Sprintf("%016X", binary.LittleEndian.Uint64(b[72:])),
+	}
+	// the label is the $VOLUME_NAME attribute of MFT record 3 ($Volume)
+	// the sector size bounds the fixups below, so it must be sane
+	bps := int64(binary.LittleEndian.Uint16(b[11:]))
+	if bps < 256 || bps > 4096 || bps&(bps-1) != 0 || b[13] == 0 {
+		return p, nil
+	}
+	cs := bps * int64(b[13])
+	mft := int64(binary.LittleEndian.Uint64(b[48:])) * cs
+	recSize := int64(int8(b[64]))
+	if recSize < 0 {
+		recSize = 1 << uint(-recSize)
+	} else {
+		recSize *= cs
+	}
+	if recSize < 512 || recSize > 64*1024 {
+		return p, nil
+	}
+	rec, err := readAt(r, mft+3*recSize, int(recSize))
+	if err != nil || int64(len(rec)) < recSize || !bytes.Equal(rec[0:4], []byte("FILE")) {
+		return p, nil
+	}
+	// undo the update sequence fixups at the end of each sector
+	usa := int(binary.LittleEndian.Uint16(rec[4:]))
+	usn := int(binary.LittleEndian.Uint16(rec[6:]))
+	for i := 1; i < usn && usa+2*i+2 <= len(rec); i++ {
+		end := i*int(bps) - 2
+		if end+2 > len(rec) {
+			break
+		}
+		copy(rec[end:end+2], rec[usa+2*i:usa+2*i+2])
+	}
+	for off := int(binary.LittleEndian.Uint16(rec[20:])); off+16 <= len(rec); {
+		typ := binary.LittleEndian.Uint32(rec[off:])
+		l := int(binary.LittleEndian.Uint32(rec[off+4:]))
+		if typ == 0xffffffff || l < 16 || off+l > len(rec) {
+			break
+		}
+		if typ == 0x60 && rec[off+8] == 0 { // resident $VOLUME_NAME
+			if l < 24 {
+				break // too short for the value length and offset
+			}
+			cl := int(binary.LittleEndian.Uint32(rec[off+16:]))
+			co := int(binary.LittleEndian.Uint16(rec[off+20:]))
+			if off+co+cl <= len(rec) {
+				u := make([]uint16, cl/2)
+				for i := range u {
+					u[i] = binary.LittleEndian.Uint16(rec[off+co+2*i:])
+				}
+				p.Label = string(utf16.Decode(u))
+			}
+			break
+		}
+		off += l
+	}
+	return p, nil
+}
+
+func probeExt(r io.ReaderAt) (*FSProbe, error) {
+	sb, err := readAt(r, 1024, 1024)
+	if err != nil || len(sb) < 1024 || binary.LittleEndian.Uint16(sb[56:]) != 0xef53 {
+		return nil, err
+	}
+	compat := binary.LittleEndian.Uint32(sb[92:])
+	incompat := binary.LittleEndian.Uint32(sb[96:])
+	roCompat := binary.LittleEndian.Uint32(sb[100:])
+	typ := "ext2"
+	switch {
+	case incompat&(0x40|0x80|0x200) != 0 || roCompat&(0x08|0x10|0x20|0x40|0x400) != 0:
+		typ = "ext4" // extents, 64bit, flex_bg, huge_file, gdt_csum, ...
+	case compat&0x04 != 0:
+		typ = "ext3" // has_journal
+	}
+	u := sb[104:120]
+	return &FSProbe{
+		Type:       typ,
+		FileSystem: fileSystemName(typ, ""),
+		Label:      strings.TrimRight(string(sb[120:136]), "\x00"),
+		UUID:       fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]),
+	}, nil
+}
+
+// hfsUUIDNamespace is the namespace macOS uses to turn the 64-bit HFS+
+// volume identifier into the volume UUID.
+var hfsUUIDNamespace = []byte{
+	0xb3, 0xe2, 0x0f, 0x39, 0xf2, 0x92, 0x11, 0xd6,
+	0x97, 0xa4, 0x00, 0x30, 0x65, 0x43, 0xec, 0xac,
+}
+
+func probeHFSPlus(r io.ReaderAt) (*FSProbe, error) {
+	vh, err := readAt(r, 1024, 512)
+	if err != nil || len(vh) < 512 {
+		return nil, err
+	}
+	sig := string(vh[0:2])
+	if sig != "H+" && sig != "HX" {
+		return nil, nil
+	}
+	p := &FSProbe{Type: "hfsplus", FileSystem: fileSystemName("hfsplus", "")}
+	if sig == "HX" {
+		p.FileSystem = "HFSX"
+	}
+	if binary.BigEndian.Uint32(vh[4:])&(1<<13) != 0 {
+		p.FileSystem = "Journaled " + p.FileSystem
+	}
+	id := vh[80+24 : 80+32] // finderInfo[6..7]
+	if binary.BigEndian.Uint64(id) != 0 {
+		sum := md5.Sum(append(append([]byte(nil), hfsUUIDNamespace...), id...))
+		sum[6] = sum[6]&0x0f | 0x30 // version 3
+		sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+		p.UUID = fmt.Sprintf("%X-%X-%X-%X-%X", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	}
+	return p, nil
+}
+
+func probeAPFS(r io.ReaderAt) (*FSProbe, error) {
+	sb, err := readAt(r, 0, 4096)
+	if err != nil || len(sb) < 88 || !bytes.Equal(sb[32:36], []byte("NXSB")) {
+		return nil, err
+	}
+	u := sb[72:88] // nx_uuid of the container
+	return &FSProbe{
+		Type:       "apfs",
+		FileSystem: fileSystemName("apfs", ""),
+		UUID:       fmt.Sprintf("%X-%X-%X-%X-%X", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]),
+	}, nil
+}
+
+func probeISO9660(r io.ReaderAt) (*FSProbe, error) {
+	// the primary volume descriptor is the first one of type 1 from
+	// sector 16 on
+	for sector := int64(16); sector < 32; sector++ {
+		vd, err := readAt(r, sector*2048, 2048)
+		if err != nil || len(vd) < 2048 || !bytes.Equal(vd[1:6], []byte("CD001")) {
+			return nil, err
+		}
+		switch vd[0] {
+		case 0xff:
+			return nil, nil // set terminator without a primary descriptor
+		case 0x01:
+		default:
+			continue
+		}
+		p := &FSProbe{
+			Type:       "iso9660",
+			FileSystem: fileSystemName("iso9660", ""),
+			Label:      strings.TrimRight(string(vd[40:72]), " "),
+		}
+		// blkid derives the UUID from the creation (or else modification) time
+		for _, t := range [][]byte{vd[813:830], vd[830:847]} {
+			if t[0] >= '0' && t[0] <= '9' && !bytes.Equal(t[:16], []byte("0000000000000000")) {
+				p.UUID = fmt.Sprintf("%s-%s-%s-%s-%s-%s-%s",
+					t[0:4], t[4:6], t[6:8], t[8:10], t[10:12], t[12:14], t[14:16])
+				break
+			}
+		}
+		return p, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// makeFAT16 returns a 16 MiB FAT16 file system with a volume label and
+// files, given by slash separated 8.3 paths; their directories are created.
+func makeFAT16(label string, serial uint32, files map[string]string) []byte {
+	const (
+		bps      = 512
+		spc      = 4
+		reserved = 1
+		fatSize  = 32
+		rootEnts = 512
+		total    = 32768
+	)
+	img := make([]byte, total*bps)
+	b := img[:512]
+	copy(b, []byte{0xeb, 0x3c, 0x90})
+	copy(b[3:], "MSDOS5.0")
+	binary.LittleEndian.PutUint16(b[11:], bps)
+	b[13] = spc
+	binary.LittleEndian.PutUint16(b[14:], reserved)
+	b[16] = 2
+	binary.LittleEndian.PutUint16(b[17:], rootEnts)
+	binary.LittleEndian.PutUint16(b[19:], total)
+	b[21] = 0xf8
+	binary.LittleEndian.PutUint16(b[22:], fatSize)
+	b[38] = 0x29
+	binary.LittleEndian.PutUint32(b[39:], serial)
+	copy(b[43:54], fatName(label, true))
+	copy(b[54:62], "FAT16   ")
+	b[510], b[511] = 0x55, 0xaa
+
+	fat := int64(reserved * bps)
+	root := fat + 2*fatSize*bps
+	data := root + rootEnts*32
+	next := uint32(2)
+	binary.LittleEndian.PutUint16(img[fat:], 0xfff8)
+	binary.LittleEndian.PutUint16(img[fat+2:], 0xffff)
+	// alloc stores content in a chain of new clusters
+	alloc := func(content []byte) uint32 {
+		n := (len(content) + spc*bps - 1) / (spc * bps)
+		if n == 0 {
+			n = 1
+		}
+		first := next
+		for i := 0; i < n; i++ {
+			c := next
+			next++
+			v := uint16(next)
+			if i == n-1 {
+				v = 0xffff
+			}
+			binary.LittleEndian.PutUint16(img[fat+int64(c)*2:], v)
+		}
+		copy(img[data+int64(first-2)*spc*bps:], content)
+		return first
+	}
+	entry := func(name string, attr byte, cluster uint32, size int) []byte {
+		e := make([]byte, 32)
+		copy(e, fatName(name, attr&0x08 != 0))
+		e[11] = attr
+		binary.LittleEndian.PutUint16(e[26:], uint16(cluster))
+		binary.LittleEndian.PutUint32(e[28:], uint32(size))
+		return e
+	}
+	// dir writes the entries of the directory prefix, depth first
+	var dir func(prefix string) []byte
+	dir = func(prefix string) []byte {
+		var buf []byte
+		seen := make(map[string]bool)
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			rest := name[len(prefix):]
+			if i := strings.IndexByte(rest, '/'); i >= 0 {
+				if sub := rest[:i]; !seen[sub] {
+					seen[sub] = true
+					buf = append(buf, entry(sub, 0x10, alloc(dir(prefix+sub+"/")), 0)...)
+				}
+				continue
+			}
+			buf = append(buf, entry(rest, 0x20, alloc([]byte(files[name])), len(files[name]))...)
+		}
+		return buf
+	}
+	entries := dir("")
+	if label != "" {
+		entries = append(entry(label, 0x08, 0, 0), entries...)
+	}
+	copy(img[root:], entries)
+	copy(img[fat+fatSize*bps:], img[fat:fat+fatSize*bps])
+	return img
+}
+
+// fatName pads a name to the 11 characters of a FAT short name.
+func fatName(name string, label bool) string {
+	if !label {
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			return (name[:i] + "        ")[:8] + (name[i+1:] + "   ")[:3]
+		}
+	}
+	return (name + "           ")[:11]
+}
+
+func makeExFAT(label string, serial uint32) []byte {
+	img := make([]byte, 1<<20)
+	b := img[:512]
+	copy(b, []byte{0xeb, 0x76, 0x90})
+	copy(b[3:], "EXFAT   ")
+	binary.LittleEndian.PutUint32(b[88:], 32) // cluster heap at sector 32
+	binary.LittleEndian.PutUint32(b[96:], 4)  // root directory at cluster 4
+	binary.LittleEndian.PutUint32(b[100:], serial)
+	b[108], b[109] = 9, 3 // 512 byte sectors, 4 KiB clusters
+	b[510], b[511] = 0x55, 0xaa
+	dir := img[32*512+2*4096:]
+	dir[0] = 0x83
+	name := utf16.Encode([]rune(label))
+	dir[1] = byte(len(name))
+	for i, c := range name {
+		binary.LittleEndian.PutUint16(dir[2+2*i:], c)
+	}
+	return img
+}
+
+func makeNTFS(label string, serial uint64) []byte {
+	img := make([]byte, 1<<20)
+	b := img[:512]
+	copy(b, []byte{0xeb, 0x52, 0x90})
+	copy(b[3:], "NTFS    ")
+	binary.LittleEndian.PutUint16(b[11:], 512)
+	b[13] = 8                                // 4 KiB clusters
+	binary.LittleEndian.PutUint64(b[48:], 4) // $MFT at cluster 4
+	b[64] = 0xf6                             // 1 KiB records
+	binary.LittleEndian.PutUint64(b[72:], serial)
+	b[510], b[511] = 0x55, 0xaa
+
+	rec := img[4*4096+3*1024 : 4*4096+4*1024]
+	copy(rec, "FILE")
+	binary.LittleEndian.PutUint16(rec[4:], 48) // update sequence array
+	binary.LittleEndian.PutUint16(rec[6:], 3)  // its number of entries
+	binary.LittleEndian.PutUint16(rec[48:], 7) // update sequence number
+	binary.LittleEndian.PutUint16(rec[20:], 56)
+	// the ends of the sectors hold the update sequence number, their
+	// real content is in the array
+	binary.LittleEndian.PutUint16(rec[510:], 7)
+	binary.LittleEndian.PutUint16(rec[1022:], 7)
+	name := utf16.Encode([]rune(label))
+	a := rec[56:]
+	l := (24 + 2*len(name) + 7) &^ 7
+	binary.LittleEndian.PutUint32(a[0:], 0x60)
+	binary.LittleEndian.PutUint32(a[4:], uint32(l))
+	binary.LittleEndian.PutUint32(a[16:], uint32(2*len(name)))
+	binary.LittleEndian.PutUint16(a[20:], 24)
+	for i, c := range name {
+		binary.LittleEndian.PutUint16(a[24+2*i:], c)
+	}
+	binary.LittleEndian.PutUint32(a[l:], 0xffffffff)
+	return img
+}
+
+func makeExt4(label string, uuid []byte) []byte {
+	img := make([]byte, 64<<10)
+	sb := img[1024:2048]
+	binary.LittleEndian.PutUint16(sb[56:], 0xef53)
+	binary.LittleEndian.PutUint32(sb[92:], 0x04) // has_journal
+	binary.LittleEndian.PutUint32(sb[96:], 0x40) // extents
+	copy(sb[104:], uuid)
+	copy(sb[120:136], label)
+	return img
+}
+
+func TestProbeFilesystem(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want FSProbe
+	}{
+		{"fat16", makeFAT16("STICK", 0x1a2b3c4d, map[string]string{"README.TXT": "hello"}),
+			FSProbe{Type: "vfat", FileSystem: "MS-DOS FAT16", Label: "STICK", UUID: "1A2B-3C4D"}},
+		{"fat16 without label", makeFAT16("", 0x00c0ffee, nil),
+			FSProbe{Type: "vfat", FileSystem: "MS-DOS FAT16", UUID: "00C0-FFEE"}},
+		{"exfat", makeExFAT("Backup 2024", 0xdeadbeef),
+			FSProbe{Type: "exfat", FileSystem: "ExFAT", Label: "Backup 2024", UUID: "DEAD-BEEF"}},
+		{"ntfs", makeNTFS("Windows", 0x0123456789abcdef),
+			FSProbe{Type: "ntfs", FileSystem: "NTFS", Label: "Windows", UUID: "0123456789ABCDEF"}},
+		{"ext4", makeExt4("rootfs", []byte("\x3e\x8c\x1a\x2b\x4d\x5e\x46\x7f\x80\x91\xa2\xb3\xc4\xd5\xe6\xf7")),
+			FSProbe{Type: "ext4", FileSystem: "ext4", Label: "rootfs", UUID: "3e8c1a2b-4d5e-467f-8091-a2b3c4d5e6f7"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ProbeFilesystem(bytes.NewReader(tt.img), int64(len(tt.img)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *p != tt.want {
+				t.Errorf("got %+v, want %+v", *p, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileSystemName(t *testing.T) {
+	for _, tt := range []struct{ typ, version, want string }{
+		{"vfat", "FAT32", "MS-DOS FAT32"},
+		{"vfat", "FAT16", "MS-DOS FAT16"},
+		{"vfat", "", "MS-DOS"},
+		{"exfat", "1.0", "ExFAT"},
+		{"ntfs", "", "NTFS"},
+		{"hfsplus", "", "HFS+"},
+		{"iso9660", "Joliet Extension", "ISO 9660"},
+		{"ext4", "1.0", "ext4"},
+		{"", "", ""},
+	} {
+		if got := fileSystemName(tt.typ, tt.version); got != tt.want {
+			t.Errorf("fileSystemName(%q, %q) = %q, want %q", tt.typ, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestProbeFilesystemUnknown(t *testing.T) {
+	img := make([]byte, 64<<10)
+	if p, err := ProbeFilesystem(bytes.NewReader(img), int64(len(img))); err == nil {
+		t.Errorf("got %+v for a blank image", *p)
+	}
+}
+
+func TestProbeFilesystemCrafted(t *testing.T) {
+	// boot sectors whose geometry once made the probes panic; they must
+	// still be recognized, just without a label
+	exfat := makeExFAT("X", 1)
+	exfat[108], exfat[109] = 62, 1
+	ntfs := makeNTFS("X", 1)
+	binary.LittleEndian.PutUint16(ntfs[11:], 1)
+	ntfsNoCluster := makeNTFS("X", 1)
+	ntfsNoCluster[13] = 0
+	// a resident $VOLUME_NAME of 16 bytes at the very end of the record
+	ntfsShortAttr := makeNTFS("X", 1)
+	rec := ntfsShortAttr[4*4096+3*1024 : 4*4096+4*1024]
+	binary.LittleEndian.PutUint16(rec[20:], 1024-16)
+	binary.LittleEndian.PutUint32(rec[1024-16:], 0x60)
+	binary.LittleEndian.PutUint32(rec[1024-12:], 16)
+	for name, img := range map[string][]byte{
+		"exfat":                  exfat,
+		"ntfs":                   ntfs,
+		"ntfs without clusters":  ntfsNoCluster,
+		"ntfs short volume name": ntfsShortAttr,
+	} {
+		p, err := ProbeFilesystem(bytes.NewReader(img), int64(len(img)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if p.Label != "" {
+			t.Errorf("%s: got label %q", name, p.Label)
+		}
+	}
+}
+
+func TestProbeVolumes(t *testing.T) {
+	img := testGPTImage()
+	copy(img[2048*512:], makeFAT16("EFI", 0x11112222, nil))
+	copy(img[6144*512:], makeExFAT("DATA", 0x33334444))
+	mounted := &VolumeInfo{DevName: "sdb2", Offset: 6144 * 512, Size: 8192 * 512, Mounted: true}
+	mi := &MediaInfo{DevName: "sdb", Volumes: []*VolumeInfo{
+		{DevName: "sdb1", Offset: 2048 * 512, Size: 4096 * 512},
+		mounted,
+	}}
+	if err := ProbeVolumes(bytes.NewReader(img), int64(len(img)), mi); err != nil {
+		t.Fatal(err)
+	}
+	if vi := mi.Volumes[0]; vi.Name != "EFI" || vi.FileSystem != "MS-DOS FAT16" || vi.UUID != "1111-2222" {
+		t.Errorf("sdb1 is %+v", vi)
+	}
+	if mounted.FileSystem != "" {
+		t.Errorf("mounted sdb2 was probed as %q", mounted.FileSystem)
+	}
+}
+
+func TestProbeVolumesUnpartitioned(t *testing.T) {
+	img := makeFAT16("STICK", 0x55556666, nil)
+	mi := &MediaInfo{DevName: "sdc"}
+	if err := ProbeVolumes(bytes.NewReader(img), int64(len(img)), mi); err != nil {
+		t.Fatal(err)
+	}
+	if len(mi.Volumes) != 1 || mi.Volumes[0].DevName != "sdc" || mi.Volumes[0].Name != "STICK" {
+		t.Fatalf("got volumes %+v", mi.Volumes)
+	}
+}
+
+func TestFSProbeEnricher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sdb"), makeNTFS("Windows", 42), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sdb := &MediaInfo{DevName: "sdb"}
+	ui := &USBInfo{Media: []*MediaInfo{sdb}}
+	if err := (FSProbeEnricher{DevDir: dir}).Enrich(context.Background(), []*USBInfo{ui}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sdb.Volumes) != 1 || sdb.Volumes[0].FileSystem != "NTFS" || sdb.Volumes[0].Name != "Windows" {
+		t.Errorf("got volumes %+v", sdb.Volumes)
+	}
+	// a device that is gone is an error, for OptionalEnricher to report
+	ui.Media = append(ui.Media, &MediaInfo{DevName: "sdz"})
+	if err := (FSProbeEnricher{DevDir: dir}).Enrich(context.Background(), []*USBInfo{ui}); err == nil {
+		t.Error("got no error for a missing device")
+	}
+}
@@ -1,3 +1,3 @@
-module main
+module usbinfo
 
 go 1.19
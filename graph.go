@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// graphNode is a node of the topology graph. Its kind picks the shape:
+// "bus", "hub", "device", "storage", "media" or "volume".
+type graphNode struct {
+	id    string
+	kind  string
+	label []string // lines
+}
+
+type graphEdge struct {
+	from, to string
+	label    string
+}
+
+// topologyGraph is the USB topology with the media and volumes of storage
+// devices as a graph. Node IDs are derived from bus order, location IDs and
+// device names, and devices are sorted by location, so that the same
+// topology gives the same graph.
+type topologyGraph struct {
+	nodes []graphNode
+	edges []graphEdge
+}
+
+var graphIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func buildTopologyGraph(buses []*USBBus) *topologyGraph {
+	g := &topologyGraph{}
+	for i, b := range buses {
+		id := fmt.Sprintf("bus%d", i)
+		label := []string{b.Name}
+		if b.HostController != "" {
+			label = append(label, b.HostController)
+		}
+		if b.Source != "" {
+			label = append(label, b.Source)
+		}
+		g.nodes = append(g.nodes, graphNode{id: id, kind: "bus", label: label})
+		g.addDevices(id, b.Devices, 0)
+	}
+	return g
+}
+
+func (g *topologyGraph) addDevices(parent string, devs []*USBDevice, depth int) {
+	devs = append([]*USBDevice(nil), devs...)
+	sort.SliceStable(devs, func(i, j int) bool {
+		return devs[i].LocationID < devs[j].LocationID
+	})
+	for i, d := range devs {
+		id := fmt.Sprintf("%s_%d", parent, i)
+		if d.LocationID != 0 {
+			id = fmt.Sprintf("%s_%08x", parent, d.LocationID)
+		}
+		kind := "device"
+		switch {
+		case d.Storage != nil:
+			kind = "storage"
+		case d.IsHub():
+			kind = "hub"
+		}
+		label := []string{orDash(d.Name), fmt.Sprintf("%04x:%04x", d.VendorID, d.ProductID)}
+		if d.Speed != "" {
+			label = append(label, d.Speed)
+		}
+		g.nodes = append(g.nodes, graphNode{id: id, kind: kind, label: label})
+		port := LocationPort(d.LocationID, depth)
+		if port == 0 {
+			port = d.Port
+		}
+		edge := graphEdge{from: parent, to: id}
+		if port != 0 {
+			edge.label = fmt.Sprintf("port %d", port)
+		}
+		g.edges = append(g.edges, edge)
+		if d.Storage != nil {
+			for _, mi := range d.Storage.Media {
+				mid := id + "_" + graphIDUnsafe.ReplaceAllString(mi.DevName, "_")
+				g.nodes = append(g.nodes, graphNode{id: mid, kind: "media", label: []string{mi.DevName, humanSize(mi.Size)}})
+				g.edges = append(g.edges, graphEdge{from: id, to: mid})
+				for _, vi := range mi.Volumes {
+					vid := id + "_" + graphIDUnsafe.ReplaceAllString(vi.DevName, "_")
+					label := []string{vi.DevName}
+					if vi.Name != "" {
+						label = append(label, vi.Name)
+					}
+					label = append(label, humanSize(vi.Size))
+					if vi.Mounted {
+						label = append(label, vi.MountPoint)
+					}
+					g.nodes = append(g.nodes, graphNode{id: vid, kind: "volume", label: label})
+					g.edges = append(g.edges, graphEdge{from: mid, to: vid})
+				}
+			}
+		}
+		g.addDevices(id, d.Devices, depth+1)
+	}
+}
+
+var dotShapes = map[string]string{
+	"bus":     "box3d",
+	"hub":     "hexagon",
+	"device":  "box",
+	"storage": "box",
+	"media":   "cylinder",
+	"volume":  "folder",
+}
+
+// writeDOT writes the graph in Graphviz DOT.
+func writeDOT(w io.Writer, g *topologyGraph) error {
+	var buf strings.Builder
+	buf.WriteString("digraph usb {\n\trankdir=LR;\n\tnode [fontname=\"Helvetica\"];\n")
+	for _, n := range g.nodes {
+		attrs := fmt.Sprintf("shape=%s, label=%s", dotShapes[n.kind], dotString(strings.Join(n.label, "\n")))
+		switch n.kind {
+		case "device":
+			attrs += ", style=rounded"
+		case "storage":
+			attrs += ", style=\"rounded,filled,bold\", fillcolor=lightblue"
+		}
+		fmt.Fprintf(&buf, "\t%s [%s];\n", n.id, attrs)
+	}
+	for _, e := range g.edges {
+		if e.label != "" {
+			fmt.Fprintf(&buf, "\t%s -> %s [label=%s];\n", e.from, e.to, dotString(e.label))
+		} else {
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", e.from, e.to)
+		}
+	}
+	buf.WriteString("}\n")
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// dotString quotes a DOT string; newlines become centered line breaks.
+func dotString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// mermaidShapes are the brackets around a node's label, by kind.
+var mermaidShapes = map[string][2]string{
+	"bus":     {"[[", "]]"},
+	"hub":     {"{{", "}}"},
+	"device":  {"(", ")"},
+	"storage": {"([", "])"},
+	"media":   {"[(", ")]"},
+	"volume":  {">", "]"},
+}
+
+// writeMermaid writes the graph as a Mermaid flowchart.
+func writeMermaid(w io.Writer, g *topologyGraph) error {
+	var buf strings.Builder
+	buf.WriteString("flowchart LR\n")
+	for _, n := range g.nodes {
+		s := mermaidShapes[n.kind]
+		lines := make([]string, 0, len(n.label))
+		for _, l := range n.label {
+			lines = append(lines, mermaidEscape(l))
+		}
+		fmt.Fprintf(&buf, "    %s%s\"%s\"%s\n", n.id, s[0], strings.Join(lines, "<br>"), s[1])
+	}
+	for _, e := range g.edges {
+		if e.label != "" {
+			fmt.Fprintf(&buf, "    %s -->|\"%s\"| %s\n", e.from, mermaidEscape(e.label), e.to)
+		} else {
+			fmt.Fprintf(&buf, "    %s --> %s\n", e.from, e.to)
+		}
+	}
+	buf.WriteString("    classDef storage font-weight:bold,fill:#add8e6\n")
+	for _, n := range g.nodes {
+		if n.kind == "storage" {
+			fmt.Fprintf(&buf, "    class %s storage\n", n.id)
+		}
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// mermaidEscape escapes what would end a quoted Mermaid label, as entity
+// codes Mermaid understands.
+func mermaidEscape(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "#", "#35;")
+	return r.Replace(s)
+}
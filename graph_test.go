@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	want := `digraph usb {
+	rankdir=LR;
+	node [fontname="Helvetica"];
+	bus0 [shape=box3d, label="USB30Bus\nAppleUSBXHCI"];
+	bus0_01100000 [shape=hexagon, label="USB3.1 Hub\n043e:9a44\nsuper_speed"];
+	bus0_01100000_01110000 [shape=box, label="PenDrive \"Pro\"\n1f75:0917\nhigh_speed", style="rounded,filled,bold", fillcolor=lightblue];
+	bus0_01100000_01110000_disk5 [shape=cylinder, label="disk5\n63.9 GB"];
+	bus0_01100000_01110000_disk5s1 [shape=folder, label="disk5s1\nEFI\n209.7 MB"];
+	bus0_01100000_01110000_disk5s2 [shape=folder, label="disk5s2\nDATA\n63.6 GB\n/Volumes/DATA"];
+	bus0_01100000_01120000 [shape=box, label="Keyboard | K120 <wired>\n046d:c31c\nfull_speed", style=rounded];
+	bus1 [shape=box3d, label="Bus 001\nxhci_hcd\nhost2"];
+	bus0 -> bus0_01100000 [label="port 1"];
+	bus0_01100000 -> bus0_01100000_01110000 [label="port 1"];
+	bus0_01100000_01110000 -> bus0_01100000_01110000_disk5;
+	bus0_01100000_01110000_disk5 -> bus0_01100000_01110000_disk5s1;
+	bus0_01100000_01110000_disk5 -> bus0_01100000_01110000_disk5s2;
+	bus0_01100000 -> bus0_01100000_01120000 [label="port 2"];
+}
+`
+	testGraphOutput(t, writeDOT, want)
+}
+
+func TestWriteMermaid(t *testing.T) {
+	want := `flowchart LR
+    bus0[["USB30Bus<br>AppleUSBXHCI"]]
+    bus0_01100000{{"USB3.1 Hub<br>043e:9a44<br>super_speed"}}
+    bus0_01100000_01110000(["PenDrive #quot;Pro#quot;<br>1f75:0917<br>high_speed"])
+    bus0_01100000_01110000_disk5[("disk5<br>63.9 GB")]
+    bus0_01100000_01110000_disk5s1>"disk5s1<br>EFI<br>209.7 MB"]
+    bus0_01100000_01110000_disk5s2>"disk5s2<br>DATA<br>63.6 GB<br>/Volumes/DATA"]
+    bus0_01100000_01120000("Keyboard | K120 #lt;wired#gt;<br>046d:c31c<br>full_speed")
+    bus1[["Bus 001<br>xhci_hcd<br>host2"]]
+    bus0 -->|"port 1"| bus0_01100000
+    bus0_01100000 -->|"port 1"| bus0_01100000_01110000
+    bus0_01100000_01110000 --> bus0_01100000_01110000_disk5
+    bus0_01100000_01110000_disk5 --> bus0_01100000_01110000_disk5s1
+    bus0_01100000_01110000_disk5 --> bus0_01100000_01110000_disk5s2
+    bus0_01100000 -->|"port 2"| bus0_01100000_01120000
+    classDef storage font-weight:bold,fill:#add8e6
+    class bus0_01100000_01110000 storage
+`
+	testGraphOutput(t, writeMermaid, want)
+}
+
+// testGraphOutput checks a graph writer against its golden output, also
+// with the devices of the hub listed the other way round, which must not
+// change the graph.
+func testGraphOutput(t *testing.T, write func(w io.Writer, g *topologyGraph) error, want string) {
+	t.Helper()
+	buses := testTopology()
+	reversed := testTopology()
+	hub := reversed[0].Devices[0]
+	hub.Devices[0], hub.Devices[1] = hub.Devices[1], hub.Devices[0]
+	for _, bs := range [][]*USBBus{buses, buses, reversed} {
+		var buf bytes.Buffer
+		if err := write(&buf, buildTopologyGraph(bs)); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+		}
+	}
+}
+
+func TestGraphEscapes(t *testing.T) {
+	for in, want := range map[string]string{
+		`plain`:           `"plain"`,
+		`a "b"`:           `"a \"b\""`,
+		`C:\path`:         `"C:\\path"`,
+		"two\nlines":      `"two\nlines"`,
+		`\"` + "\n" + `x`: `"\\\"\nx"`,
+	} {
+		if got := dotString(in); got != want {
+			t.Errorf("dotString(%q) = %s, want %s", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{
+		`plain`:        `plain`,
+		`a "b"`:        `a #quot;b#quot;`,
+		`<br>`:         `#lt;br#gt;`,
+		`#1 & <2>`:     `#35;1 & #lt;2#gt;`,
+		`already #lt;`: `already #35;lt;`,
+	} {
+		if got := mermaidEscape(in); got != want {
+			t.Errorf("mermaidEscape(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
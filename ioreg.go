@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ioreg -a -r -c IOUSBHostDevice -l
+
+// IORegDevice is a USB device as found in the I/O registry.
+type IORegDevice struct {
+	RegistryID   uint64
+	Name         string
+	LocationID   uint32
+	VendorID     uint16
+	ProductID    uint16
+	SerialNumber string
+	Manufacturer string
+	Product      string
+	PortNum      int
+	Address      int
+	Speed        int // IOKit speed code: 0 low, 1 full, 2 high, 3 super, 4 super+
+	Class        uint8
+	SubClass     uint8
+	Protocol     uint8
+	Interfaces   []*InterfaceInfo
+}
+
+func (d IORegDevice) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sI/O Registry Device %q:\n", prefix, d.Name)
+	fmt.Fprintf(&buf, "%s  Registry ID: %#x\n", prefix, d.RegistryID)
+	fmt.Fprintf(&buf, "%s  Location ID: %#08x\n", prefix, d.LocationID)
+	fmt.Fprintf(&buf, "%s  Product ID: %#04x\n", prefix, d.ProductID)
+	fmt.Fprintf(&buf, "%s  Vendor ID: %#04x\n", prefix, d.VendorID)
+	fmt.Fprintf(&buf, "%s  Port: %d\n", prefix, d.PortNum)
+	fmt.Fprintf(&buf, "%s  Device Class: %#02x/%#02x/%#02x (%s)\n",
+		prefix, d.Class, d.SubClass, d.Protocol, USBClassName(d.Class))
+	for _, i := range d.Interfaces {
+		fmt.Fprintf(&buf, "%s", i.ToString(prefix+indent))
+	}
+	return buf.String()
+}
+
+func (d IORegDevice) String() string {
+	return d.ToString("")
+}
+
+// DecodeIOReg decodes the plist output of `ioreg -a -r -c IOUSBHostDevice -l`.
+func DecodeIOReg(r io.Reader) ([]*IORegDevice, error) {
+	data, err := DecodePlist(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ioreg plist: %w", err)
+	}
+	return FindIORegDevices(data)
+}
+
+// FindIORegDevices walks a decoded ioreg plist and returns all USB devices in
+// it, at any nesting level (devices behind hubs are registry children of the
+// hub).
+func FindIORegDevices(data any) ([]*IORegDevice, error) {
+	devs := make([]*IORegDevice, 0)
+	switch d := data.(type) {
+	case []any:
+		for i, e := range d {
+			if err := findIORegDevices(e, fmt.Sprintf("ioreg[%d]", i), &devs); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		if err := findIORegDevices(d, "ioreg", &devs); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ioreg (%T) is neither []interface{} nor map[string]interface{} type", data)
+	}
+	return devs, nil
+}
+
+func findIORegDevices(entry any, path string, devs *[]*IORegDevice) error {
+	eMap, ok := entry.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s (%T) is not map[string]interface{} type", path, entry)
+	}
+	if isIORegDevice(eMap) {
+		dev, err := newIORegDevice(eMap, path)
+		if err != nil {
+			return err
+		}
+		*devs = append(*devs, dev)
+	}
+	children, ok := eMap["IORegistryEntryChildren"]
+	if !ok {
+		return nil
+	}
+	ca, ok := children.([]any)
+	if !ok {
+		return fmt.Errorf("%s[IORegistryEntryChildren] (%T) is not []interface{} type", path, children)
+	}
+	for i, c := range ca {
+		if err := findIORegDevices(c, fmt.Sprintf("%s[IORegistryEntryChildren][%d]", path, i), devs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isIORegDevice(eMap map[string]any) bool {
+	switch eMap["IOObjectClass"] {
+	case "IOUSBHostDevice", "AppleUSBDevice":
+		return true
+	}
+	_, hasLoc := eMap["locationID"]
+	_, hasClass := eMap["bDeviceClass"]
+	return hasLoc && hasClass
+}
+
+func isIORegInterface(eMap map[string]any) bool {
+	if eMap["IOObjectClass"] == "IOUSBHostInterface" {
+		return true
+	}
+	_, ok := eMap["bInterfaceNumber"]
+	return ok
+}
+
+func newIORegDevice(eMap map[string]any, path string) (*IORegDevice, error) {
+	dev := &IORegDevice{}
+	loc, ok := plistUint(eMap["locationID"])
+	if !ok {
+		return nil, fmt.Errorf("%s[locationID] (%T) is not an integer", path, eMap["locationID"])
+	}
+	dev.LocationID = uint32(loc)
+	if v, ok := plistUint(eMap["IORegistryEntryID"]); ok {
+		dev.RegistryID = v
+	}
+	if v, ok := plistUint(eMap["idVendor"]); ok {
+		dev.VendorID = uint16(v)
+	}
+	if v, ok := plistUint(eMap["idProduct"]); ok {
+		dev.ProductID = uint16(v)
+	}
+	if v, ok := plistUint(eMap["bDeviceClass"]); ok {
+		dev.Class = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bDeviceSubClass"]); ok {
+		dev.SubClass = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bDeviceProtocol"]); ok {
+		dev.Protocol = uint8(v)
+	}
+	if v, ok := plistUint(eMap["PortNum"]); ok {
+		dev.PortNum = int(v)
+	}
+	if v, ok := plistUint(eMap["USB Address"]); ok {
+		dev.Address = int(v)
+	}
+	if v, ok := plistUint(eMap["Device Speed"]); ok {
+		dev.Speed = int(v)
+	}
+	dev.Name = firstString(eMap, "IORegistryEntryName", "USB Product Name", "kUSBProductString")
+	dev.Product = firstString(eMap, "USB Product Name", "kUSBProductString")
+	dev.Manufacturer = firstString(eMap, "USB Vendor Name", "kUSBVendorString")
+	dev.SerialNumber = firstString(eMap, "USB Serial Number", "kUSBSerialNumberString")
+
+	// interfaces hang below the device, possibly behind driver nubs, but stop
+	// at nested devices since those belong to a downstream hub port
+	var walk func(entry map[string]any, path string) error
+	walk = func(entry map[string]any, path string) error {
+		children, ok := entry["IORegistryEntryChildren"].([]any)
+		if !ok {
+			return nil
+		}
+		for i, c := range children {
+			cPath := fmt.Sprintf("%s[IORegistryEntryChildren][%d]", path, i)
+			cMap, ok := c.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s (%T) is not map[string]interface{} type", cPath, c)
+			}
+			if isIORegDevice(cMap) {
+				continue
+			}
+			if isIORegInterface(cMap) {
+				dev.Interfaces = append(dev.Interfaces, newIORegInterface(cMap))
+			}
+			if err := walk(cMap, cPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(eMap, path); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+func newIORegInterface(eMap map[string]any) *InterfaceInfo {
+	ii := &InterfaceInfo{
+		Name: firstString(eMap, "kUSBString", "USB Interface Name"),
+	}
+	if v, ok := plistUint(eMap["bInterfaceNumber"]); ok {
+		ii.Number = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bAlternateSetting"]); ok {
+		ii.AlternateSetting = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bInterfaceClass"]); ok {
+		ii.Class = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bInterfaceSubClass"]); ok {
+		ii.SubClass = uint8(v)
+	}
+	if v, ok := plistUint(eMap["bInterfaceProtocol"]); ok {
+		ii.Protocol = uint8(v)
+	}
+	return ii
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// MergeIOReg joins I/O registry devices into the USB storage infos by location
+// ID and fills in the registry ID, port, class codes and interfaces. It
+// returns the number of USB infos that got matched.
+func MergeIOReg(uis []*USBInfo, devs []*IORegDevice) int {
+	byLoc := make(map[uint32]*IORegDevice, len(devs))
+	for _, d := range devs {
+		byLoc[d.LocationID] = d
+	}
+	n := 0
+	for _, ui := range uis {
+		d, ok := byLoc[ui.LocationID]
+		if !ok || ui.LocationID == 0 {
+			continue
+		}
+		ui.RegistryID = d.RegistryID
+		ui.PortNum = d.PortNum
+		ui.Class = d.Class
+		ui.SubClass = d.SubClass
+		ui.Protocol = d.Protocol
+		ui.Interfaces = d.Interfaces
+		n++
+	}
+	return n
+}
+
+// IORegEnricher fills in what system_profiler leaves out (registry ID, port,
+// class codes and interfaces) from the I/O registry.
+type IORegEnricher struct {
+	Runner CommandRunner // nil means ExecRunner
+}
+
+// Enrich runs ioreg and merges its USB devices into uis.
+func (e IORegEnricher) Enrich(ctx context.Context, uis []*USBInfo) error {
+	runner := e.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	out, err := runner.Run(ctx, "ioreg", "-a", "-r", "-c", "IOUSBHostDevice", "-l")
+	if err != nil {
+		return fmt.Errorf("failed to run ioreg: %w", err)
+	}
+	devs, err := DecodeIOReg(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+	MergeIOReg(uis, devs)
+	return nil
+}
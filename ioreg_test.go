@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testIOReg is an excerpt of `ioreg -a -r -c IOUSBHostDevice -l`: a hub
+// with a stick behind it, the stick's interface behind a driver nub.
+const testIOReg = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<array>
+	<dict>
+		<key>IOObjectClass</key>
+		<string>IOUSBHostDevice</string>
+		<key>IORegistryEntryName</key>
+		<string>USB2.0 Hub</string>
+		<key>IORegistryEntryID</key>
+		<integer>4294969000</integer>
+		<key>locationID</key>
+		<integer>1074790400</integer>
+		<key>idVendor</key>
+		<integer>1507</integer>
+		<key>idProduct</key>
+		<integer>1544</integer>
+		<key>bDeviceClass</key>
+		<integer>9</integer>
+		<key>IORegistryEntryChildren</key>
+		<array>
+			<dict>
+				<key>IOObjectClass</key>
+				<string>IOUSBHostDevice</string>
+				<key>IORegistryEntryName</key>
+				<string>PenDrive</string>
+				<key>IORegistryEntryID</key>
+				<integer>4294969123</integer>
+				<key>locationID</key>
+				<integer>1074855936</integer>
+				<key>idVendor</key>
+				<integer>8053</integer>
+				<key>idProduct</key>
+				<integer>2327</integer>
+				<key>bDeviceClass</key>
+				<integer>0</integer>
+				<key>PortNum</key>
+				<integer>01</integer>
+				<key>USB Serial Number</key>
+				<string>000000000000004010</string>
+				<key>kUSBVendorString</key>
+				<string>Innostor</string>
+				<key>Device Speed</key>
+				<integer>2</integer>
+				<key>IORegistryEntryChildren</key>
+				<array>
+					<dict>
+						<key>IOObjectClass</key>
+						<string>AppleUSBHostCompositeDevice</string>
+						<key>IORegistryEntryChildren</key>
+						<array>
+							<dict>
+								<key>IOObjectClass</key>
+								<string>IOUSBHostInterface</string>
+								<key>bInterfaceNumber</key>
+								<integer>0</integer>
+								<key>bInterfaceClass</key>
+								<integer>8</integer>
+								<key>bInterfaceSubClass</key>
+								<integer>6</integer>
+								<key>bInterfaceProtocol</key>
+								<integer>80</integer>
+								<key>kUSBString</key>
+								<string>Mass Storage</string>
+							</dict>
+						</array>
+					</dict>
+				</array>
+			</dict>
+		</array>
+	</dict>
+</array>
+</plist>`
+
+func TestDecodeIOReg(t *testing.T) {
+	devs, err := DecodeIOReg(strings.NewReader(testIOReg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 {
+		t.Fatalf("got %d devices, want the hub and the stick", len(devs))
+	}
+	d := devs[1]
+	if d.Name != "PenDrive" || d.LocationID != 0x40110000 || d.VendorID != 0x1f75 || d.ProductID != 0x0917 {
+		t.Errorf("got %q %04x:%04x at %#08x", d.Name, d.VendorID, d.ProductID, d.LocationID)
+	}
+	if d.RegistryID != 4294969123 || d.PortNum != 1 || d.Speed != 2 || d.SerialNumber != "000000000000004010" || d.Manufacturer != "Innostor" {
+		t.Errorf("got %+v", *d)
+	}
+	// the stick's interface, not the hub's
+	if len(devs[0].Interfaces) != 0 || len(d.Interfaces) != 1 {
+		t.Fatalf("got %d and %d interfaces", len(devs[0].Interfaces), len(d.Interfaces))
+	}
+	if i := d.Interfaces[0]; i.Class != 8 || i.SubClass != 6 || i.Protocol != 80 || i.Name != "Mass Storage" {
+		t.Errorf("got interface %+v", *i)
+	}
+}
+
+func TestMergeIOReg(t *testing.T) {
+	devs, err := DecodeIOReg(strings.NewReader(testIOReg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stick := &USBInfo{Name: "PenDrive", LocationID: 0x40110000}
+	other := &USBInfo{Name: "Other", LocationID: 0x40120000}
+	unknown := &USBInfo{Name: "Unknown"} // no location ID matches nothing
+	if n := MergeIOReg([]*USBInfo{stick, other, unknown}, devs); n != 1 {
+		t.Errorf("matched %d devices, want 1", n)
+	}
+	if stick.RegistryID != 4294969123 || stick.PortNum != 1 || len(stick.Interfaces) != 1 {
+		t.Errorf("stick is %+v", *stick)
+	}
+	if other.RegistryID != 0 || unknown.RegistryID != 0 {
+		t.Error("devices at other locations were merged")
+	}
+}
+
+func TestIORegEnricher(t *testing.T) {
+	runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "ioreg" {
+			t.Errorf("ran %s", name)
+		}
+		return []byte(testIOReg), nil
+	})
+	stick := &USBInfo{LocationID: 0x40110000}
+	if err := (IORegEnricher{Runner: runner}).Enrich(context.Background(), []*USBInfo{stick}); err != nil {
+		t.Fatal(err)
+	}
+	if stick.RegistryID == 0 {
+		t.Error("the stick was not merged")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf16"
+)
+
+// isoFS is a minimal read-only ISO 9660 reader. It prefers the Joliet
+// directory tree, which keeps names such as ".treeinfo" intact, over the
+// primary one with its 8.3-style names.
+type isoFS struct {
+	r       io.ReaderAt
+	root    isoDirEntry
+	joliet  bool
+	catalog uint32 // El Torito boot catalog sector, or 0
+}
+
+type isoDirEntry struct {
+	name   string
+	extent uint32
+	size   uint32
+	dir    bool
+}
+
+// openISO9660 reads the volume descriptors of an ISO 9660 file system.
+func openISO9660(r io.ReaderAt) (*isoFS, error) {
+	f := &isoFS{r: r}
+	primary := false
+	for sector := int64(16); sector < 64; sector++ {
+		vd, err := readAt(r, sector*2048, 2048)
+		if err != nil {
+			return nil, err
+		}
+		if len(vd) < 2048 || !bytes.Equal(vd[1:6], []byte("CD001")) {
+			return nil, fmt.Errorf("no ISO 9660 volume descriptor at sector %d", sector)
+		}
+		switch vd[0] {
+		case 0x00:
+			if bytes.Equal(vd[7:30], []byte("EL TORITO SPECIFICATION")) {
+				f.catalog = binary.LittleEndian.Uint32(vd[71:])
+			}
+		case 0x01:
+			if !f.joliet {
+				f.root = isoRecord(vd[156:190], false)
+			}
+			primary = true
+		case 0x02:
+			// Joliet is a supplementary descriptor with a UCS-2 escape
+			// sequence
+			if esc := string(vd[88:91]); esc == "%/@" || esc == "%/C" || esc == "%/E" {
+				f.root = isoRecord(vd[156:190], true)
+				f.joliet = true
+			}
+		case 0xff:
+			if !primary {
+				return nil, fmt.Errorf("no primary volume descriptor")
+			}
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("no volume descriptor set terminator")
+}
+
+// isoRecord decodes a directory record.
+func isoRecord(b []byte, joliet bool) isoDirEntry {
+	n := int(b[32])
+	if 33+n > len(b) {
+		n = len(b) - 33
+	}
+	raw := b[33 : 33+n]
+	var name string
+	switch {
+	case n == 1 && raw[0] == 0:
+		name = "."
+	case n == 1 && raw[0] == 1:
+		name = ".."
+	case joliet:
+		u := make([]uint16, n/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(raw[2*i:])
+		}
+		name = string(utf16.Decode(u))
+	default:
+		name = string(raw)
+	}
+	// strip the version and the dot of names without an extension
+	if i := strings.LastIndexByte(name, ';'); i > 0 {
+		name = name[:i]
+	}
+	if len(name) > 1 && name != ".." {
+		name = strings.TrimSuffix(name, ".")
+	}
+	return isoDirEntry{
+		name:   name,
+		extent: binary.LittleEndian.Uint32(b[2:]),
+		size:   binary.LittleEndian.Uint32(b[10:]),
+		dir:    b[25]&0x02 != 0,
+	}
+}
+
+// readDir returns the entries of a directory, without "." and "..".
+func (f *isoFS) readDir(d isoDirEntry) ([]isoDirEntry, error) {
+	if d.size > 1<<22 {
+		return nil, fmt.Errorf("directory %q too large: %d bytes", d.name, d.size)
+	}
+	b := make([]byte, d.size)
+	if _, err := f.r.ReadAt(b, int64(d.extent)*2048); err != nil {
+		return nil, fmt.Errorf("failed to read directory %q: %w", d.name, err)
+	}
+	entries := make([]isoDirEntry, 0)
+	for off := 0; off < len(b); {
+		l := int(b[off])
+		if l == 0 {
+			// records do not cross sectors; the rest is padding
+			off = (off/2048 + 1) * 2048
+			continue
+		}
+		if l < 34 || off+l > len(b) {
+			return nil, fmt.Errorf("corrupt directory record in %q at offset %d", d.name, off)
+		}
+		e := isoRecord(b[off:off+l], f.joliet)
+		if e.name != "." && e.name != ".." {
+			entries = append(entries, e)
+		}
+		off += l
+	}
+	return entries, nil
+}
+
+// lookup finds a file or directory by slash-separated path, ignoring case
+// as the primary tree only has upper case names.
+func (f *isoFS) lookup(name string) (*isoDirEntry, error) {
+	cur := f.root
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/") {
+		if !cur.dir {
+			return nil, fmt.Errorf("%s: not a directory", cur.name)
+		}
+		entries, err := f.readDir(cur)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, e := range entries {
+			if strings.EqualFold(e.name, part) {
+				cur, found = e, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+		}
+	}
+	return &cur, nil
+}
+
+func (f *isoFS) stat(name string) (int64, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return int64(e.size), nil
+}
+
+func (f *isoFS) readFile(name string, limit int64) ([]byte, error) {
+	e, err := f.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if e.dir {
+		return nil, fmt.Errorf("%s: is a directory", name)
+	}
+	if int64(e.size) < limit {
+		limit = int64(e.size)
+	}
+	b := make([]byte, limit)
+	if _, err := f.r.ReadAt(b, int64(e.extent)*2048); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// bootPlatforms lists the platforms of the El Torito boot catalog's
+// bootable entries, e.g. "x86" and "EFI".
+func (f *isoFS) bootPlatforms() ([]string, error) {
+	if f.catalog == 0 {
+		return nil, nil
+	}
+	b, err := readAt(f.r, int64(f.catalog)*2048, 2048)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 64 || b[0] != 0x01 || b[30] != 0x55 || b[31] != 0xaa {
+		return nil, fmt.Errorf("invalid El Torito validation entry")
+	}
+	platforms := make([]string, 0)
+	add := func(id byte) {
+		name := elToritoPlatforms[id]
+		if name == "" {
+			name = fmt.Sprintf("%#02x", id)
+		}
+		if !containsString(platforms, name) {
+			platforms = append(platforms, name)
+		}
+	}
+	if b[32] == 0x88 { // initial/default entry, for the validation platform
+		add(b[1])
+	}
+	for off := 64; off+32 <= len(b); {
+		h := b[off]
+		if h != 0x90 && h != 0x91 {
+			break
+		}
+		id := b[off+1]
+		n := int(binary.LittleEndian.Uint16(b[off+2:]))
+		off += 32
+		for i := 0; i < n && off+32 <= len(b); i++ {
+			if b[off] == 0x88 {
+				add(id)
+			}
+			off += 32
+		}
+		if h == 0x91 { // final section header
+			break
+		}
+	}
+	return platforms, nil
+}
+
+var elToritoPlatforms = map[byte]string{
+	0x00: "x86",
+	0x01: "PowerPC",
+	0x02: "Mac",
+	0xef: "EFI",
+}
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON document, see Document. It is
+// bumped whenever a field is renamed or removed or changes its meaning;
+// adding fields does not bump it.
+const SchemaVersion = 1
+
+// Document is the stable JSON encoding of the USB storage devices found.
+// Unlike the model types its field names are part of the interface, IDs
+// carry both their hex and integer forms and sizes both their byte count
+// and a humanized form. Fields derived from others (class names, endpoint
+// directions, whether media is bootable) are written for convenience and
+// ignored when a document is read back.
+type Document struct {
+	SchemaVersion int          `json:"schema_version"`
+	Devices       []JSONDevice `json:"devices"`
+	Buses         []JSONBus    `json:"buses,omitempty"` // only if the topology was asked for
+}
+
+// HexID is a numeric ID such as a vendor ID, written as
+// {"hex": "0x1f75", "value": 8053}. When reading either may be left out,
+// and a bare string or number is accepted too.
+type HexID struct {
+	Hex   string `json:"hex"`
+	Value uint64 `json:"value"`
+}
+
+func hexID(v uint64, digits int) HexID {
+	return HexID{Hex: fmt.Sprintf("0x%0*x", digits, v), Value: v}
+}
+
+func (h *HexID) UnmarshalJSON(b []byte) error {
+	var obj struct {
+		Hex   *string `json:"hex"`
+		Value *uint64 `json:"value"`
+	}
+	switch b = bytes.TrimSpace(b); {
+	case len(b) > 0 && b[0] == '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		obj.Hex = &s
+	case len(b) > 0 && b[0] == '{':
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return err
+		}
+	default:
+		var v uint64
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		obj.Value = &v
+	}
+	*h = HexID{}
+	if obj.Hex != nil {
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(*obj.Hex), "0x"), 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid hex ID %q", *obj.Hex)
+		}
+		if obj.Value != nil && *obj.Value != v {
+			return fmt.Errorf("hex ID %s does not match value %d", *obj.Hex, *obj.Value)
+		}
+		h.Hex, h.Value = *obj.Hex, v
+	}
+	if obj.Value != nil {
+		h.Value = *obj.Value
+	}
+	return nil
+}
+
+// Size is a size in bytes, written as {"bytes": 62008590336, "human": "62.0 GB"}.
+// When reading only the byte count matters.
+type Size struct {
+	Bytes int64  `json:"bytes"`
+	Human string `json:"human"`
+}
+
+func sizeOf(n int64) Size {
+	return Size{Bytes: n, Human: humanSize(n)}
+}
+
+type JSONDevice struct {
+	Name         string           `json:"name"`
+	VendorID     HexID            `json:"vendor_id"`
+	ProductID    HexID            `json:"product_id"`
+	SerialNumber string           `json:"serial_number"`
+	Manufacturer string           `json:"manufacturer"`
+	LocationID   HexID            `json:"location_id"`
+	Speed        string           `json:"speed"`
+	RegistryID   HexID            `json:"registry_id"`
+	Port         int              `json:"port"`
+	Class        HexID            `json:"class"`
+	ClassName    string           `json:"class_name"`
+	SubClass     HexID            `json:"sub_class"`
+	Protocol     HexID            `json:"protocol"`
+	Driver       string           `json:"driver"`
+	Interfaces   []JSONInterface  `json:"interfaces"`
+	Descriptors  *JSONDescriptors `json:"descriptors,omitempty"`
+	Media        []JSONMedia      `json:"media"`
+	Warnings     []string         `json:"warnings"`
+	Source       string           `json:"source"`
+}
+
+type JSONMedia struct {
+	Name         string       `json:"name"`
+	Device       string       `json:"device"`
+	PartitionMap string       `json:"partition_map"`
+	Size         Size         `json:"size"`
+	DiskID       string       `json:"disk_id"`
+	Links        []string     `json:"links"`
+	Volumes      []JSONVolume `json:"volumes"`
+	Boot         *JSONBoot    `json:"boot,omitempty"`
+}
+
+type JSONVolume struct {
+	Name         string         `json:"name"`
+	Device       string         `json:"device"`
+	Size         Size           `json:"size"`
+	FileSystem   string         `json:"file_system"`
+	UUID         string         `json:"uuid"`
+	Content      string         `json:"content"`
+	Mounted      bool           `json:"mounted"`
+	MountPoint   string         `json:"mount_point"`
+	Free         Size           `json:"free"`
+	Writable     bool           `json:"writable"`
+	MountOptions []string       `json:"mount_options"`
+	DevNum       string         `json:"dev_num"`
+	Partition    *JSONPartition `json:"partition,omitempty"`
+}
+
+// JSONPartition is only present for volumes found in a partition table.
+type JSONPartition struct {
+	Number     int    `json:"number"`
+	Offset     int64  `json:"offset"`
+	Type       string `json:"type"`
+	UUID       string `json:"uuid"`
+	Label      string `json:"label"`
+	Attributes HexID  `json:"attributes"`
+}
+
+type JSONInterface struct {
+	Number           int            `json:"number"`
+	AlternateSetting int            `json:"alternate_setting"`
+	Class            HexID          `json:"class"`
+	ClassName        string         `json:"class_name"`
+	SubClass         HexID          `json:"sub_class"`
+	Protocol         HexID          `json:"protocol"`
+	Name             string         `json:"name"`
+	Driver           string         `json:"driver"`
+	Endpoints        []JSONEndpoint `json:"endpoints"`
+}
+
+type JSONEndpoint struct {
+	Address       HexID  `json:"address"`
+	Direction     string `json:"direction"`
+	Attributes    HexID  `json:"attributes"`
+	MaxPacketSize int    `json:"max_packet_size"`
+	Interval      int    `json:"interval"`
+}
+
+type JSONDescriptors struct {
+	Device    JSONDeviceDescriptor `json:"device"`
+	Configs   []JSONConfig         `json:"configs"`
+	BOS       []JSONCapability     `json:"bos,omitempty"` // nil without a BOS descriptor
+	Languages []HexID              `json:"languages"`
+	Strings   map[uint8]string     `json:"strings"`
+	MaxSpeed  string               `json:"max_speed"`
+}
+
+type JSONDeviceDescriptor struct {
+	USBVersion        HexID `json:"usb_version"`
+	Class             HexID `json:"class"`
+	SubClass          HexID `json:"sub_class"`
+	Protocol          HexID `json:"protocol"`
+	MaxPacketSize0    int   `json:"max_packet_size0"`
+	VendorID          HexID `json:"vendor_id"`
+	ProductID         HexID `json:"product_id"`
+	DeviceVersion     HexID `json:"device_version"`
+	ManufacturerIndex int   `json:"manufacturer_index"`
+	ProductIndex      int   `json:"product_index"`
+	SerialNumberIndex int   `json:"serial_number_index"`
+	NumConfigs        int   `json:"num_configs"`
+}
+
+type JSONConfig struct {
+	Value      int             `json:"value"`
+	Name       string          `json:"name"`
+	Attributes HexID           `json:"attributes"`
+	MaxPower   int             `json:"max_power_ma"`
+	Interfaces []JSONInterface `json:"interfaces"`
+}
+
+type JSONCapability struct {
+	Type            HexID   `json:"type"`
+	Data            string  `json:"data"` // hex encoded
+	LPM             bool    `json:"lpm"`
+	SpeedsSupported HexID   `json:"speeds_supported"`
+	SublinkSpeeds   []HexID `json:"sublink_speeds"`
+	ContainerID     string  `json:"container_id"`
+}
+
+type JSONBoot struct {
+	Bootable        bool     `json:"bootable"`
+	ISO9660         bool     `json:"iso9660"`
+	ISOHybrid       bool     `json:"iso_hybrid"`
+	ElTorito        []string `json:"el_torito"`
+	EFILoaders      []string `json:"efi_loaders"`
+	MBRBootCode     bool     `json:"mbr_boot_code"`
+	ActivePartition int      `json:"active_partition"`
+	BIOSBootPart    bool     `json:"bios_boot_partition"`
+	OS              *JSONOS  `json:"os,omitempty"`
+}
+
+type JSONOS struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch"`
+	Source  string `json:"source"`
+}
+
+type JSONBus struct {
+	Name           string          `json:"name"`
+	Number         int             `json:"number"`
+	HostController string          `json:"host_controller"`
+	Speed          string          `json:"speed"`
+	Devices        []JSONUSBDevice `json:"devices"`
+	Source         string          `json:"source"`
+}
+
+// JSONUSBDevice is a node of the USB topology. Storage devices refer to
+// their entry in the document's devices by its key, see USBKey.
+type JSONUSBDevice struct {
+	Name          string          `json:"name"`
+	Manufacturer  string          `json:"manufacturer"`
+	SerialNumber  string          `json:"serial_number"`
+	VendorID      HexID           `json:"vendor_id"`
+	ProductID     HexID           `json:"product_id"`
+	LocationID    HexID           `json:"location_id"`
+	Address       int             `json:"address"`
+	Port          int             `json:"port"`
+	Speed         string          `json:"speed"`
+	USBVersion    string          `json:"usb_version"`
+	DeviceVersion string          `json:"device_version"`
+	BusPower      int             `json:"bus_power_ma"`
+	BusPowerUsed  int             `json:"bus_power_used_ma"`
+	Class         HexID           `json:"class"`
+	ClassName     string          `json:"class_name"`
+	SubClass      HexID           `json:"sub_class"`
+	Protocol      HexID           `json:"protocol"`
+	Configs       []JSONConfig    `json:"configs"`
+	Interfaces    []JSONInterface `json:"interfaces"`
+	Devices       []JSONUSBDevice `json:"devices"`
+	Storage       string          `json:"storage,omitempty"`
+	Warnings      []string        `json:"warnings,omitempty"`
+}
+
+// NewDocument encodes the model into a Document; buses may be nil.
+func NewDocument(uis []*USBInfo, buses []*USBBus) Document {
+	doc := Document{SchemaVersion: SchemaVersion, Devices: make([]JSONDevice, 0, len(uis))}
+	for _, ui := range uis {
+		doc.Devices = append(doc.Devices, jsonDevice(ui))
+	}
+	for _, b := range buses {
+		doc.Buses = append(doc.Buses, JSONBus{
+			Name:           b.Name,
+			Number:         b.Number,
+			HostController: b.HostController,
+			Speed:          b.Speed,
+			Devices:        jsonUSBDevices(b.Devices),
+			Source:         b.Source,
+		})
+	}
+	return doc
+}
+
+// Encode writes the document indented.
+func (doc Document) Encode(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(doc)
+}
+
+// DecodeDocument validates a Document against DocumentSchema and decodes it.
+func DecodeDocument(b []byte) (Document, error) {
+	var doc Document
+	if err := ValidateDocument(b); err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return doc, fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+	return doc, nil
+}
+
+// isDocumentJSON tells a Document from the tools' JSON output.
+func isDocumentJSON(b []byte) bool {
+	var probe struct {
+		SchemaVersion json.RawMessage `json:"schema_version"`
+	}
+	return json.Unmarshal(b, &probe) == nil && probe.SchemaVersion != nil
+}
+
+// Model decodes the document into the model, with the storage devices of
+// the topology pointing at the USBInfos returned. Documents of a newer
+// schema version than this program's are rejected.
+func (doc Document) Model() ([]*USBInfo, []*USBBus, error) {
+	if doc.SchemaVersion < 1 || doc.SchemaVersion > SchemaVersion {
+		return nil, nil, fmt.Errorf("unsupported schema version %d", doc.SchemaVersion)
+	}
+	var dec docDecoder
+	uis := make([]*USBInfo, 0, len(doc.Devices))
+	dec.storage = make(map[string]*USBInfo, len(doc.Devices))
+	for i, d := range doc.Devices {
+		ui := dec.device(d, fmt.Sprintf("$.devices[%d]", i))
+		uis = append(uis, ui)
+		dec.storage[USBKey(ui)] = ui
+	}
+	buses := make([]*USBBus, 0, len(doc.Buses))
+	for i, b := range doc.Buses {
+		p := fmt.Sprintf("$.buses[%d]", i)
+		buses = append(buses, &USBBus{
+			Name:           b.Name,
+			Number:         b.Number,
+			HostController: b.HostController,
+			Speed:          b.Speed,
+			Devices:        dec.usbDevices(b.Devices, p+".devices"),
+			Source:         b.Source,
+		})
+	}
+	if dec.err != nil {
+		return nil, nil, dec.err
+	}
+	return uis, buses, nil
+}
+
+func jsonDevice(ui *USBInfo) JSONDevice {
+	d := JSONDevice{
+		Name:         ui.Name,
+		VendorID:     hexID(uint64(ui.VendorID), 4),
+		ProductID:    hexID(uint64(ui.ProductID), 4),
+		SerialNumber: ui.SerialNumber,
+		Manufacturer: ui.Manufacturer,
+		LocationID:   hexID(uint64(ui.LocationID), 8),
+		Speed:        ui.Speed,
+		RegistryID:   hexID(ui.RegistryID, 1),
+		Port:         ui.PortNum,
+		Class:        hexID(uint64(ui.Class), 2),
+		ClassName:    USBClassName(ui.Class),
+		SubClass:     hexID(uint64(ui.SubClass), 2),
+		Protocol:     hexID(uint64(ui.Protocol), 2),
+		Driver:       ui.Driver,
+		Interfaces:   jsonInterfaces(ui.Interfaces),
+		Media:        make([]JSONMedia, 0, len(ui.Media)),
+		Warnings:     nonNil(ui.Warnings),
+		Source:       ui.Source,
+	}
+	if ui.Descriptors != nil {
+		d.Descriptors = jsonDescriptors(ui.Descriptors)
+	}
+	for _, mi := range ui.Media {
+		d.Media = append(d.Media, jsonMedia(mi))
+	}
+	return d
+}
+
+func jsonMedia(mi *MediaInfo) JSONMedia {
+	m := JSONMedia{
+		Name:         mi.Name,
+		Device:       mi.DevName,
+		PartitionMap: mi.PartitionName,
+		Size:         sizeOf(mi.Size),
+		DiskID:       mi.DiskID,
+		Links:        nonNil(mi.Links),
+		Volumes:      make([]JSONVolume, 0, len(mi.Volumes)),
+	}
+	for _, vi := range mi.Volumes {
+		m.Volumes = append(m.Volumes, jsonVolume(vi))
+	}
+	if b := mi.Boot; b != nil {
+		m.Boot = &JSONBoot{
+			Bootable:        b.Bootable(),
+			ISO9660:         b.ISO9660,
+			ISOHybrid:       b.ISOHybrid,
+			ElTorito:        nonNil(b.ElTorito),
+			EFILoaders:      nonNil(b.EFILoaders),
+			MBRBootCode:     b.MBRBootCode,
+			ActivePartition: b.ActivePartition,
+			BIOSBootPart:    b.BIOSBootPart,
+		}
+		if oi := b.OS; oi != nil {
+			m.Boot.OS = &JSONOS{Name: oi.Name, Version: oi.Version, Arch: oi.Arch, Source: oi.Source}
+		}
+	}
+	return m
+}
+
+func jsonVolume(vi *VolumeInfo) JSONVolume {
+	v := JSONVolume{
+		Name:         vi.Name,
+		Device:       vi.DevName,
+		Size:         sizeOf(vi.Size),
+		FileSystem:   vi.FileSystem,
+		UUID:         vi.UUID,
+		Content:      vi.Content,
+		Mounted:      vi.Mounted,
+		MountPoint:   vi.MountPoint,
+		Free:         sizeOf(vi.Free),
+		Writable:     vi.Writable,
+		MountOptions: nonNil(vi.MountOptions),
+		DevNum:       vi.DevNum,
+	}
+	if vi.PartitionNumber != 0 || vi.Offset != 0 || vi.PartitionType != "" || vi.PartitionUUID != "" ||
+		vi.PartitionLabel != "" || vi.Attributes != 0 {
+		v.Partition = &JSONPartition{
+			Number:     vi.PartitionNumber,
+			Offset:     vi.Offset,
+			Type:       vi.PartitionType,
+			UUID:       vi.PartitionUUID,
+			Label:      vi.PartitionLabel,
+			Attributes: hexID(vi.Attributes, 1),
+		}
+	}
+	return v
+}
+
+func jsonInterfaces(ifs []*InterfaceInfo) []JSONInterface {
+	out := make([]JSONInterface, 0, len(ifs))
+	for _, i := range ifs {
+		ji := JSONInterface{
+			Number:           int(i.Number),
+			AlternateSetting: int(i.AlternateSetting),
+			Class:            hexID(uint64(i.Class), 2),
+			ClassName:        USBClassName(i.Class),
+			SubClass:         hexID(uint64(i.SubClass), 2),
+			Protocol:         hexID(uint64(i.Protocol), 2),
+			Name:             i.Name,
+			Driver:           i.Driver,
+			Endpoints:        make([]JSONEndpoint, 0, len(i.Endpoints)),
+		}
+		for _, e := range i.Endpoints {
+			ji.Endpoints = append(ji.Endpoints, JSONEndpoint{
+				Address:       hexID(uint64(e.Address), 2),
+				Direction:     e.Direction(),
+				Attributes:    hexID(uint64(e.Attributes), 2),
+				MaxPacketSize: int(e.MaxPacketSize),
+				Interval:      int(e.Interval),
+			})
+		}
+		out = append(out, ji)
+	}
+	return out
+}
+
+func jsonConfigs(cs []*ConfigInfo) []JSONConfig {
+	out := make([]JSONConfig, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, JSONConfig{
+			Value:      int(c.Value),
+			Name:       c.Name,
+			Attributes: hexID(uint64(c.Attributes), 2),
+			MaxPower:   c.MaxPower,
+			Interfaces: jsonInterfaces(c.Interfaces),
+		})
+	}
+	return out
+}
+
+func jsonUSBDevices(ds []*USBDevice) []JSONUSBDevice {
+	out := make([]JSONUSBDevice, 0, len(ds))
+	for _, d := range ds {
+		jd := JSONUSBDevice{
+			Name:          d.Name,
+			Manufacturer:  d.Manufacturer,
+			SerialNumber:  d.SerialNumber,
+			VendorID:      hexID(uint64(d.VendorID), 4),
+			ProductID:     hexID(uint64(d.ProductID), 4),
+			LocationID:    hexID(uint64(d.LocationID), 8),
+			Address:       d.Address,
+			Port:          d.Port,
+			Speed:         d.Speed,
+			USBVersion:    d.USBVersion,
+			DeviceVersion: d.DeviceVersion,
+			BusPower:      d.BusPower,
+			BusPowerUsed:  d.BusPowerUsed,
+			Class:         hexID(uint64(d.Class), 2),
+			ClassName:     USBClassName(d.Class),
+			SubClass:      hexID(uint64(d.SubClass), 2),
+			Protocol:      hexID(uint64(d.Protocol), 2),
+			Configs:       jsonConfigs(d.Configs),
+			Interfaces:    jsonInterfaces(d.Interfaces),
+			Devices:       jsonUSBDevices(d.Devices),
+			Warnings:      d.Warnings,
+		}
+		if d.Storage != nil {
+			jd.Storage = USBKey(d.Storage)
+		}
+		out = append(out, jd)
+	}
+	return out
+}
+
+func jsonDescriptors(ds *USBDescriptors) *JSONDescriptors {
+	dd := ds.Device
+	d := &JSONDescriptors{
+		Device: JSONDeviceDescriptor{
+			USBVersion:        hexID(uint64(dd.USBVersion), 4),
+			Class:             hexID(uint64(dd.Class), 2),
+			SubClass:          hexID(uint64(dd.SubClass), 2),
+			Protocol:          hexID(uint64(dd.Protocol), 2),
+			MaxPacketSize0:    int(dd.MaxPacketSize0),
+			VendorID:          hexID(uint64(dd.VendorID), 4),
+			ProductID:         hexID(uint64(dd.ProductID), 4),
+			DeviceVersion:     hexID(uint64(dd.DeviceVersion), 4),
+			ManufacturerIndex: int(dd.ManufacturerIndex),
+			ProductIndex:      int(dd.ProductIndex),
+			SerialNumberIndex: int(dd.SerialNumberIndex),
+			NumConfigs:        int(dd.NumConfigs),
+		},
+		Configs:   jsonConfigs(ds.Configs),
+		Languages: make([]HexID, 0, len(ds.Languages)),
+		Strings:   ds.Strings,
+		MaxSpeed:  ds.MaxSpeed(),
+	}
+	if d.Strings == nil {
+		d.Strings = map[uint8]string{}
+	}
+	if ds.BOS != nil {
+		d.BOS = make([]JSONCapability, 0, len(ds.BOS.Capabilities))
+		for _, c := range ds.BOS.Capabilities {
+			jc := JSONCapability{
+				Type:            hexID(uint64(c.Type), 2),
+				Data:            hex.EncodeToString(c.Data),
+				LPM:             c.LPM,
+				SpeedsSupported: hexID(uint64(c.SpeedsSupported), 4),
+				SublinkSpeeds:   make([]HexID, 0, len(c.SublinkSpeeds)),
+				ContainerID:     c.ContainerID,
+			}
+			for _, s := range c.SublinkSpeeds {
+				jc.SublinkSpeeds = append(jc.SublinkSpeeds, hexID(uint64(s), 8))
+			}
+			d.BOS = append(d.BOS, jc)
+		}
+	}
+	for _, l := range ds.Languages {
+		d.Languages = append(d.Languages, hexID(uint64(l), 4))
+	}
+	return d
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil(ss []string) []string {
+	if ss == nil {
+		return []string{}
+	}
+	return ss
+}
+
+// docDecoder turns a Document back into the model, keeping the first error:
+// an ID or number too large for the model's field, or a dangling storage
+// reference. Errors name the path of the offending value.
+type docDecoder struct {
+	err     error
+	storage map[string]*USBInfo // by USBKey
+}
+
+func (dec *docDecoder) fail(path, format string, args ...any) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+}
+
+func (dec *docDecoder) uint(v uint64, bits int, path string) uint64 {
+	if v>>bits != 0 {
+		dec.fail(path, "%d out of range", v)
+	}
+	return v
+}
+
+func (dec *docDecoder) u8(h HexID, path string) uint8 {
+	return uint8(dec.uint(h.Value, 8, path))
+}
+
+func (dec *docDecoder) u16(h HexID, path string) uint16 {
+	return uint16(dec.uint(h.Value, 16, path))
+}
+
+func (dec *docDecoder) u32(h HexID, path string) uint32 {
+	return uint32(dec.uint(h.Value, 32, path))
+}
+
+func (dec *docDecoder) int(v, bits int, path string) int {
+	if v < 0 || v>>bits != 0 {
+		dec.fail(path, "%d out of range", v)
+	}
+	return v
+}
+
+func (dec *docDecoder) int8(v int, path string) uint8 {
+	return uint8(dec.int(v, 8, path))
+}
+
+func (dec *docDecoder) int16(v int, path string) uint16 {
+	return uint16(dec.int(v, 16, path))
+}
+
+func (dec *docDecoder) device(d JSONDevice, path string) *USBInfo {
+	ui := &USBInfo{
+		Name:         d.Name,
+		ProductID:    dec.u16(d.ProductID, path+".product_id"),
+		VendorID:     dec.u16(d.VendorID, path+".vendor_id"),
+		SerialNumber: d.SerialNumber,
+		Manufacturer: d.Manufacturer,
+		LocationID:   dec.u32(d.LocationID, path+".location_id"),
+		Speed:        d.Speed,
+		RegistryID:   d.RegistryID.Value,
+		PortNum:      d.Port,
+		Class:        dec.u8(d.Class, path+".class"),
+		SubClass:     dec.u8(d.SubClass, path+".sub_class"),
+		Protocol:     dec.u8(d.Protocol, path+".protocol"),
+		Interfaces:   dec.interfaces(d.Interfaces, path+".interfaces"),
+		Driver:       d.Driver,
+		Media:        make([]*MediaInfo, 0, len(d.Media)),
+		Warnings:     d.Warnings,
+		Source:       d.Source,
+	}
+	if d.Descriptors != nil {
+		ui.Descriptors = dec.descriptors(d.Descriptors, path+".descriptors")
+	}
+	for _, m := range d.Media {
+		mi := &MediaInfo{
+			Name:          m.Name,
+			DevName:       m.Device,
+			PartitionName: m.PartitionMap,
+			Size:          m.Size.Bytes,
+			DiskID:        m.DiskID,
+			Links:         m.Links,
+			Volumes:       make([]*VolumeInfo, 0, len(m.Volumes)),
+		}
+		for _, v := range m.Volumes {
+			vi := &VolumeInfo{
+				Name:         v.Name,
+				DevName:      v.Device,
+				Size:         v.Size.Bytes,
+				FileSystem:   v.FileSystem,
+				UUID:         v.UUID,
+				Mounted:      v.Mounted,
+				MountPoint:   v.MountPoint,
+				Free:         v.Free.Bytes,
+				Writable:     v.Writable,
+				MountOptions: v.MountOptions,
+				DevNum:       v.DevNum,
+				Content:      v.Content,
+			}
+			if p := v.Partition; p != nil {
+				vi.PartitionNumber = p.Number
+				vi.Offset = p.Offset
+				vi.PartitionType = p.Type
+				vi.PartitionUUID = p.UUID
+				vi.PartitionLabel = p.Label
+				vi.Attributes = p.Attributes.Value
+			}
+			mi.Volumes = append(mi.Volumes, vi)
+		}
+		if b := m.Boot; b != nil {
+			mi.Boot = &BootInfo{
+				ISO9660:         b.ISO9660,
+				ISOHybrid:       b.ISOHybrid,
+				ElTorito:        b.ElTorito,
+				EFILoaders:      b.EFILoaders,
+				MBRBootCode:     b.MBRBootCode,
+				ActivePartition: b.ActivePartition,
+				BIOSBootPart:    b.BIOSBootPart,
+			}
+			if oi := b.OS; oi != nil {
+				mi.Boot.OS = &OSInfo{Name: oi.Name, Version: oi.Version, Arch: oi.Arch, Source: oi.Source}
+			}
+		}
+		ui.Media = append(ui.Media, mi)
+	}
+	return ui
+}
+
+func (dec *docDecoder) interfaces(jis []JSONInterface, path string) []*InterfaceInfo {
+	ifs := make([]*InterfaceInfo, 0, len(jis))
+	for n, ji := range jis {
+		p := fmt.Sprintf("%s[%d]", path, n)
+		i := &InterfaceInfo{
+			Number:           dec.int8(ji.Number, p+".number"),
+			AlternateSetting: dec.int8(ji.AlternateSetting, p+".alternate_setting"),
+			Class:            dec.u8(ji.Class, p+".class"),
+			SubClass:         dec.u8(ji.SubClass, p+".sub_class"),
+			Protocol:         dec.u8(ji.Protocol, p+".protocol"),
+			Name:             ji.Name,
+			Driver:           ji.Driver,
+			Endpoints:        make([]*EndpointInfo, 0, len(ji.Endpoints)),
+		}
+		for m, e := range ji.Endpoints {
+			p := fmt.Sprintf("%s.endpoints[%d]", p, m)
+			i.Endpoints = append(i.Endpoints, &EndpointInfo{
+				Address:       dec.u8(e.Address, p+".address"),
+				Attributes:    dec.u8(e.Attributes, p+".attributes"),
+				MaxPacketSize: dec.int16(e.MaxPacketSize, p+".max_packet_size"),
+				Interval:      dec.int8(e.Interval, p+".interval"),
+			})
+		}
+		ifs = append(ifs, i)
+	}
+	return ifs
+}
+
+func (dec *docDecoder) configs(jcs []JSONConfig, path string) []*ConfigInfo {
+	cs := make([]*ConfigInfo, 0, len(jcs))
+	for n, c := range jcs {
+		p := fmt.Sprintf("%s[%d]", path, n)
+		cs = append(cs, &ConfigInfo{
+			Value:      dec.int8(c.Value, p+".value"),
+			Name:       c.Name,
+			Attributes: dec.u8(c.Attributes, p+".attributes"),
+			MaxPower:   c.MaxPower,
+			Interfaces: dec.interfaces(c.Interfaces, p+".interfaces"),
+		})
+	}
+	return cs
+}
+
+func (dec *docDecoder) usbDevices(jds []JSONUSBDevice, path string) []*USBDevice {
+	ds := make([]*USBDevice, 0, len(jds))
+	for n, jd := range jds {
+		p := fmt.Sprintf("%s[%d]", path, n)
+		d := &USBDevice{
+			Name:          jd.Name,
+			Manufacturer:  jd.Manufacturer,
+			SerialNumber:  jd.SerialNumber,
+			VendorID:      dec.u16(jd.VendorID, p+".vendor_id"),
+			ProductID:     dec.u16(jd.ProductID, p+".product_id"),
+			LocationID:    dec.u32(jd.LocationID, p+".location_id"),
+			Address:       jd.Address,
+			Port:          jd.Port,
+			Speed:         jd.Speed,
+			USBVersion:    jd.USBVersion,
+			DeviceVersion: jd.DeviceVersion,
+			BusPower:      jd.BusPower,
+			BusPowerUsed:  jd.BusPowerUsed,
+			Class:         dec.u8(jd.Class, p+".class"),
+			SubClass:      dec.u8(jd.SubClass, p+".sub_class"),
+			Protocol:      dec.u8(jd.Protocol, p+".protocol"),
+			Configs:       dec.configs(jd.Configs, p+".configs"),
+			Interfaces:    dec.interfaces(jd.Interfaces, p+".interfaces"),
+			Devices:       dec.usbDevices(jd.Devices, p+".devices"),
+			Warnings:      jd.Warnings,
+		}
+		if jd.Storage != "" {
+			if d.Storage = dec.storage[jd.Storage]; d.Storage == nil {
+				dec.fail(p+".storage", "no device %s", jd.Storage)
+			}
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+func (dec *docDecoder) descriptors(d *JSONDescriptors, path string) *USBDescriptors {
+	dd, p := d.Device, path+".device"
+	ds := &USBDescriptors{
+		Device: DeviceDescriptor{
+			USBVersion:        dec.u16(dd.USBVersion, p+".usb_version"),
+			Class:             dec.u8(dd.Class, p+".class"),
+			SubClass:          dec.u8(dd.SubClass, p+".sub_class"),
+			Protocol:          dec.u8(dd.Protocol, p+".protocol"),
+			MaxPacketSize0:    dec.int8(dd.MaxPacketSize0, p+".max_packet_size0"),
+			VendorID:          dec.u16(dd.VendorID, p+".vendor_id"),
+			ProductID:         dec.u16(dd.ProductID, p+".product_id"),
+			DeviceVersion:     dec.u16(dd.DeviceVersion, p+".device_version"),
+			ManufacturerIndex: dec.int8(dd.ManufacturerIndex, p+".manufacturer_index"),
+			ProductIndex:      dec.int8(dd.ProductIndex, p+".product_index"),
+			SerialNumberIndex: dec.int8(dd.SerialNumberIndex, p+".serial_number_index"),
+			NumConfigs:        dec.int8(dd.NumConfigs, p+".num_configs"),
+		},
+		Configs: dec.configs(d.Configs, path+".configs"),
+		Strings: d.Strings,
+	}
+	if d.BOS != nil {
+		ds.BOS = &BOSInfo{Capabilities: make([]*DeviceCapability, 0, len(d.BOS))}
+		for n, c := range d.BOS {
+			p := fmt.Sprintf("%s.bos[%d]", path, n)
+			data, err := hex.DecodeString(c.Data)
+			if err != nil {
+				dec.fail(p+".data", "%v", err)
+			}
+			dc := &DeviceCapability{
+				Type:            dec.u8(c.Type, p+".type"),
+				Data:            data,
+				LPM:             c.LPM,
+				SpeedsSupported: dec.u16(c.SpeedsSupported, p+".speeds_supported"),
+				ContainerID:     c.ContainerID,
+			}
+			for m, s := range c.SublinkSpeeds {
+				dc.SublinkSpeeds = append(dc.SublinkSpeeds, dec.u32(s, fmt.Sprintf("%s.sublink_speeds[%d]", p, m)))
+			}
+			ds.BOS.Capabilities = append(ds.BOS.Capabilities, dc)
+		}
+	}
+	for n, l := range d.Languages {
+		ds.Languages = append(ds.Languages, dec.u16(l, fmt.Sprintf("%s.languages[%d]", path, n)))
+	}
+	return ds
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	uis, err := SampleBackend{}.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buses, err := SampleBackend{}.Topology(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AttachStorage(buses, uis)
+	// what the samples lack: descriptors and warnings
+	if uis[0].Descriptors, err = DecodeDescriptors(testDescriptorBlob(t)); err != nil {
+		t.Fatal(err)
+	}
+	uis[0].Warnings = []string{"location ID 0x02f00000 is approximate"}
+	WalkUSBDevices(buses, func(_ *USBBus, d *USBDevice, depth int) bool {
+		if depth == 1 {
+			d.Warnings = []string{"location ID 0x14f00000 is approximate"}
+		}
+		return true
+	})
+
+	var exported bytes.Buffer
+	if err := NewDocument(uis, buses).Encode(&exported); err != nil {
+		t.Fatal(err)
+	}
+	snap := SnapshotBackend{Paths: []string{"-"}, Stdin: bytes.NewReader(exported.Bytes()), cache: &snapshotCache{}}
+	uis2, err := snap.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buses2, err := snap.Topology(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the model read back differs only in nil and empty slices, which the
+	// document does not tell apart
+	var again bytes.Buffer
+	if err := NewDocument(uis2, buses2).Encode(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), exported.Bytes()) {
+		t.Errorf("exporting the document read back gives\n%s\nwant\n%s", again.Bytes(), exported.Bytes())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// lsblk -J -b -o NAME,SIZE,TYPE,FSTYPE,FSVER,UUID,LABEL,MOUNTPOINT,TRAN,VENDOR,MODEL,SERIAL,PTTYPE,FSAVAIL,RO
+const lsblkColumns = "NAME,SIZE,TYPE,FSTYPE,FSVER,UUID,LABEL,MOUNTPOINT,TRAN,VENDOR,MODEL,SERIAL,PTTYPE,FSAVAIL,RO"
+
+// LsblkBackend discovers USB storage devices on Linux from `lsblk --json`.
+type LsblkBackend struct {
+	Runner CommandRunner // nil means ExecRunner
+}
+
+// Discover runs lsblk and returns the USB disks found.
+func (l LsblkBackend) Discover(ctx context.Context) ([]*USBInfo, error) {
+	runner := l.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	out, err := runner.Run(ctx, "lsblk", "-J", "-b", "-o", lsblkColumns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run lsblk: %w", err)
+	}
+	return ParseLsblk(bytes.NewReader(out))
+}
+
+// lsblkInt accepts numbers both as JSON numbers and as strings, since older
+// util-linux releases quote everything; null is 0.
+type lsblkInt int64
+
+func (n *lsblkInt) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" || s == "" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid lsblk number %s: %w", b, err)
+	}
+	*n = lsblkInt(v)
+	return nil
+}
+
+// lsblkBool accepts true/false as well as the "0"/"1" of older releases.
+type lsblkBool bool
+
+func (v *lsblkBool) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(string(b), `"`) {
+	case "true", "1":
+		*v = true
+	case "false", "0", "null", "":
+		*v = false
+	default:
+		return fmt.Errorf("invalid lsblk boolean %s", b)
+	}
+	return nil
+}
+
+type lsblkDevice struct {
+	Name       string         `json:"name"`
+	Size       lsblkInt       `json:"size"`
+	Type       string         `json:"type"`
+	FSType     string         `json:"fstype"`
+	FSVer      string         `json:"fsver"`
+	UUID       string         `json:"uuid"`
+	Label      string         `json:"label"`
+	MountPoint *string        `json:"mountpoint"`
+	Tran       string         `json:"tran"`
+	Vendor     string         `json:"vendor"`
+	Model      string         `json:"model"`
+	Serial     string         `json:"serial"`
+	PTType     string         `json:"pttype"`
+	FSAvail    lsblkInt       `json:"fsavail"`
+	RO         lsblkBool      `json:"ro"`
+	Children   []*lsblkDevice `json:"children"`
+}
+
+// ParseLsblk parses captured `lsblk -J -b -o ...` output and maps every disk
+// on the usb transport to a USBInfo with a single media; partitions become
+// volumes.
+func ParseLsblk(r io.Reader) ([]*USBInfo, error) {
+	var doc struct {
+		BlockDevices []*lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode lsblk JSON: %w", err)
+	}
+	if doc.BlockDevices == nil {
+		return nil, fmt.Errorf("lsblk JSON missing blockdevices entry")
+	}
+	uis := make([]*USBInfo, 0)
+	for _, d := range doc.BlockDevices {
+		if d.Type != "disk" || d.Tran != "usb" {
+			continue
+		}
+		vendor := strings.TrimSpace(d.Vendor)
+		model := strings.TrimSpace(d.Model)
+		ui := &USBInfo{
+			Name:         model,
+			SerialNumber: strings.TrimSpace(d.Serial),
+			Manufacturer: vendor,
+		}
+		mi := &MediaInfo{
+			Name:          strings.TrimSpace(vendor + " " + model),
+			DevName:       d.Name,
+			PartitionName: partitionMapName(d.PTType),
+			Size:          int64(d.Size),
+		}
+		if mi.Name == "" {
+			mi.Name = d.Name
+		}
+		if len(d.Children) == 0 && d.FSType != "" {
+			// a file system directly on the disk, without a partition table
+			mi.Volumes = append(mi.Volumes, d.volume())
+		}
+		for _, c := range d.Children {
+			if c.Type != "part" {
+				continue
+			}
+			mi.Volumes = append(mi.Volumes, c.volume())
+		}
+		ui.Media = []*MediaInfo{mi}
+		uis = append(uis, ui)
+	}
+	return uis, nil
+}
+
+func (d *lsblkDevice) volume() *VolumeInfo {
+	vi := &VolumeInfo{
+		Name:       d.Label,
+		DevName:    d.Name,
+		Size:       int64(d.Size),
+		FileSystem: fileSystemName(d.FSType, d.FSVer),
+		UUID:       d.UUID,
+	}
+	if d.MountPoint != nil && *d.MountPoint != "" {
+		vi.Mounted = true
+		vi.MountPoint = *d.MountPoint
+		vi.Free = int64(d.FSAvail)
+		vi.Writable = !bool(d.RO)
+	}
+	return vi
+}
+
+// partitionMapName maps a blkid partition table type to the names used by
+// system_profiler.
+func partitionMapName(pttype string) string {
+	switch pttype {
+	case "gpt":
+		return "guid_partition_map_type"
+	case "dos":
+		return "master_boot_record_partition_map_type"
+	case "mac":
+		return "apple_partition_map_type"
+	}
+	return "unknown_partition_map_type"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testLsblk is `lsblk -J -b -O` from util-linux 2.37, cut down to the
+// columns that matter: a SATA disk, a partitioned stick with one mounted
+// volume and a stick formatted without a partition table.
+const testLsblk = `{
+   "blockdevices": [
+      {
+         "name": "sda", "kname": "sda", "path": "/dev/sda", "maj:min": "8:0", "fsavail": null, "fssize": null, "fstype": null, "fsused": null, "fsuse%": null, "fsver": null, "mountpoint": null, "label": null, "uuid": null, "ptuuid": "d6a5e3c1-1b5f-4b0e-9a0e-6e0f1f6c0f2a", "pttype": "gpt", "parttype": null, "partlabel": null, "partuuid": null, "ro": false, "rm": false, "hotplug": false, "model": "Samsung SSD 860 EVO 500GB", "serial": "S3Z1NB0K123456A", "size": 500107862016, "state": "running", "type": "disk", "tran": "sata", "vendor": "ATA     ",
+         "children": [
+            {"name": "sda1", "fstype": "ext4", "mountpoint": "/", "label": null, "uuid": "3f1c2d4e-0000-4000-8000-000000000001", "size": 500106813440, "fsavail": 312345678848, "ro": false, "rm": false, "type": "part", "tran": null, "vendor": null, "model": null, "serial": null, "pttype": "gpt"}
+         ]
+      },
+      {
+         "name": "sdb", "kname": "sdb", "path": "/dev/sdb", "maj:min": "8:16", "fsavail": null, "fssize": null, "fstype": null, "fsused": null, "fsuse%": null, "fsver": null, "mountpoint": null, "label": null, "uuid": null, "ptuuid": "5b3c9e2a-1d47-4f0b-9a61-3e2d8c7b6a50", "pttype": "gpt", "parttype": null, "partlabel": null, "partuuid": null, "ro": false, "rm": true, "hotplug": true, "model": "Ultra           ", "serial": "4C530001230512105341", "size": 30752636928, "state": "running", "type": "disk", "tran": "usb", "vendor": "SanDisk ",
+         "children": [
+            {"name": "sdb1", "fstype": "vfat", "fsver": "FAT32", "mountpoint": "/media/user/EFI", "label": "EFI", "uuid": "67E3-17ED", "size": 209715200, "fsavail": 200000000, "ro": false, "rm": true, "type": "part", "tran": null, "vendor": null, "model": null, "serial": null, "pttype": "gpt", "partlabel": "EFI System Partition"},
+            {"name": "sdb2", "fstype": "exfat", "fsver": "1.0", "mountpoint": null, "label": "DATA", "uuid": "5F1A-2B3C", "size": 30541873152, "fsavail": null, "ro": false, "rm": true, "type": "part", "tran": null, "vendor": null, "model": null, "serial": null, "pttype": "gpt", "partlabel": "DATA"}
+         ]
+      },
+      {
+         "name": "sdc", "kname": "sdc", "path": "/dev/sdc", "maj:min": "8:32", "fsavail": "7812345856", "fssize": "8004304896", "fstype": "vfat", "fsused": "191959040", "fsuse%": "2%", "fsver": "FAT32", "mountpoint": "/media/user/STICK", "label": "STICK", "uuid": "1234-ABCD", "ptuuid": null, "pttype": null, "parttype": null, "partlabel": null, "partuuid": null, "ro": "1", "rm": "1", "hotplug": "1", "model": "Flash Disk      ", "serial": null, "size": "8004304896", "state": "running", "type": "disk", "tran": "usb", "vendor": "Generic "
+      }
+   ]
+}`
+
+func TestLsblkDiscover(t *testing.T) {
+	runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "lsblk" || len(args) == 0 || args[0] != "-J" {
+			t.Errorf("ran %s %q", name, args)
+		}
+		return []byte(testLsblk), nil
+	})
+	uis, err := LsblkBackend{Runner: runner}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uis) != 2 {
+		t.Fatalf("got %d devices, want the two USB disks", len(uis))
+	}
+
+	sdb := uis[0]
+	if sdb.Name != "Ultra" || sdb.Manufacturer != "SanDisk" || sdb.SerialNumber != "4C530001230512105341" {
+		t.Errorf("got name %q, manufacturer %q, serial %q", sdb.Name, sdb.Manufacturer, sdb.SerialNumber)
+	}
+	mi := sdb.Media[0]
+	if mi.Name != "SanDisk Ultra" || mi.DevName != "sdb" || mi.PartitionName != "guid_partition_map_type" || mi.Size != 30752636928 {
+		t.Errorf("got media %+v", *mi)
+	}
+	if len(mi.Volumes) != 2 {
+		t.Fatalf("got %d volumes, want 2", len(mi.Volumes))
+	}
+	want := VolumeInfo{Name: "EFI", DevName: "sdb1", Size: 209715200, FileSystem: "MS-DOS FAT32", UUID: "67E3-17ED",
+		Mounted: true, MountPoint: "/media/user/EFI", Free: 200000000, Writable: true}
+	if got := *mi.Volumes[0]; got.Name != want.Name || got.DevName != want.DevName || got.Size != want.Size ||
+		got.FileSystem != want.FileSystem || got.UUID != want.UUID || got.Mounted != want.Mounted ||
+		got.MountPoint != want.MountPoint || got.Free != want.Free || got.Writable != want.Writable {
+		t.Errorf("sdb1 is %+v, want %+v", got, want)
+	}
+	if vi := mi.Volumes[1]; vi.Mounted || vi.Free != 0 || vi.Name != "DATA" {
+		t.Errorf("sdb2 is %+v", *vi)
+	}
+
+	// the old string encoding, and a file system without a partition table
+	sdc := uis[1].Media[0]
+	if sdc.Name != "Generic Flash Disk" || sdc.PartitionName != "unknown_partition_map_type" || sdc.Size != 8004304896 {
+		t.Errorf("got media %+v", *sdc)
+	}
+	if len(sdc.Volumes) != 1 {
+		t.Fatalf("got %d volumes on sdc, want 1", len(sdc.Volumes))
+	}
+	if vi := sdc.Volumes[0]; vi.DevName != "sdc" || vi.Name != "STICK" || vi.Free != 7812345856 || vi.Writable {
+		t.Errorf("sdc volume is %+v", *vi)
+	}
+}
+
+func TestParseLsblkErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`{}`,
+		`{"blockdevices": [{"name": "sdb", "size": "big"}]}`,
+		`{"blockdevices": [{"name": "sdb", "ro": "maybe"}]}`,
+	} {
+		if _, err := ParseLsblk(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseLsblk(%q) returned no error", in)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lsusb -t
+// lsusb -v
+
+var (
+	// "/:  Bus 02.Port 1: Dev 1, Class=root_hub, Driver=xhci_hcd/10p, 5000M"
+	lsusbTreeBusRe = regexp.MustCompile(`^/:\s+Bus (\d+)\.Port (\d+): Dev (\d+), (.*)$`)
+	// "|__ Port 4: Dev 5, If 0, Class=Mass Storage, Driver=usb-storage, 480M"
+	lsusbTreePortRe = regexp.MustCompile(`^\|__ Port (\d+): Dev (\d+), If (\d+), (.*)$`)
+	// "ID 1f75:0917 Innostor Technology Corporation" (lsusb -tv)
+	lsusbTreeIDRe = regexp.MustCompile(`^ID ([0-9a-fA-F]{4}):([0-9a-fA-F]{4})\s*(.*)$`)
+	// "Bus 002 Device 003: ID 1f75:0917 Innostor Technology Corporation"
+	lsusbDeviceRe = regexp.MustCompile(`^Bus (\d+) Device (\d+): ID ([0-9a-fA-F]{4}):([0-9a-fA-F]{4})\s*(.*)$`)
+)
+
+// lsusbClasses maps the class names printed by lsusb -t back to class codes.
+var lsusbClasses = map[string]uint8{
+	"root_hub":                       0x09,
+	"Audio":                          0x01,
+	"Communications":                 0x02,
+	"Human Interface Device":         0x03,
+	"Physical Interface Device":      0x05,
+	"Imaging":                        0x06,
+	"Printer":                        0x07,
+	"Mass Storage":                   0x08,
+	"Hub":                            0x09,
+	"CDC Data":                       0x0a,
+	"Chip/SmartCard":                 0x0b,
+	"Content Security":               0x0d,
+	"Video":                          0x0e,
+	"Personal Healthcare":            0x0f,
+	"Audio/Video":                    0x10,
+	"Billboard":                      0x11,
+	"Type-C Bridge":                  0x12,
+	"Diagnostic":                     0xdc,
+	"Wireless":                       0xe0,
+	"Miscellaneous Device":           0xef,
+	"Application Specific Interface": 0xfe,
+	"Vendor Specific Class":          0xff,
+}
+
+// lsusbAttrs splits the "Class=Hub, Driver=hub/4p, 480M" tail of a lsusb -t
+// line into its key/value attributes and the speed.
+func lsusbAttrs(s string) (map[string]string, string) {
+	attrs := make(map[string]string)
+	speed := ""
+	for _, f := range strings.Split(s, ", ") {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			attrs[k] = v
+			continue
+		}
+		if strings.HasSuffix(f, "M") {
+			speed = sysfsSpeed(strings.TrimSuffix(f, "M"))
+		}
+	}
+	return attrs, speed
+}
+
+// ParseLsusbTree parses `lsusb -t` (or `lsusb -tv`) output into buses and
+// their port tree. Devices with several interfaces are listed once per
+// interface and are merged into one USBDevice.
+func ParseLsusbTree(r io.Reader) ([]*USBBus, error) {
+	type level struct {
+		col int
+		dev *USBDevice
+	}
+	buses := make([]*USBBus, 0)
+	var bus *USBBus
+	var stack []level
+	var last *USBDevice
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if m := lsusbTreeBusRe.FindStringSubmatch(line); m != nil {
+			num, _ := strconv.Atoi(m[1])
+			attrs, speed := lsusbAttrs(m[4])
+			driver, _, _ := strings.Cut(attrs["Driver"], "/")
+			bus = &USBBus{
+				Name:           fmt.Sprintf("Bus %03d", num),
+				Number:         num,
+				HostController: driver,
+				Speed:          speed,
+			}
+			buses = append(buses, bus)
+			stack = stack[:0]
+			last = nil
+			continue
+		}
+		col := strings.Index(line, "|__")
+		if col < 0 {
+			trimmed := strings.TrimSpace(line)
+			if m := lsusbTreeIDRe.FindStringSubmatch(trimmed); m != nil && last != nil {
+				vid, _ := strconv.ParseUint(m[1], 16, 16)
+				pid, _ := strconv.ParseUint(m[2], 16, 16)
+				last.VendorID, last.ProductID = uint16(vid), uint16(pid)
+				if last.Name == "" {
+					last.Name = m[3]
+				}
+				continue
+			}
+			if lsusbTreeIDRe.MatchString(trimmed) || strings.HasPrefix(trimmed, "/sys/") {
+				continue // ID line of a root hub, or a -tv sysfs path
+			}
+			return nil, fmt.Errorf("lsusb -t line %d is malformed: %q", n, line)
+		}
+		m := lsusbTreePortRe.FindStringSubmatch(line[col:])
+		if m == nil || bus == nil {
+			return nil, fmt.Errorf("lsusb -t line %d is malformed: %q", n, line)
+		}
+		port, _ := strconv.Atoi(m[1])
+		addr, _ := strconv.Atoi(m[2])
+		ifNum, _ := strconv.Atoi(m[3])
+		attrs, speed := lsusbAttrs(m[4])
+
+		for len(stack) > 0 && stack[len(stack)-1].col > col {
+			stack = stack[:len(stack)-1]
+		}
+		var dev *USBDevice
+		if len(stack) > 0 && stack[len(stack)-1].col == col && stack[len(stack)-1].dev.Address == addr {
+			dev = stack[len(stack)-1].dev // another interface of the same device
+		} else {
+			if len(stack) > 0 && stack[len(stack)-1].col == col {
+				stack = stack[:len(stack)-1]
+			}
+			dev = &USBDevice{Address: addr, Port: port, Speed: speed}
+			ports := []string{}
+			parent := &bus.Devices
+			for _, l := range stack {
+				ports = append(ports, strconv.Itoa(l.dev.Port))
+				parent = &l.dev.Devices
+			}
+			ports = append(ports, strconv.Itoa(port))
+			loc, err := linuxLocationID(uint8(bus.Number), strings.Join(ports, "."))
+			if err != nil {
+				dev.Warnings = append(dev.Warnings, fmt.Sprintf("location ID %#08x is approximate: %v", loc, err))
+			}
+			dev.LocationID = loc
+			*parent = append(*parent, dev)
+			stack = append(stack, level{col, dev})
+		}
+		ii := &InterfaceInfo{Number: uint8(ifNum), Driver: attrs["Driver"]}
+		if d, _, ok := strings.Cut(ii.Driver, "/"); ok {
+			ii.Driver = d // "hub/4p"
+		}
+		if ii.Driver == "[none]" {
+			ii.Driver = ""
+		}
+		ii.Class = lsusbClasses[attrs["Class"]]
+		dev.Interfaces = append(dev.Interfaces, ii)
+		if len(dev.Interfaces) == 1 {
+			dev.Class = ii.Class
+		} else if dev.Class != ii.Class {
+			dev.Class = 0x00 // class defined per interface
+		}
+		last = dev
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lsusb -t output: %w", err)
+	}
+	return buses, nil
+}
+
+// LsusbDevice is a device with its descriptors as printed by `lsusb -v`.
+type LsusbDevice struct {
+	Bus    int
+	Device *USBDevice
+}
+
+// ParseLsusbVerbose parses `lsusb -v` output into devices with their
+// device, configuration, interface and endpoint descriptors.
+func ParseLsusbVerbose(r io.Reader) ([]*LsusbDevice, error) {
+	type header struct {
+		col  int
+		kind string
+	}
+	lds := make([]*LsusbDevice, 0)
+	var cur *LsusbDevice
+	var cfg *ConfigInfo
+	var ifc *InterfaceInfo
+	var ep *EndpointInfo
+	var headers []header
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if m := lsusbDeviceRe.FindStringSubmatch(line); m != nil {
+			bus, _ := strconv.Atoi(m[1])
+			addr, _ := strconv.Atoi(m[2])
+			vid, _ := strconv.ParseUint(m[3], 16, 16)
+			pid, _ := strconv.ParseUint(m[4], 16, 16)
+			cur = &LsusbDevice{Bus: bus, Device: &USBDevice{
+				Name:      m[5],
+				Address:   addr,
+				VendorID:  uint16(vid),
+				ProductID: uint16(pid),
+			}}
+			lds = append(lds, cur)
+			cfg, ifc, ep, headers = nil, nil, nil, nil
+			continue
+		}
+		if cur == nil {
+			continue // e.g. "Couldn't open device" chatter before the first device
+		}
+		col := len(line) - len(strings.TrimLeft(line, " "))
+		for len(headers) > 0 && headers[len(headers)-1].col >= col {
+			headers = headers[:len(headers)-1]
+		}
+		if strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, "  ") {
+			kind := strings.TrimSuffix(trimmed, ":")
+			switch kind {
+			case "Configuration Descriptor":
+				cfg = &ConfigInfo{}
+				cur.Device.Configs = append(cur.Device.Configs, cfg)
+			case "Interface Descriptor":
+				if cfg == nil {
+					return nil, fmt.Errorf("lsusb -v line %d: interface outside of a configuration", n)
+				}
+				ifc = &InterfaceInfo{}
+				cfg.Interfaces = append(cfg.Interfaces, ifc)
+			case "Endpoint Descriptor":
+				if ifc == nil {
+					return nil, fmt.Errorf("lsusb -v line %d: endpoint outside of an interface", n)
+				}
+				ep = &EndpointInfo{}
+				ifc.Endpoints = append(ifc.Endpoints, ep)
+			}
+			headers = append(headers, header{col, kind})
+			continue
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		fields := strings.Fields(trimmed)
+		if len(fields) < 2 {
+			continue
+		}
+		key, val := fields[0], fields[1]
+		desc := ""
+		if len(fields) > 2 {
+			// keep the original spacing of strings, which may contain runs of blanks
+			rest := trimmed[len(key):]
+			desc = strings.TrimSpace(rest[strings.Index(rest, val)+len(val):])
+		}
+		num := func(bits int) uint64 {
+			v, err := strconv.ParseUint(val, 0, bits)
+			if err != nil {
+				// tolerate lsusb's decimal numbers with leading zeros
+				v, _ = strconv.ParseUint(strings.TrimLeft(val, "0"), 10, bits)
+			}
+			return v
+		}
+		d := cur.Device
+		switch headers[len(headers)-1].kind {
+		case "Device Descriptor":
+			switch key {
+			case "bcdUSB":
+				d.USBVersion = val
+			case "bcdDevice":
+				d.DeviceVersion = val
+			case "bDeviceClass":
+				d.Class = uint8(num(8))
+			case "bDeviceSubClass":
+				d.SubClass = uint8(num(8))
+			case "bDeviceProtocol":
+				d.Protocol = uint8(num(8))
+			case "iManufacturer":
+				d.Manufacturer = desc
+			case "iProduct":
+				if desc != "" {
+					d.Name = desc
+				}
+			case "iSerial":
+				d.SerialNumber = desc
+			}
+		case "Configuration Descriptor":
+			switch key {
+			case "bConfigurationValue":
+				cfg.Value = uint8(num(8))
+			case "iConfiguration":
+				cfg.Name = desc
+			case "bmAttributes":
+				cfg.Attributes = uint8(num(8))
+			case "MaxPower":
+				cfg.MaxPower, _ = strconv.Atoi(strings.TrimSuffix(val, "mA"))
+			}
+		case "Interface Descriptor":
+			switch key {
+			case "bInterfaceNumber":
+				ifc.Number = uint8(num(8))
+			case "bAlternateSetting":
+				ifc.AlternateSetting = uint8(num(8))
+			case "bInterfaceClass":
+				ifc.Class = uint8(num(8))
+			case "bInterfaceSubClass":
+				ifc.SubClass = uint8(num(8))
+			case "bInterfaceProtocol":
+				ifc.Protocol = uint8(num(8))
+			case "iInterface":
+				ifc.Name = desc
+			}
+		case "Endpoint Descriptor":
+			switch key {
+			case "bEndpointAddress":
+				ep.Address = uint8(num(8))
+			case "bmAttributes":
+				ep.Attributes = uint8(num(8))
+			case "wMaxPacketSize":
+				ep.MaxPacketSize = uint16(num(16))
+			case "bInterval":
+				ep.Interval = uint8(num(8))
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read lsusb -v output: %w", err)
+	}
+	return lds, nil
+}
+
+// BuildLsusbTopology combines lsusb -t and lsusb -v output into one
+// topology: the tree gives the ports, the verbose output the descriptors,
+// matched by bus number and device address. Either may be nil; without a
+// tree all devices of a bus are listed flat below it, without port numbers.
+func BuildLsusbTopology(tree []*USBBus, verbose []*LsusbDevice) []*USBBus {
+	if tree == nil {
+		byNum := make(map[int]*USBBus)
+		tree = make([]*USBBus, 0)
+		for _, ld := range verbose {
+			bus, ok := byNum[ld.Bus]
+			if !ok {
+				bus = &USBBus{Name: fmt.Sprintf("Bus %03d", ld.Bus), Number: ld.Bus}
+				byNum[ld.Bus] = bus
+				tree = append(tree, bus)
+			}
+			if ld.Device.Address == 1 && ld.Device.Class == 0x09 {
+				continue // the root hub is the bus itself
+			}
+			dev := *ld.Device
+			dev.LocationID = uint32(ld.Bus) << 24
+			bus.Devices = append(bus.Devices, &dev)
+		}
+		sort.SliceStable(tree, func(i, j int) bool { return tree[i].Number < tree[j].Number })
+		return tree
+	}
+
+	type key struct{ bus, addr int }
+	byAddr := make(map[key]*USBDevice, len(verbose))
+	for _, ld := range verbose {
+		byAddr[key{ld.Bus, ld.Device.Address}] = ld.Device
+	}
+	WalkUSBDevices(tree, func(bus *USBBus, d *USBDevice, _ int) bool {
+		v, ok := byAddr[key{bus.Number, d.Address}]
+		if !ok {
+			return true
+		}
+		d.Name = v.Name
+		d.Manufacturer = v.Manufacturer
+		d.SerialNumber = v.SerialNumber
+		d.VendorID = v.VendorID
+		d.ProductID = v.ProductID
+		d.USBVersion = v.USBVersion
+		d.DeviceVersion = v.DeviceVersion
+		d.Class = v.Class
+		d.SubClass = v.SubClass
+		d.Protocol = v.Protocol
+		d.Configs = v.Configs
+		// carry the drivers from the tree over to the descriptors
+		for _, ti := range d.Interfaces {
+			for _, vi := range d.AllInterfaces() {
+				if vi.Number == ti.Number && vi.Driver == "" {
+					vi.Driver = ti.Driver
+				}
+			}
+		}
+		return true
+	})
+	return tree
+}
+
+// LsusbBackend discovers the USB topology on Linux from lsusb.
+type LsusbBackend struct {
+	Runner CommandRunner // nil means ExecRunner
+}
+
+// Topology runs `lsusb -t` and `lsusb -v` and combines their output. The
+// verbose output is optional: without root it may fail for some devices.
+func (l LsusbBackend) Topology(ctx context.Context) ([]*USBBus, error) {
+	runner := l.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	out, err := runner.Run(ctx, "lsusb", "-t")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run lsusb -t: %w", err)
+	}
+	tree, err := ParseLsusbTree(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	var verbose []*LsusbDevice
+	if out, err := runner.Run(ctx, "lsusb", "-v"); err == nil {
+		if verbose, err = ParseLsusbVerbose(bytes.NewReader(out)); err != nil {
+			debugf("ignoring lsusb -v output: %v\n", err)
+		}
+	} else {
+		debugf("ignoring lsusb -v: %v\n", err)
+	}
+	return BuildLsusbTopology(tree, verbose), nil
+}
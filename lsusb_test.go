@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// testLsusbTree is `lsusb -t` from usbutils 014: a stick on a USB 3 bus,
+// one behind a hub and a keyboard with two interfaces on port 16.
+const testLsusbTree = `/:  Bus 02.Port 1: Dev 1, Class=root_hub, Driver=xhci_hcd/10p, 5000M
+    |__ Port 3: Dev 2, If 0, Class=Mass Storage, Driver=usb-storage, 5000M
+/:  Bus 01.Port 1: Dev 1, Class=root_hub, Driver=xhci_hcd/16p, 480M
+    |__ Port 4: Dev 5, If 0, Class=Hub, Driver=hub/4p, 480M
+        |__ Port 2: Dev 6, If 0, Class=Mass Storage, Driver=usb-storage, 480M
+    |__ Port 16: Dev 3, If 0, Class=Human Interface Device, Driver=usbhid, 12M
+    |__ Port 16: Dev 3, If 1, Class=Human Interface Device, Driver=[none], 12M
+`
+
+// testLsusbVerbose is an excerpt of `lsusb -v` for the stick on bus 2.
+const testLsusbVerbose = `
+Bus 002 Device 002: ID 0781:5581 SanDisk Corp. Ultra
+Couldn't open device, some information will be missing
+Device Descriptor:
+  bLength                18
+  bDescriptorType         1
+  bcdUSB               3.20
+  bDeviceClass            0
+  bDeviceSubClass         0
+  bDeviceProtocol         0
+  bMaxPacketSize0         9
+  idVendor           0x0781 SanDisk Corp.
+  idProduct          0x5581 Ultra
+  bcdDevice            1.00
+  iManufacturer           1 SanDisk
+  iProduct                2  Ultra  USB 3.0
+  iSerial                 3 4C530001230512105341
+  bNumConfigurations      1
+  Configuration Descriptor:
+    bLength                 9
+    bDescriptorType         2
+    wTotalLength       0x002c
+    bNumInterfaces          1
+    bConfigurationValue     1
+    iConfiguration          0
+    bmAttributes         0x80
+      (Bus Powered)
+    MaxPower              896mA
+    Interface Descriptor:
+      bLength                 9
+      bDescriptorType         4
+      bInterfaceNumber        0
+      bAlternateSetting       0
+      bNumEndpoints           2
+      bInterfaceClass         8 Mass Storage
+      bInterfaceSubClass      6 SCSI
+      bInterfaceProtocol     80 Bulk-Only
+      iInterface              0
+      Endpoint Descriptor:
+        bLength                 7
+        bDescriptorType         5
+        bEndpointAddress     0x81  EP 1 IN
+        bmAttributes            2
+          Transfer Type            Bulk
+          Synch Type               None
+          Usage Type               Data
+        wMaxPacketSize     0x0400  1x 1024 bytes
+        bInterval               0
+      Endpoint Descriptor:
+        bLength                 7
+        bDescriptorType         5
+        bEndpointAddress     0x02  EP 2 OUT
+        bmAttributes            2
+        wMaxPacketSize     0x0400  1x 1024 bytes
+        bInterval               0
+`
+
+func TestParseLsusbTree(t *testing.T) {
+	buses, err := ParseLsusbTree(strings.NewReader(testLsusbTree))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buses) != 2 {
+		t.Fatalf("got %d buses, want 2", len(buses))
+	}
+	b2, b1 := buses[0], buses[1]
+	if b2.Name != "Bus 002" || b2.Number != 2 || b2.HostController != "xhci_hcd" || b2.Speed != "super_speed" {
+		t.Errorf("bus 2 is %+v", *b2)
+	}
+	if len(b2.Devices) != 1 {
+		t.Fatalf("got %d devices on bus 2, want 1", len(b2.Devices))
+	}
+	if d := b2.Devices[0]; d.Address != 2 || d.Port != 3 || d.LocationID != 0x02300000 || d.Class != 0x08 || d.Interfaces[0].Driver != "usb-storage" {
+		t.Errorf("the stick on bus 2 is %+v", *d)
+	}
+
+	if len(b1.Devices) != 2 {
+		t.Fatalf("got %d devices on bus 1, want the hub and the keyboard", len(b1.Devices))
+	}
+	hub, kbd := b1.Devices[0], b1.Devices[1]
+	if !hub.IsHub() || hub.Interfaces[0].Driver != "hub" || len(hub.Devices) != 1 {
+		t.Errorf("hub is %+v", *hub)
+	}
+	if d := hub.Devices[0]; d.LocationID != 0x01420000 || d.Speed != "high_speed" || len(d.Warnings) != 0 {
+		t.Errorf("the stick behind the hub is %+v", *d)
+	}
+	// both interfaces of one device, on a port that does not fit in a
+	// location ID
+	if len(kbd.Interfaces) != 2 || kbd.Interfaces[1].Driver != "" || kbd.Class != 0x03 {
+		t.Errorf("keyboard is %+v", *kbd)
+	}
+	if kbd.Port != 16 || kbd.LocationID != 0x01f00000 {
+		t.Errorf("keyboard is on port %d at %#08x", kbd.Port, kbd.LocationID)
+	}
+	if len(kbd.Warnings) != 1 || !strings.Contains(kbd.Warnings[0], "approximate") {
+		t.Errorf("warnings are %q, want one about the location ID", kbd.Warnings)
+	}
+}
+
+func TestParseLsusbTreeErrors(t *testing.T) {
+	for _, in := range []string{
+		"    |__ Port 3: Dev 2, If 0, Class=Mass Storage, Driver=usb-storage, 5000M\n",
+		"/:  Bus 02.Port 1: Dev 1, Class=root_hub, Driver=xhci_hcd/10p, 5000M\n    |__ something else\n",
+		"garbage\n",
+	} {
+		if _, err := ParseLsusbTree(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseLsusbTree(%q) returned no error", in)
+		}
+	}
+}
+
+func TestParseLsusbVerbose(t *testing.T) {
+	lds, err := ParseLsusbVerbose(strings.NewReader(testLsusbVerbose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lds) != 1 {
+		t.Fatalf("got %d devices, want 1", len(lds))
+	}
+	d := lds[0].Device
+	if lds[0].Bus != 2 || d.Address != 2 || d.VendorID != 0x0781 || d.ProductID != 0x5581 {
+		t.Errorf("got bus %d, device %+v", lds[0].Bus, *d)
+	}
+	if d.USBVersion != "3.20" || d.DeviceVersion != "1.00" || d.Manufacturer != "SanDisk" || d.SerialNumber != "4C530001230512105341" {
+		t.Errorf("got device %+v", *d)
+	}
+	if d.Name != "Ultra  USB 3.0" {
+		t.Errorf("name is %q, the inner blanks must be kept", d.Name)
+	}
+	if len(d.Configs) != 1 {
+		t.Fatalf("got %d configurations, want 1", len(d.Configs))
+	}
+	c := d.Configs[0]
+	if c.Value != 1 || c.Attributes != 0x80 || c.MaxPower != 896 || len(c.Interfaces) != 1 {
+		t.Fatalf("configuration is %+v", *c)
+	}
+	ifc := c.Interfaces[0]
+	if ifc.Class != 8 || ifc.SubClass != 6 || ifc.Protocol != 80 || len(ifc.Endpoints) != 2 {
+		t.Fatalf("interface is %+v", *ifc)
+	}
+	want := []EndpointInfo{{Address: 0x81, Attributes: 2, MaxPacketSize: 1024}, {Address: 0x02, Attributes: 2, MaxPacketSize: 1024}}
+	for i, ep := range ifc.Endpoints {
+		if *ep != want[i] {
+			t.Errorf("endpoint %d is %+v, want %+v", i, *ep, want[i])
+		}
+	}
+}
+
+func TestLsusbTopology(t *testing.T) {
+	runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		switch strings.Join(args, " ") {
+		case "-t":
+			return []byte(testLsusbTree), nil
+		case "-v":
+			return []byte(testLsusbVerbose), nil
+		}
+		t.Errorf("ran %s %q", name, args)
+		return nil, nil
+	})
+	buses, err := LsusbBackend{Runner: runner}.Topology(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := buses[0].Devices[0]
+	if d.Name != "Ultra  USB 3.0" || d.Port != 3 || len(d.Configs) != 1 {
+		t.Fatalf("the stick is %+v", *d)
+	}
+	// the driver comes from the tree, the descriptors from the verbose output
+	if ifc := d.AllInterfaces()[0]; ifc.Driver != "usb-storage" || ifc.SubClass != 6 {
+		t.Errorf("interface is %+v", *ifc)
+	}
+}
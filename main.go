@@ -1,8 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -20,6 +20,16 @@ type VolumeInfo struct {
 	MountPoint string // may not be mounted
 	Free int64 // only availabe if mounted
 	Writable bool // only availabe if mounted
+	MountOptions []string // only availabe if mounted, Linux only
+	DevNum string // "major:minor", Linux only
+	Content string // partition content, e.g. "EFI" or "Microsoft Basic Data"
+	// the following are only available from reading the partition table
+	PartitionNumber int
+	Offset int64
+	PartitionType string // type GUID (GPT) or type byte such as "0x0c" (MBR)
+	PartitionUUID string // GPT only
+	PartitionLabel string // GPT only
+	Attributes uint64 // GPT attribute bits, or the MBR status byte
 }
 
 func (v VolumeInfo) ToString(prefix string) string {
@@ -29,11 +39,29 @@ func (v VolumeInfo) ToString(prefix string) string {
 	fmt.Fprintf(&buf, "%s  Size: %d\n", prefix, v.Size)
 	fmt.Fprintf(&buf, "%s  Filesystem: %s\n", prefix, v.FileSystem)
 	fmt.Fprintf(&buf, "%s  Volume UUID: %s\n", prefix, v.UUID)
+	if v.Content != "" {
+		fmt.Fprintf(&buf, "%s  Content: %s\n", prefix, v.Content)
+	}
+	if v.PartitionType != "" {
+		fmt.Fprintf(&buf, "%s  Partition: #%d at offset %d, type %s\n", prefix, v.PartitionNumber, v.Offset, v.PartitionType)
+		if v.PartitionUUID != "" {
+			fmt.Fprintf(&buf, "%s  Partition UUID: %s\n", prefix, v.PartitionUUID)
+		}
+		if v.PartitionLabel != "" {
+			fmt.Fprintf(&buf, "%s  Partition label: %s\n", prefix, v.PartitionLabel)
+		}
+		if v.Attributes != 0 {
+			fmt.Fprintf(&buf, "%s  Partition attributes: %#x\n", prefix, v.Attributes)
+		}
+	}
 	fmt.Fprintf(&buf, "%s  Mounted: %t\n", prefix, v.Mounted)
 	if v.Mounted {
 		fmt.Fprintf(&buf, "%s  Mount point: %s\n", prefix, v.MountPoint)
 		fmt.Fprintf(&buf, "%s  Free space: %d\n", prefix, v.Free)
 		fmt.Fprintf(&buf, "%s  Writable: %v\n", prefix, v.Writable)
+		if len(v.MountOptions) > 0 {
+			fmt.Fprintf(&buf, "%s  Mount options: %s\n", prefix, strings.Join(v.MountOptions, ","))
+		}
 	}
 	return buf.String()
 }
@@ -47,7 +75,10 @@ type MediaInfo struct {
 	DevName string
 	PartitionName string
 	Size int64
+	DiskID string // GPT disk GUID or MBR disk signature
+	Links []string // /dev/disk/by-* symlinks, Linux only
 	Volumes []*VolumeInfo
+	Boot *BootInfo // only available from boot analysis
 }
 
 func (m MediaInfo) ToString(prefix string) string {
@@ -56,6 +87,12 @@ func (m MediaInfo) ToString(prefix string) string {
 	fmt.Fprintf(&buf, "%s  Device: /dev/%s\n", prefix, m.DevName)
 	fmt.Fprintf(&buf, "%s  Partition: %s\n", prefix, m.PartitionName)
 	fmt.Fprintf(&buf, "%s  Size: %d\n", prefix, m.Size)
+	if m.DiskID != "" {
+		fmt.Fprintf(&buf, "%s  Disk ID: %s\n", prefix, m.DiskID)
+	}
+	for _, l := range m.Links {
+		fmt.Fprintf(&buf, "%s  Link: /dev/%s\n", prefix, l)
+	}
 	if len(m.Volumes) == 0 {
 		fmt.Fprintf(&buf, "%s  Number of Volumes: none\n",  prefix)
 	} else {
@@ -64,6 +101,9 @@ func (m MediaInfo) ToString(prefix string) string {
 	for _, v := range m.Volumes {
 		fmt.Fprintf(&buf, "%s\n", v.ToString(prefix+indent+indent))
 	}
+	if m.Boot != nil {
+		fmt.Fprintf(&buf, "%s", m.Boot.ToString(prefix+indent))
+	}
 	return buf.String()
 }
 
@@ -71,22 +111,151 @@ func (m MediaInfo) String() string {
 	return m.ToString("")
 }
 
+// InterfaceInfo describes one USB interface (alternate setting) of a device.
+type InterfaceInfo struct {
+	Number uint8
+	AlternateSetting uint8
+	Class uint8
+	SubClass uint8
+	Protocol uint8
+	Name string // may be empty
+	Driver string // bound kernel driver, Linux only
+	Endpoints []*EndpointInfo
+}
+
+func (i InterfaceInfo) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sInterface %d", prefix, i.Number)
+	if i.AlternateSetting != 0 {
+		fmt.Fprintf(&buf, " (alt %d)", i.AlternateSetting)
+	}
+	if i.Name != "" {
+		fmt.Fprintf(&buf, " %q", i.Name)
+	}
+	fmt.Fprintf(&buf, ": class %#02x/%#02x/%#02x (%s)", i.Class, i.SubClass, i.Protocol, USBClassName(i.Class))
+	if i.Driver != "" {
+		fmt.Fprintf(&buf, ", driver %s", i.Driver)
+	}
+	fmt.Fprintf(&buf, "\n")
+	for _, e := range i.Endpoints {
+		fmt.Fprintf(&buf, "%s", e.ToString(prefix+indent))
+	}
+	return buf.String()
+}
+
+func (i InterfaceInfo) String() string {
+	return i.ToString("")
+}
+
+// USBClassName returns the name of a USB base class code as assigned by usb.org.
+func USBClassName(class uint8) string {
+	switch class {
+	case 0x00:
+		return "Per Interface"
+	case 0x01:
+		return "Audio"
+	case 0x02:
+		return "Communications"
+	case 0x03:
+		return "HID"
+	case 0x05:
+		return "Physical"
+	case 0x06:
+		return "Image"
+	case 0x07:
+		return "Printer"
+	case 0x08:
+		return "Mass Storage"
+	case 0x09:
+		return "Hub"
+	case 0x0a:
+		return "CDC Data"
+	case 0x0b:
+		return "Smart Card"
+	case 0x0d:
+		return "Content Security"
+	case 0x0e:
+		return "Video"
+	case 0x0f:
+		return "Personal Healthcare"
+	case 0x10:
+		return "Audio/Video"
+	case 0x11:
+		return "Billboard"
+	case 0x12:
+		return "Type-C Bridge"
+	case 0xdc:
+		return "Diagnostic"
+	case 0xe0:
+		return "Wireless"
+	case 0xef:
+		return "Miscellaneous"
+	case 0xfe:
+		return "Application Specific"
+	case 0xff:
+		return "Vendor Specific"
+	}
+	return "Unknown"
+}
+
 type USBInfo struct {
 	Name string
 	ProductID uint16
 	VendorID uint16
 	SerialNumber string
 	Manufacturer string
+	LocationID uint32
+	Speed string // e.g. "high_speed", as reported by system_profiler
+	// the following are only available after merging ioreg data
+	RegistryID uint64
+	PortNum int
+	Class uint8
+	SubClass uint8
+	Protocol uint8
+	Interfaces []*InterfaceInfo
+	Driver string // kernel driver, Linux only
+	Descriptors *USBDescriptors // raw descriptors, if they could be read
 	Media []*MediaInfo
+	Warnings []string // inconsistencies found while merging sources
+	Source string // snapshot the info was read from, if not the live system
 }
 
 func (u USBInfo) ToString(prefix string) string {
 	var buf strings.Builder
 	fmt.Fprintf(&buf, "%sUSB Storage %q:\n", prefix, u.Name)
+	if u.Source != "" {
+		fmt.Fprintf(&buf, "%s  Source: %s\n", prefix, u.Source)
+	}
 	fmt.Fprintf(&buf, "%s  Product ID: %#04x\n", prefix, u.ProductID)
 	fmt.Fprintf(&buf, "%s  Vendor ID: %#04x\n", prefix, u.VendorID)
 	fmt.Fprintf(&buf, "%s  Serial Number: %s\n", prefix, u.SerialNumber)
 	fmt.Fprintf(&buf, "%s  Manufacturer: %s\n", prefix, u.Manufacturer)
+	if u.LocationID != 0 {
+		fmt.Fprintf(&buf, "%s  Location ID: %#08x\n", prefix, u.LocationID)
+	}
+	if u.Speed != "" {
+		fmt.Fprintf(&buf, "%s  Speed: %s\n", prefix, u.Speed)
+	}
+	if u.RegistryID != 0 {
+		fmt.Fprintf(&buf, "%s  Registry ID: %#x\n", prefix, u.RegistryID)
+		fmt.Fprintf(&buf, "%s  Port: %d\n", prefix, u.PortNum)
+	}
+	if u.RegistryID != 0 || u.Descriptors != nil {
+		fmt.Fprintf(&buf, "%s  Device Class: %#02x/%#02x/%#02x (%s)\n",
+			prefix, u.Class, u.SubClass, u.Protocol, USBClassName(u.Class))
+	}
+	for _, i := range u.Interfaces {
+		fmt.Fprintf(&buf, "%s", i.ToString(prefix+indent))
+	}
+	if u.Driver != "" {
+		fmt.Fprintf(&buf, "%s  Driver: %s\n", prefix, u.Driver)
+	}
+	if u.Descriptors != nil {
+		fmt.Fprintf(&buf, "%s  Max Speed: %s\n", prefix, u.Descriptors.MaxSpeed())
+	}
+	for _, w := range u.Warnings {
+		fmt.Fprintf(&buf, "%s  Warning: %s\n", prefix, w)
+	}
 	if len(u.Media) == 0 {
 		fmt.Fprintf(&buf, "%s  Number of Media: none\n", prefix)
 	} else {
@@ -103,7 +272,7 @@ func (u USBInfo) String(prefix string) string {
 }
 
 func GetVolumes(volumes any, path string) ([]*VolumeInfo, error) {
-	fmt.Printf("-> Find Volumes in %s...\n", path)
+	debugf("-> Find Volumes in %s...\n", path)
 	vols, ok := volumes.([]any)
 	if !ok {
 		return nil, fmt.Errorf("%s (%T) is not []interface{} type", path, volumes)
@@ -114,18 +283,24 @@ func GetVolumes(volumes any, path string) ([]*VolumeInfo, error) {
 		if !ok {
 			return nil, fmt.Errorf("%s[%d] (%T) is not map[string]interface{} type", path, i, vol)
 		}
+		devName, err := getString(vMap, "bsd_name", fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		// unformatted volumes have no file system nor UUID
 		vi := &VolumeInfo{
-			Name: vMap["_name"].(string),
-			DevName: vMap["bsd_name"].(string),
-			Size: int64(vMap["size_in_bytes"].(float64)),
-			FileSystem: vMap["file_system"].(string),
-			UUID: vMap["volume_uuid"].(string),
+			Name: optString(vMap, "_name"),
+			DevName: devName,
+			Size: optInt(vMap, "size_in_bytes"),
+			FileSystem: optString(vMap, "file_system"),
+			UUID: optString(vMap, "volume_uuid"),
+			Content: optString(vMap, "iocontent"),
 		}
-		if m, ok := vMap["mount_point"]; ok {
+		if m, ok := vMap["mount_point"].(string); ok {
 			vi.Mounted = true
-			vi.MountPoint = m.(string)
-			vi.Free = int64(vMap["free_space_in_bytes"].(float64))
-			vi.Writable = vMap["writable"].(string) == "yes"
+			vi.MountPoint = m
+			vi.Free = optInt(vMap, "free_space_in_bytes")
+			vi.Writable = optString(vMap, "writable") == "yes"
 		}
 		vis = append(vis, vi)
 	}
@@ -133,7 +308,7 @@ func GetVolumes(volumes any, path string) ([]*VolumeInfo, error) {
 }
 
 func GetMedia(media any, path string) ([]*MediaInfo, error) {
-	fmt.Printf("-> Find Media in %s...\n", path)
+	debugf("-> Find Media in %s...\n", path)
 	ma, ok := media.([]any)
 	if !ok {
 		return nil, fmt.Errorf("%s (%T) is not []interface{} type", path, media)
@@ -144,11 +319,15 @@ func GetMedia(media any, path string) ([]*MediaInfo, error) {
 		if !ok {
 			return nil, fmt.Errorf("%s[%d] (%T) is not map[string]interface{} type", path, i, m)
 		}
+		devName, err := getString(mi, "bsd_name", fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
 		mii := &MediaInfo{
-			Name: mi["_name"].(string),
-			DevName: mi["bsd_name"].(string),
-			PartitionName: mi["partition_map_type"].(string),
-			Size: int64(mi["size_in_bytes"].(float64)),
+			Name: optString(mi, "_name"),
+			DevName: devName,
+			PartitionName: optString(mi, "partition_map_type"),
+			Size: optInt(mi, "size_in_bytes"),
 		}
 		it, ok := mi["volumes"]
 		if !ok {
@@ -165,8 +344,109 @@ func GetMedia(media any, path string) ([]*MediaInfo, error) {
 	return mis, nil
 }
 
+// GetUSBInfo parses a USB storage item, i.e. one with a Media entry.
+func GetUSBInfo(itemMap map[string]any, path string) (*USBInfo, error) {
+	usbInfo := &USBInfo{
+		Name: optString(itemMap, "_name"),
+		SerialNumber: optString(itemMap, "serial_num"),
+		Manufacturer: optString(itemMap, "manufacturer"),
+	}
+	s, err := getString(itemMap, "product_id", path)
+	if err != nil {
+		return nil, err
+	}
+	val, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s[product_id] (%s): %w", path, s, err)
+	}
+	usbInfo.ProductID = uint16(val)
+	if s, err = getString(itemMap, "vendor_id", path); err != nil {
+		return nil, err
+	}
+	usbInfo.VendorID, err = parseVendorID(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s[vendor_id] (%s): %w", path, s, err)
+	}
+	if s, ok := itemMap["location_id"].(string); ok {
+		usbInfo.LocationID, _, err = parseLocationID(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s[location_id] (%s): %w", path, s, err)
+		}
+	}
+	if s, ok := itemMap["device_speed"].(string); ok {
+		usbInfo.Speed = s
+	}
+
+	it := itemMap["Media"]
+	mi, err := GetMedia(it, fmt.Sprintf("%s[Media]", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s[Media]: %w", path, err)
+	}
+	if len(mi) > 0 {
+		usbInfo.Media = mi
+	}
+	return usbInfo, nil
+}
+
+// getString returns a required string entry of a system_profiler item.
+func getString(m map[string]any, key, path string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("%s missing %s entry", path, key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s[%s] (%T) is not string type", path, key, v)
+	}
+	return s, nil
+}
+
+// optString returns an optional string entry, or "" if it is missing.
+func optString(m map[string]any, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// optInt returns an optional number entry, or 0 if it is missing. Numbers
+// are float64 from JSON and int64 from plists.
+func optInt(m map[string]any, key string) int64 {
+	v, _ := plistUint(m[key])
+	return int64(v)
+}
+
+// parseVendorID parses a system_profiler vendor ID such as
+// "0x1f75  (Innostor Co., Ltd.)" or "apple_vendor_id".
+func parseVendorID(s string) (uint16, error) {
+	if s == "apple_vendor_id" {
+		return 0x05ac, nil
+	}
+	fields := strings.SplitN(s, " ", 2)
+	val, err := strconv.ParseUint(fields[0], 0, 16)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(val), nil
+}
+
+// parseLocationID parses a system_profiler location ID such as
+// "0x40110000 / 5": the location ID followed by the device address.
+func parseLocationID(s string) (uint32, int, error) {
+	loc, addr, _ := strings.Cut(s, "/")
+	val, err := strconv.ParseUint(strings.TrimSpace(loc), 0, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	a := 0
+	if addr = strings.TrimSpace(addr); addr != "" {
+		if a, err = strconv.Atoi(addr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return uint32(val), a, nil
+}
+
 func FindInItems(items any, path string) ([]*USBInfo, error) {
-	fmt.Printf("-> Find Items in %s...\n", path)
+	debugf("-> Find Items in %s...\n", path)
 	ita, ok := items.([]any)
 	if !ok {
 		return nil, fmt.Errorf("%s (%T) is not []interface{} type", path, items)
@@ -186,36 +466,12 @@ func FindInItems(items any, path string) ([]*USBInfo, error) {
 			}
 			uis = append(uis, ui...)
 		}
-		it, ok = itemMap["Media"]
-		if !ok {
+		if _, ok := itemMap["Media"]; !ok {
 			continue
 		}
-
-		usbInfo := &USBInfo{
-			Name: itemMap["_name"].(string),
-			SerialNumber: itemMap["serial_num"].(string),
-			Manufacturer: itemMap["manufacturer"].(string),
-		}
-		s := itemMap["product_id"].(string)
-		val, err := strconv.ParseUint(s, 0, 16)
+		usbInfo, err := GetUSBInfo(itemMap, fmt.Sprintf("%s[%d]", path, i))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse %s[%d][product_id] (%s): %w", path, i, s, err)
-		}
-		usbInfo.ProductID = uint16(val)
-		s = itemMap["vendor_id"].(string)
-		fields := strings.SplitN(s, " ", 2)
-		val, err = strconv.ParseUint(fields[0], 0, 16)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse %s[%d][vendor_id] (%s): %w", path, i, fields[0], err)
-		}
-		usbInfo.VendorID = uint16(val)
-		
-		mi, err := GetMedia(it, fmt.Sprintf("%s[%d][Media]", path, i))
-		if err != nil {
-			return nil, fmt.Errorf("failed to get %s[%d][Media]: %w", path, i, err)
-		}
-		if len(mi) > 0 {
-			usbInfo.Media = mi
+			return nil, err
 		}
 		uis = append(uis, usbInfo)
 	}
@@ -223,7 +479,7 @@ func FindInItems(items any, path string) ([]*USBInfo, error) {
 }
 
 func FindUSBStickInfo(data any) ([]*USBInfo, error) {
-	fmt.Printf("Find USB stick info...\n")
+	debugf("Find USB stick info...\n")
 	d, ok := data.(map[string]any)
 	if !ok {
 		return nil, fmt.Errorf("data (%T) is not map[string]interface{} type", data)
@@ -251,779 +507,10 @@ func FindUSBStickInfo(data any) ([]*USBInfo, error) {
 			uis = append(uis, ui...)
 		}
 	}
-	fmt.Printf("Done finding USB stick info.\n")
+	debugf("Done finding USB stick info.\n")
 	return uis, nil
 }
 
 func main() {
-	data := []string{noPartition, GPTPartitioned, MBRPartitioned}
-
-	for i, d := range data {
-		var jd any
-		if err := json.Unmarshal([]byte(d), &jd); err != nil {
-			fmt.Printf("ERROR: Failed to unmarshal JSON data[%d]: %+v\n", i, err)
-			return
-		}
-		uis, err := FindUSBStickInfo(jd)
-		if err != nil {
-			fmt.Printf(
-				"ERROR: Failed to find USB stick info[%d]: %+v\n", i, err)
-		}
-		for i, ui := range uis {
-			fmt.Printf("USB Storages[%d/%d]:\n", i+1, len(uis))
-			fmt.Printf("%s\n", ui.ToString(indent))
-		}
-	}
+	os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
 }
-
-const (
-	// Un-partitoned USB stick:
-	noPartition = `{
-		"SPUSBDataType" : [
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_name" : "YubiKey OTP+FIDO+CCID",
-						"bcd_device" : "5.43",
-						"bus_power" : "500",
-						"bus_power_used" : "30",
-						"device_speed" : "full_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x00100000 / 1",
-						"manufacturer" : "Yubico",
-						"product_id" : "0x0407",
-						"vendor_id" : "0x1050"
-					}
-				],
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_items" : [
-									{
-										"_name" : "LG UltraFine Display Camera",
-										"bcd_device" : "1.13",
-										"bus_power" : "900",
-										"bus_power_used" : "96",
-										"device_speed" : "super_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03543000 / 8",
-										"manufacturer" : "LG Electronlcs Inc.",
-										"product_id" : "0x9a4d",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "900",
-								"bus_power_used" : "0",
-								"device_speed" : "super_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03540000 / 3",
-								"product_id" : "0x9a00",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB3.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "900",
-						"bus_power_used" : "0",
-						"device_speed" : "super_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03500000 / 1",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a44",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					},
-					{
-						"_items" : [
-							{
-								"_name" : "Magic Keyboard",
-								"bcd_device" : "4.20",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "1000",
-								"location_id" : "0x03120000 / 5",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x029c",
-								"serial_num" : "F0T2534RK0212HXAT",
-								"sleep_current" : "1500",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_items" : [
-									{
-										"_name" : "USB Controls",
-										"bcd_device" : "3.04",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "full_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03142000 / 7",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a40",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									},
-									{
-										"_name" : "USB Audio",
-										"bcd_device" : "0.1e",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "high_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03141000 / 6",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a4b",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "500",
-								"bus_power_used" : "0",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03140000 / 4",
-								"product_id" : "0x9a02",
-								"serial_num" : "610C00596BFB",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB2.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03100000 / 2",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a46",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					}
-				],
-				"_name" : "USB30Bus",
-				"host_controller" : "AppleUSBXHCIFL1100",
-				"pci_device" : "0x1100 ",
-				"pci_revision" : "0x0010 ",
-				"pci_vendor" : "0x1b73 "
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_name" : "Apple Thunderbolt Display",
-								"bcd_device" : "1.39",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40170000 / 3",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x9227",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "FaceTime HD Camera (Display)",
-								"bcd_device" : "71.60",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40150000 / 2",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1112",
-								"serial_num" : "CC2D3C067PDJ9FLP",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "Display Audio",
-								"bcd_device" : "2.09",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40140000 / 4",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1107",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "PenDrive",
-								"bcd_device" : "0.01",
-								"bus_power" : "500",
-								"bus_power_used" : "200",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40120000 / 5",
-								"manufacturer" : "Innostor",
-								"Media" : [
-									{
-										"_name" : "Innostor",
-										"bsd_name" : "disk5",
-										"Logical Unit" : 0,
-										"partition_map_type" : "unknown_partition_map_type",
-										"removable_media" : "yes",
-										"size" : "63.91 GB",
-										"size_in_bytes" : 63909113344,
-										"smart_status" : "Verified",
-										"USB Interface" : 0
-									}
-								],
-								"product_id" : "0x0917",
-								"serial_num" : "000000000000005309",
-								"vendor_id" : "0x1f75  (Innostor Co., Ltd.)"
-							}
-						],
-						"_name" : "hub_device",
-						"bcd_device" : "1.00",
-						"Built-in_Device" : "Yes",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x40100000 / 1",
-						"product_id" : "0x9127",
-						"vendor_id" : "apple_vendor_id"
-					}
-				],
-				"_name" : "USB20Bus",
-				"host_controller" : "AppleUSBEHCIPI7C9X440SL",
-				"pci_device" : "0x400f ",
-				"pci_revision" : "0x0003 ",
-				"pci_vendor" : "0x12d8 "
-			}
-		]
-	}`
-
-	// GPT partitoned USB stick:
-	GPTPartitioned = `{
-		"SPUSBDataType" : [
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_name" : "YubiKey OTP+FIDO+CCID",
-						"bcd_device" : "5.43",
-						"bus_power" : "500",
-						"bus_power_used" : "30",
-						"device_speed" : "full_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x00100000 / 1",
-						"manufacturer" : "Yubico",
-						"product_id" : "0x0407",
-						"vendor_id" : "0x1050"
-					}
-				],
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_items" : [
-									{
-										"_name" : "LG UltraFine Display Camera",
-										"bcd_device" : "1.13",
-										"bus_power" : "900",
-										"bus_power_used" : "96",
-										"device_speed" : "super_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03543000 / 8",
-										"manufacturer" : "LG Electronlcs Inc.",
-										"product_id" : "0x9a4d",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "900",
-								"bus_power_used" : "0",
-								"device_speed" : "super_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03540000 / 3",
-								"product_id" : "0x9a00",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB3.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "900",
-						"bus_power_used" : "0",
-						"device_speed" : "super_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03500000 / 1",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a44",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					},
-					{
-						"_items" : [
-							{
-								"_name" : "Magic Keyboard",
-								"bcd_device" : "4.20",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "1000",
-								"location_id" : "0x03120000 / 5",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x029c",
-								"serial_num" : "F0T2534RK0212HXAT",
-								"sleep_current" : "1500",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_items" : [
-									{
-										"_name" : "USB Controls",
-										"bcd_device" : "3.04",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "full_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03142000 / 7",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a40",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									},
-									{
-										"_name" : "USB Audio",
-										"bcd_device" : "0.1e",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "high_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03141000 / 6",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a4b",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "500",
-								"bus_power_used" : "0",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03140000 / 4",
-								"product_id" : "0x9a02",
-								"serial_num" : "610C00596BFB",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB2.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03100000 / 2",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a46",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					}
-				],
-				"_name" : "USB30Bus",
-				"host_controller" : "AppleUSBXHCIFL1100",
-				"pci_device" : "0x1100 ",
-				"pci_revision" : "0x0010 ",
-				"pci_vendor" : "0x1b73 "
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_name" : "Apple Thunderbolt Display",
-								"bcd_device" : "1.39",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40170000 / 3",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x9227",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "FaceTime HD Camera (Display)",
-								"bcd_device" : "71.60",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40150000 / 2",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1112",
-								"serial_num" : "CC2D3C067PDJ9FLP",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "Display Audio",
-								"bcd_device" : "2.09",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40140000 / 4",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1107",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "PenDrive",
-								"bcd_device" : "0.01",
-								"bus_power" : "500",
-								"bus_power_used" : "200",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40110000 / 5",
-								"manufacturer" : "Innostor",
-								"Media" : [
-									{
-										"_name" : "Innostor",
-										"bsd_name" : "disk5",
-										"Logical Unit" : 0,
-										"partition_map_type" : "guid_partition_map_type",
-										"removable_media" : "yes",
-										"size" : "63.91 GB",
-										"size_in_bytes" : 63909113344,
-										"smart_status" : "Verified",
-										"USB Interface" : 0,
-										"volumes" : [
-											{
-												"_name" : "EFI",
-												"bsd_name" : "disk5s1",
-												"file_system" : "MS-DOS FAT32",
-												"iocontent" : "EFI",
-												"size" : "209.7 MB",
-												"size_in_bytes" : 209715200,
-												"volume_uuid" : "0E239BC6-F960-3107-89CF-1C97F78BB46B"
-											},
-											{
-												"_name" : "OEL9",
-												"bsd_name" : "disk5s2",
-												"file_system" : "MS-DOS FAT32",
-												"free_space" : "62.49 GB",
-												"free_space_in_bytes" : 62491787264,
-												"iocontent" : "Microsoft Basic Data",
-												"mount_point" : "/Volumes/OEL9",
-												"size" : "63.7 GB",
-												"size_in_bytes" : 63697846272,
-												"volume_uuid" : "6ABA678A-0FF6-3876-83B7-FE44B24110EB",
-												"writable" : "yes"
-											}
-										]
-									}
-								],
-								"product_id" : "0x0917",
-								"serial_num" : "000000000000004010",
-								"vendor_id" : "0x1f75  (Innostor Co., Ltd.)"
-							}
-						],
-						"_name" : "hub_device",
-						"bcd_device" : "1.00",
-						"Built-in_Device" : "Yes",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x40100000 / 1",
-						"product_id" : "0x9127",
-						"vendor_id" : "apple_vendor_id"
-					}
-				],
-				"_name" : "USB20Bus",
-				"host_controller" : "AppleUSBEHCIPI7C9X440SL",
-				"pci_device" : "0x400f ",
-				"pci_revision" : "0x0003 ",
-				"pci_vendor" : "0x12d8 "
-			}
-		]
-	}`
-
-	// MBR partitioned USB Stick:
-	MBRPartitioned = `{
-		"SPUSBDataType" : [
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_name" : "YubiKey OTP+FIDO+CCID",
-						"bcd_device" : "5.43",
-						"bus_power" : "500",
-						"bus_power_used" : "30",
-						"device_speed" : "full_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x00100000 / 1",
-						"manufacturer" : "Yubico",
-						"product_id" : "0x0407",
-						"vendor_id" : "0x1050"
-					}
-				],
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_name" : "USB31Bus",
-				"host_controller" : "AppleT6000USBXHCI"
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_items" : [
-									{
-										"_name" : "LG UltraFine Display Camera",
-										"bcd_device" : "1.13",
-										"bus_power" : "900",
-										"bus_power_used" : "96",
-										"device_speed" : "super_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03543000 / 8",
-										"manufacturer" : "LG Electronlcs Inc.",
-										"product_id" : "0x9a4d",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "900",
-								"bus_power_used" : "0",
-								"device_speed" : "super_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03540000 / 3",
-								"product_id" : "0x9a00",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB3.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "900",
-						"bus_power_used" : "0",
-						"device_speed" : "super_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03500000 / 1",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a44",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					},
-					{
-						"_items" : [
-							{
-								"_name" : "Magic Keyboard",
-								"bcd_device" : "4.20",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "1000",
-								"location_id" : "0x03120000 / 5",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x029c",
-								"serial_num" : "F0T2534RK0212HXAT",
-								"sleep_current" : "1500",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_items" : [
-									{
-										"_name" : "USB Controls",
-										"bcd_device" : "3.04",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "full_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03142000 / 7",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a40",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									},
-									{
-										"_name" : "USB Audio",
-										"bcd_device" : "0.1e",
-										"bus_power" : "500",
-										"bus_power_used" : "0",
-										"device_speed" : "high_speed",
-										"extra_current_used" : "0",
-										"location_id" : "0x03141000 / 6",
-										"manufacturer" : "LG Electronics Inc.",
-										"product_id" : "0x9a4b",
-										"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-									}
-								],
-								"_name" : "hub_device",
-								"bcd_device" : "1.00",
-								"bus_power" : "500",
-								"bus_power_used" : "0",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x03140000 / 4",
-								"product_id" : "0x9a02",
-								"serial_num" : "610C00596BFB",
-								"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-							}
-						],
-						"_name" : "USB2.1 Hub",
-						"bcd_device" : "52.35",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x03100000 / 2",
-						"manufacturer" : "LG Electronics Inc.",
-						"product_id" : "0x9a46",
-						"vendor_id" : "0x043e  (LG Electronics USA Inc.)"
-					}
-				],
-				"_name" : "USB30Bus",
-				"host_controller" : "AppleUSBXHCIFL1100",
-				"pci_device" : "0x1100 ",
-				"pci_revision" : "0x0010 ",
-				"pci_vendor" : "0x1b73 "
-			},
-			{
-				"_items" : [
-					{
-						"_items" : [
-							{
-								"_name" : "Apple Thunderbolt Display",
-								"bcd_device" : "1.39",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40170000 / 3",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x9227",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "FaceTime HD Camera (Display)",
-								"bcd_device" : "71.60",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "500",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40150000 / 2",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1112",
-								"serial_num" : "CC2D3C067PDJ9FLP",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "Display Audio",
-								"bcd_device" : "2.09",
-								"Built-in_Device" : "Yes",
-								"bus_power" : "500",
-								"bus_power_used" : "2",
-								"device_speed" : "full_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40140000 / 4",
-								"manufacturer" : "Apple Inc.",
-								"product_id" : "0x1107",
-								"serial_num" : "182F0F36",
-								"vendor_id" : "apple_vendor_id"
-							},
-							{
-								"_name" : "Flash Disk",
-								"bcd_device" : "1.09",
-								"bus_power" : "500",
-								"bus_power_used" : "200",
-								"device_speed" : "high_speed",
-								"extra_current_used" : "0",
-								"location_id" : "0x40110000 / 5",
-								"manufacturer" : "USB",
-								"Media" : [
-									{
-										"_name" : "Flash Disk",
-										"bsd_name" : "disk5",
-										"Logical Unit" : 0,
-										"partition_map_type" : "master_boot_record_partition_map_type",
-										"removable_media" : "yes",
-										"size" : "1.93 GB",
-										"size_in_bytes" : 1930428416,
-										"smart_status" : "Verified",
-										"USB Interface" : 0,
-										"volumes" : [
-											{
-												"_name" : "TEST",
-												"bsd_name" : "disk5s1",
-												"file_system" : "MS-DOS FAT16",
-												"free_space" : "1.93 GB",
-												"free_space_in_bytes" : 1926168576,
-												"iocontent" : "DOS_FAT_16",
-												"mount_point" : "/Volumes/TEST",
-												"size" : "1.93 GB",
-												"size_in_bytes" : 1929379840,
-												"volume_uuid" : "182684DE-533E-394C-A563-1D491C94108A",
-												"writable" : "yes"
-											}
-										]
-									}
-								],
-								"product_id" : "0x6387",
-								"serial_num" : "59402D7A",
-								"vendor_id" : "0x058f  (Alcor Micro, Corp.)"
-							}
-						],
-						"_name" : "hub_device",
-						"bcd_device" : "1.00",
-						"Built-in_Device" : "Yes",
-						"bus_power" : "500",
-						"bus_power_used" : "100",
-						"device_speed" : "high_speed",
-						"extra_current_used" : "0",
-						"location_id" : "0x40100000 / 1",
-						"product_id" : "0x9127",
-						"vendor_id" : "apple_vendor_id"
-					}
-				],
-				"_name" : "USB20Bus",
-				"host_controller" : "AppleUSBEHCIPI7C9X440SL",
-				"pci_device" : "0x400f ",
-				"pci_revision" : "0x0003 ",
-				"pci_vendor" : "0x12d8 "
-			}
-		]
-	}`
-)
\ No newline at end of file
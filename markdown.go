@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeMarkdownReport writes the report as GitHub-flavored Markdown, for
+// pasting into tickets and wikis: a section per stick with tables of its
+// media and volumes, then the diagnostics.
+func writeMarkdownReport(w io.Writer, r *Report) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# %s\n\n", mdEscape(r.Title))
+	sources := make([]string, len(r.Sources))
+	for i, s := range r.Sources {
+		sources[i] = mdEscape(s)
+	}
+	fmt.Fprintf(&buf, "Generated %s from %s. %s, %s.\n",
+		r.Generated.Format("2006-01-02 15:04:05 MST"), strings.Join(sources, ", "),
+		plural(len(r.Sticks), "USB stick"), plural(len(r.Warnings), "warning"))
+	for _, ui := range r.Sticks {
+		writeMarkdownStick(&buf, ui)
+	}
+
+	buf.WriteString("\n## Diagnostics\n\n")
+	if len(r.Warnings) == 0 {
+		buf.WriteString("No problems found.\n")
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(&buf, "- **%s**: %s\n", mdEscape(w.Subject), mdEscape(w.Message))
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func writeMarkdownStick(buf *strings.Builder, ui *USBInfo) {
+	fmt.Fprintf(buf, "\n## %s\n\n", mdEscape(stickLabel(ui)))
+	props := [][]string{
+		{"Vendor and product ID", fmt.Sprintf("%04x:%04x", ui.VendorID, ui.ProductID)},
+		{"Manufacturer", orDash(ui.Manufacturer)},
+		{"Serial number", orDash(ui.SerialNumber)},
+		{"Speed", orDash(ui.Speed)},
+	}
+	if ui.LocationID != 0 {
+		props = append(props, []string{"Location ID", fmt.Sprintf("%#08x", ui.LocationID)})
+	}
+	if ui.Driver != "" {
+		props = append(props, []string{"Driver", ui.Driver})
+	}
+	if ui.Source != "" {
+		props = append(props, []string{"Source", ui.Source})
+	}
+	writeMarkdownTable(buf, []string{"Property", "Value"}, nil, props)
+
+	if len(ui.Media) == 0 {
+		buf.WriteString("\nNo media.\n")
+		return
+	}
+	buf.WriteString("\n### Media\n\n")
+	var rows, vrows [][]string
+	for _, mi := range ui.Media {
+		boot := "no"
+		if mi.Boot == nil {
+			boot = "-"
+		} else if mi.Boot.Bootable() {
+			boot = "yes"
+		}
+		rows = append(rows, []string{mi.DevName, humanSize(mi.Size), orDash(mi.PartitionName), orDash(mi.DiskID), boot})
+		for _, vi := range mi.Volumes {
+			used, mount := "-", "not mounted"
+			if vi.Mounted {
+				used = fmt.Sprintf("%d%%", usedPercent(vi))
+				mount = vi.MountPoint
+				if !vi.Writable {
+					mount += " (read-only)"
+				}
+			}
+			vrows = append(vrows, []string{vi.DevName, orDash(vi.Name), orDash(vi.FileSystem),
+				humanSize(vi.Size), used, mount, orDash(vi.UUID)})
+		}
+	}
+	writeMarkdownTable(buf, []string{"Disk", "Size", "Partition map", "Disk ID", "Bootable"}, []bool{false, true}, rows)
+	if len(vrows) == 0 {
+		return
+	}
+	buf.WriteString("\n### Volumes\n\n")
+	writeMarkdownTable(buf, []string{"Volume", "Name", "File system", "Size", "Used", "Mount point", "UUID"},
+		[]bool{false, false, false, true, true}, vrows)
+}
+
+// writeMarkdownTable writes a GitHub-flavored table; right holds the
+// columns to right-align, by index.
+func writeMarkdownTable(buf *strings.Builder, header []string, right []bool, rows [][]string) {
+	buf.WriteString("|")
+	for _, h := range header {
+		buf.WriteString(" " + mdEscape(h) + " |")
+	}
+	buf.WriteString("\n|")
+	for i := range header {
+		if i < len(right) && right[i] {
+			buf.WriteString("---:|")
+		} else {
+			buf.WriteString("---|")
+		}
+	}
+	buf.WriteString("\n")
+	for _, row := range rows {
+		buf.WriteString("|")
+		for _, cell := range row {
+			buf.WriteString(" " + mdEscape(cell) + " |")
+		}
+		buf.WriteString("\n")
+	}
+}
+
+// mdEscape escapes what Markdown would take for formatting, including the
+// pipes that end table cells, and folds line breaks into spaces.
+func mdEscape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`",
+		"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+		"\r\n", " ", "\n", " ", "\r", " ")
+	return r.Replace(s)
+}
+
+// plural formats a count with a noun, adding an s unless there is one.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteMarkdownReport(t *testing.T) {
+	ui := &USBInfo{
+		Name: "Stick | Pro", VendorID: 0x1f75, ProductID: 0x0917, SerialNumber: "4010",
+		Manufacturer: "Innostor_Tech", Speed: "high_speed", LocationID: 0x40110000, Source: "mac*1.json",
+		Media: []*MediaInfo{{
+			DevName: "disk5", Size: 63909113344, PartitionName: "guid_partition_map_type",
+			Boot: &BootInfo{},
+			Volumes: []*VolumeInfo{
+				{DevName: "disk5s1", Name: "EFI", Size: 209715200, FileSystem: "MS-DOS FAT32", UUID: "0E23-9BC6"},
+				{DevName: "disk5s2", Name: "A|B", Size: 1000000000, FileSystem: "ExFAT",
+					Mounted: true, MountPoint: "/Volumes/A|B", Free: 50000000},
+			},
+		}},
+	}
+	bare := &USBInfo{Name: "Reader", VendorID: 0x058f, ProductID: 0x6387, Source: "mac*1.json"}
+	r := newReport("Lab <inventory>", []*USBInfo{ui, bare}, nil)
+	r.Generated = time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+	r.warn("discovery", "line one\nline two")
+
+	var buf bytes.Buffer
+	if err := writeMarkdownReport(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Lab \<inventory\>
+
+Generated 2024-03-05 14:07:00 UTC from mac\*1.json. 2 USB sticks, 2 warnings.
+
+## Stick \| Pro (1f75:0917/4010)
+
+| Property | Value |
+|---|---|
+| Vendor and product ID | 1f75:0917 |
+| Manufacturer | Innostor\_Tech |
+| Serial number | 4010 |
+| Speed | high\_speed |
+| Location ID | 0x40110000 |
+| Source | mac\*1.json |
+
+### Media
+
+| Disk | Size | Partition map | Disk ID | Bootable |
+|---|---:|---|---|---|
+| disk5 | 63.9 GB | guid\_partition\_map\_type | - | no |
+
+### Volumes
+
+| Volume | Name | File system | Size | Used | Mount point | UUID |
+|---|---|---|---:|---:|---|---|
+| disk5s1 | EFI | MS-DOS FAT32 | 209.7 MB | - | not mounted | 0E23-9BC6 |
+| disk5s2 | A\|B | ExFAT | 1.0 GB | 95% | /Volumes/A\|B (read-only) | - |
+
+## Reader (058f:6387)
+
+| Property | Value |
+|---|---|
+| Vendor and product ID | 058f:6387 |
+| Manufacturer | - |
+| Serial number | - |
+| Speed | - |
+| Source | mac\*1.json |
+
+No media.
+
+## Diagnostics
+
+- **disk5s2 (A\|B)**: 95% full, 50.0 MB free
+- **discovery**: line one line two
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestMdEscape(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{"a|b", `a\|b`},
+		{`c:\tmp`, `c:\\tmp`},
+		{"*bold* _it_ `code`", "\\*bold\\* \\_it\\_ \\`code\\`"},
+		{"[x](y) <b> #1", `\[x\](y) \<b\> \#1`},
+		{"one\ntwo\r\nthree", "one two three"},
+	}
+	for _, tt := range tests {
+		if got := mdEscape(tt.in); got != tt.want {
+			t.Errorf("mdEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
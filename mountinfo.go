@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MountEntry is one line of /proc/<pid>/mountinfo.
+type MountEntry struct {
+	ID           int
+	ParentID     int
+	DevNum       string // "major:minor"
+	Root         string
+	MountPoint   string
+	Options      []string // per-mount options
+	FSType       string
+	Source       string
+	SuperOptions []string // per-superblock options
+}
+
+// ReadOnly tells whether the mount or its superblock is mounted read-only.
+func (m MountEntry) ReadOnly() bool {
+	for _, opts := range [][]string{m.Options, m.SuperOptions} {
+		for _, o := range opts {
+			if o == "ro" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseMountInfo parses the mountinfo format described in proc(5):
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func ParseMountInfo(r io.Reader) ([]*MountEntry, error) {
+	mes := make([]*MountEntry, 0)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || len(fields) < sep+3 {
+			return nil, fmt.Errorf("mountinfo line %d is malformed: %q", n, line)
+		}
+		me := &MountEntry{
+			DevNum:     fields[2],
+			Root:       unescapeMountInfo(fields[3]),
+			MountPoint: unescapeMountInfo(fields[4]),
+			Options:    strings.Split(fields[5], ","),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountInfo(fields[sep+2]),
+		}
+		if len(fields) > sep+3 {
+			me.SuperOptions = strings.Split(fields[sep+3], ",")
+		}
+		var err error
+		if me.ID, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse mount ID on mountinfo line %d: %w", n, err)
+		}
+		if me.ParentID, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, fmt.Errorf("failed to parse parent ID on mountinfo line %d: %w", n, err)
+		}
+		mes = append(mes, me)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+	return mes, nil
+}
+
+// unescapeMountInfo decodes the octal escapes (\040 for space etc.) the
+// kernel uses in mountinfo paths.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// MountEnricher fills in the mount state of volumes found by the Linux
+// backends from the mount table and statfs(2).
+type MountEnricher struct {
+	// MountInfoPath defaults to /proc/self/mountinfo.
+	MountInfoPath string
+	// Statfs returns the free bytes available to unprivileged users and the
+	// read-only flag of a mounted file system; nil means statfs(2).
+	Statfs func(path string) (free int64, readOnly bool, err error)
+}
+
+// Enrich matches mounts to volumes by device number, UUID or device name and
+// updates Mounted, MountPoint, MountOptions, Free and Writable. A mount
+// point that statfs fails on is reported in the device's warnings.
+func (e MountEnricher) Enrich(ctx context.Context, uis []*USBInfo) error {
+	path := e.MountInfoPath
+	if path == "" {
+		path = "/proc/self/mountinfo"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open mount table: %w", err)
+	}
+	defer f.Close()
+	mes, err := ParseMountInfo(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	statfs := e.Statfs
+	if statfs == nil {
+		statfs = statfsFree
+	}
+
+	for _, ui := range uis {
+		for _, mi := range ui.Media {
+			for _, vi := range mi.Volumes {
+				me := findMount(mes, vi)
+				if me == nil {
+					continue
+				}
+				vi.Mounted = true
+				vi.MountPoint = me.MountPoint
+				vi.MountOptions = me.Options
+				vi.Writable = !me.ReadOnly()
+				// a stale network or FUSE mount must not cost the others
+				free, ro, err := statfs(me.MountPoint)
+				if err != nil {
+					ui.Warnings = append(ui.Warnings, fmt.Sprintf("failed to statfs %s: %v", me.MountPoint, err))
+					continue
+				}
+				vi.Free = free
+				vi.Writable = vi.Writable && !ro
+			}
+		}
+	}
+	return nil
+}
+
+// findMount returns the first mount of a volume's file system root; bind
+// mounts of subdirectories are skipped.
+func findMount(mes []*MountEntry, vi *VolumeInfo) *MountEntry {
+	for _, me := range mes {
+		if me.Root != "/" {
+			continue
+		}
+		switch {
+		case vi.DevNum != "" && me.DevNum == vi.DevNum:
+			return me
+		case vi.UUID != "" && (me.Source == "UUID="+vi.UUID ||
+			me.Source == filepath.Join("/dev/disk/by-uuid", vi.UUID)):
+			return me
+		case vi.DevName != "" && me.Source == filepath.Join("/dev", vi.DevName):
+			return me
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testMountInfo = `22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw
+40 22 8:17 / /media/alice/DATA rw,nosuid,nodev,relatime shared:2 - vfat /dev/sdb1 rw,fmask=0022
+41 22 8:18 / /media/alice/My\040Files ro,nosuid shared:3 - exfat /dev/sdb2 rw
+42 22 8:17 /photos /srv/photos rw shared:2 - vfat /dev/sdb1 rw
+`
+
+func TestMountEnricher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(path, []byte(testMountInfo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sdb1 := &VolumeInfo{DevName: "sdb1", DevNum: "8:17"}
+	sdb2 := &VolumeInfo{DevName: "sdb2", DevNum: "8:18"}
+	sdb3 := &VolumeInfo{DevName: "sdb3", DevNum: "8:19"}
+	ui := &USBInfo{Media: []*MediaInfo{{DevName: "sdb", Volumes: []*VolumeInfo{sdb1, sdb2, sdb3}}}}
+	e := MountEnricher{
+		MountInfoPath: path,
+		Statfs: func(p string) (int64, bool, error) {
+			if p == "/media/alice/DATA" {
+				return 1 << 30, false, nil
+			}
+			return 0, false, errors.New("transport endpoint is not connected")
+		},
+	}
+	if err := e.Enrich(context.Background(), []*USBInfo{ui}); err != nil {
+		t.Fatal(err)
+	}
+	if !sdb1.Mounted || sdb1.MountPoint != "/media/alice/DATA" || sdb1.Free != 1<<30 || !sdb1.Writable {
+		t.Errorf("sdb1 is %+v", sdb1)
+	}
+	// mounted read-only, and statfs failing is a warning, not an error
+	if !sdb2.Mounted || sdb2.MountPoint != "/media/alice/My Files" || sdb2.Writable {
+		t.Errorf("sdb2 is %+v", sdb2)
+	}
+	if sdb3.Mounted {
+		t.Errorf("sdb3 is mounted at %q", sdb3.MountPoint)
+	}
+	if len(ui.Warnings) != 1 {
+		t.Errorf("warnings are %q, want one about statfs", ui.Warnings)
+	}
+}
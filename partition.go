@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// Partition is one entry of an MBR or GPT partition table.
+type Partition struct {
+	Number     int // 1-4 primary, 5+ logical (MBR); entry index + 1 (GPT)
+	Offset     int64
+	Size       int64
+	Type       string // type GUID (GPT) or type byte such as "0x0c" (MBR)
+	TypeName   string // e.g. "EFI", "Microsoft Basic Data"
+	UUID       string // GPT only
+	Name       string // GPT only
+	Attributes uint64 // GPT attribute bits, or the MBR status byte
+}
+
+// Bootable tells whether a partition is marked active (MBR) or legacy BIOS
+// bootable (GPT attribute bit 2).
+func (p Partition) Bootable() bool {
+	if strings.HasPrefix(p.Type, "0x") {
+		return p.Attributes&0x80 != 0
+	}
+	return p.Attributes&0x04 != 0
+}
+
+// PartitionTable is the partition table read from a disk or image.
+type PartitionTable struct {
+	Scheme     string // "gpt" or "dos", as blkid names them
+	DiskID     string // GPT disk GUID or MBR disk signature
+	SectorSize int
+	Partitions []*Partition
+	Warnings   []string // recoverable inconsistencies, e.g. a bad backup GPT
+}
+
+// gptTypes names the common GPT partition types like system_profiler's
+// iocontent does.
+var gptTypes = map[string]string{
+	"C12A7328-F81F-11D2-BA4B-00A0C93EC93B": "EFI",
+	"EBD0A0A2-B9E5-4433-87C0-68B6B72699C7": "Microsoft Basic Data",
+	"E3C9E316-0B5C-4DB8-817D-F92DF00215AE": "Microsoft Reserved",
+	"DE94BBA4-06D1-4D40-A16A-BFD50179D6AC": "Windows Recovery",
+	"21686148-6449-6E6F-744E-656564454649": "BIOS Boot",
+	"0FC63DAF-8483-4772-8E79-3D69D8477DE4": "Linux Filesystem",
+	"0657FD6D-A4AB-43C4-84E5-0933C84B4F4F": "Linux Swap",
+	"E6D6D379-F507-44C2-A23C-238F2A3DF928": "Linux LVM",
+	"A19D880F-05FC-4D3B-A006-743F0F84911E": "Linux RAID",
+	"48465300-0000-11AA-AA11-00306543ECAC": "Apple_HFS",
+	"7C3457EF-0000-11AA-AA11-00306543ECAC": "Apple_APFS",
+	"426F6F74-0000-11AA-AA11-00306543ECAC": "Apple_Boot",
+}
+
+// mbrTypes names the common MBR partition types like system_profiler's
+// iocontent does.
+var mbrTypes = map[byte]string{
+	0x01: "DOS_FAT_12",
+	0x04: "DOS_FAT_16",
+	0x05: "Extended",
+	0x06: "DOS_FAT_16",
+	0x07: "Windows_NTFS",
+	0x0b: "DOS_FAT_32",
+	0x0c: "DOS_FAT_32",
+	0x0e: "DOS_FAT_16",
+	0x0f: "Extended",
+	0x82: "Linux_Swap",
+	0x83: "Linux",
+	0x85: "Extended",
+	0x8e: "Linux_LVM",
+	0xa8: "Apple_UFS",
+	0xab: "Apple_Boot",
+	0xaf: "Apple_HFS",
+	0xee: "GPT Protective",
+	0xef: "EFI",
+}
+
+func isExtended(t byte) bool {
+	return t == 0x05 || t == 0x0f || t == 0x85
+}
+
+// OpenImage opens a disk image or block device and returns its size, which
+// for device nodes is only available by seeking to the end.
+func OpenImage(path string) (*os.File, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("failed to get size of %s: %w", path, err)
+	}
+	return f, size, nil
+}
+
+// ReadPartitionTable reads the partition table of a disk or image of the
+// given size: a GPT (validating the header and entry CRCs and checking the
+// backup header) if there is one, else a classic MBR with its extended and
+// logical partitions.
+func ReadPartitionTable(r io.ReaderAt, size int64) (*PartitionTable, error) {
+	mbr := make([]byte, 512)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		return nil, fmt.Errorf("failed to read MBR: %w", err)
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xaa {
+		return nil, fmt.Errorf("no partition table: missing MBR boot signature")
+	}
+	hasProtective := false
+	for i := 0; i < 4; i++ {
+		// boot sectors of unpartitioned file systems have code where the
+		// partition entries would be; real entries have a valid status
+		if s := mbr[446+16*i]; s != 0x00 && s != 0x80 {
+			return nil, fmt.Errorf("no partition table: invalid status %#02x in MBR entry %d", s, i+1)
+		}
+		if mbr[446+16*i+4] == 0xee {
+			hasProtective = true
+		}
+	}
+	if hasProtective {
+		var errs []string
+		for _, ss := range []int{512, 4096} {
+			pt, err := readGPT(r, size, ss)
+			if err == nil {
+				return pt, nil
+			}
+			errs = append(errs, fmt.Sprintf("%d byte sectors: %v", ss, err))
+		}
+		return nil, fmt.Errorf("protective MBR without a valid GPT (%s)", strings.Join(errs, "; "))
+	}
+	return readMBR(r, mbr)
+}
+
+// gptMaxEntryArray is the largest GPT entry array read, 64 times the usual
+// 128 entries of 128 bytes.
+const gptMaxEntryArray = 1 << 20
+
+type gptHeader struct {
+	myLBA, alternateLBA     uint64
+	firstUsable, lastUsable uint64
+	diskGUID                string
+	entriesLBA              uint64
+	numEntries, entrySize   uint32
+	entriesCRC              uint32
+}
+
+func readGPTHeader(r io.ReaderAt, lba uint64, ss int) (*gptHeader, error) {
+	b := make([]byte, ss)
+	if _, err := r.ReadAt(b, int64(lba)*int64(ss)); err != nil {
+		return nil, fmt.Errorf("failed to read GPT header at LBA %d: %w", lba, err)
+	}
+	if !bytes.Equal(b[0:8], []byte("EFI PART")) {
+		return nil, fmt.Errorf("no GPT signature at LBA %d", lba)
+	}
+	hsize := binary.LittleEndian.Uint32(b[12:])
+	if hsize < 92 || int(hsize) > ss {
+		return nil, fmt.Errorf("invalid GPT header size %d at LBA %d", hsize, lba)
+	}
+	want := binary.LittleEndian.Uint32(b[16:])
+	hdr := append([]byte(nil), b[:hsize]...)
+	binary.LittleEndian.PutUint32(hdr[16:], 0)
+	if got := crc32.ChecksumIEEE(hdr); got != want {
+		return nil, fmt.Errorf("GPT header CRC mismatch at LBA %d: %#08x, expected %#08x", lba, got, want)
+	}
+	h := &gptHeader{
+		myLBA:        binary.LittleEndian.Uint64(b[24:]),
+		alternateLBA: binary.LittleEndian.Uint64(b[32:]),
+		firstUsable:  binary.LittleEndian.Uint64(b[40:]),
+		lastUsable:   binary.LittleEndian.Uint64(b[48:]),
+		diskGUID:     formatGUID(b[56:72]),
+		entriesLBA:   binary.LittleEndian.Uint64(b[72:]),
+		numEntries:   binary.LittleEndian.Uint32(b[80:]),
+		entrySize:    binary.LittleEndian.Uint32(b[84:]),
+		entriesCRC:   binary.LittleEndian.Uint32(b[88:]),
+	}
+	if h.myLBA != lba {
+		return nil, fmt.Errorf("GPT header at LBA %d claims to be at LBA %d", lba, h.myLBA)
+	}
+	// the specification only sets lower bounds, so these are sanity limits
+	// that keep a crafted header from making us allocate gigabytes
+	if h.entrySize < 128 || h.entrySize > 4096 || h.entrySize%8 != 0 || h.numEntries > 1024 ||
+		h.numEntries*h.entrySize > gptMaxEntryArray {
+		return nil, fmt.Errorf("invalid GPT entry array (%d entries of %d bytes) at LBA %d", h.numEntries, h.entrySize, lba)
+	}
+	return h, nil
+}
+
+func readGPTEntries(r io.ReaderAt, h *gptHeader, ss int) ([]byte, error) {
+	b := make([]byte, int(h.numEntries)*int(h.entrySize))
+	if _, err := r.ReadAt(b, int64(h.entriesLBA)*int64(ss)); err != nil {
+		return nil, fmt.Errorf("failed to read GPT entries at LBA %d: %w", h.entriesLBA, err)
+	}
+	if got := crc32.ChecksumIEEE(b); got != h.entriesCRC {
+		return nil, fmt.Errorf("GPT entries CRC mismatch at LBA %d: %#08x, expected %#08x", h.entriesLBA, got, h.entriesCRC)
+	}
+	return b, nil
+}
+
+func readGPT(r io.ReaderAt, size int64, ss int) (*PartitionTable, error) {
+	if size < int64(3*ss) {
+		return nil, fmt.Errorf("disk of %d bytes is too small for a GPT", size)
+	}
+	pt := &PartitionTable{Scheme: "gpt", SectorSize: ss}
+	lastLBA := uint64(size/int64(ss)) - 1
+	primary, perr := readGPTHeader(r, 1, ss)
+	var entries []byte
+	if perr == nil {
+		entries, perr = readGPTEntries(r, primary, ss)
+	}
+	backupLBA := lastLBA
+	if primary != nil && primary.alternateLBA != 0 {
+		backupLBA = primary.alternateLBA
+	}
+	backup, berr := readGPTHeader(r, backupLBA, ss)
+	var bEntries []byte
+	if berr == nil {
+		bEntries, berr = readGPTEntries(r, backup, ss)
+	}
+
+	h := primary
+	switch {
+	case perr != nil && berr != nil:
+		return nil, fmt.Errorf("primary GPT: %v; backup GPT: %v", perr, berr)
+	case perr != nil:
+		pt.Warnings = append(pt.Warnings, fmt.Sprintf("primary GPT is invalid, using the backup: %v", perr))
+		h, entries = backup, bEntries
+	case berr != nil:
+		pt.Warnings = append(pt.Warnings, fmt.Sprintf("backup GPT is invalid: %v", berr))
+	default:
+		if backupLBA != lastLBA {
+			pt.Warnings = append(pt.Warnings, fmt.Sprintf("backup GPT is at LBA %d, not at the last LBA %d", backupLBA, lastLBA))
+		}
+		if backup.diskGUID != primary.diskGUID || backup.entriesCRC != primary.entriesCRC {
+			pt.Warnings = append(pt.Warnings, "backup GPT does not match the primary GPT")
+		}
+	}
+	pt.DiskID = h.diskGUID
+
+	for i := 0; i < int(h.numEntries); i++ {
+		e := entries[i*int(h.entrySize) : (i+1)*int(h.entrySize)]
+		typ := formatGUID(e[0:16])
+		if typ == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+		first := binary.LittleEndian.Uint64(e[32:])
+		last := binary.LittleEndian.Uint64(e[40:])
+		if last < first || first < h.firstUsable || last > h.lastUsable {
+			pt.Warnings = append(pt.Warnings, fmt.Sprintf("GPT entry %d spans LBA %d-%d outside of the usable area", i+1, first, last))
+		}
+		name := make([]uint16, 0, 36)
+		for j := 56; j+1 < 128; j += 2 {
+			c := binary.LittleEndian.Uint16(e[j:])
+			if c == 0 {
+				break
+			}
+			name = append(name, c)
+		}
+		pt.Partitions = append(pt.Partitions, &Partition{
+			Number:     i + 1,
+			Offset:     int64(first) * int64(ss),
+			Size:       int64(last-first+1) * int64(ss),
+			Type:       typ,
+			TypeName:   gptTypes[typ],
+			UUID:       formatGUID(e[16:32]),
+			Name:       string(utf16.Decode(name)),
+			Attributes: binary.LittleEndian.Uint64(e[48:]),
+		})
+	}
+	return pt, nil
+}
+
+func readMBR(r io.ReaderAt, mbr []byte) (*PartitionTable, error) {
+	const ss = 512
+	pt := &PartitionTable{
+		Scheme:     "dos",
+		DiskID:     fmt.Sprintf("%08x", binary.LittleEndian.Uint32(mbr[440:])),
+		SectorSize: ss,
+	}
+	var extStart uint32
+	for i := 0; i < 4; i++ {
+		e := mbr[446+16*i : 446+16*(i+1)]
+		p, start := mbrEntry(e, 0)
+		if p == nil {
+			continue
+		}
+		p.Number = i + 1
+		pt.Partitions = append(pt.Partitions, p)
+		if isExtended(e[4]) {
+			if extStart != 0 {
+				pt.Warnings = append(pt.Warnings, "more than one extended partition")
+				continue
+			}
+			extStart = start
+		}
+	}
+	if extStart == 0 {
+		return pt, nil
+	}
+
+	// logical partitions: a chain of EBRs, each holding the logical
+	// partition relative to itself and the next EBR relative to the
+	// extended partition
+	next := 5
+	ebr := make([]byte, ss)
+	seen := make(map[uint32]bool)
+	for lba := extStart; ; {
+		if seen[lba] || len(seen) > 128 {
+			pt.Warnings = append(pt.Warnings, fmt.Sprintf("EBR chain loops at LBA %d", lba))
+			break
+		}
+		seen[lba] = true
+		if _, err := r.ReadAt(ebr, int64(lba)*ss); err != nil {
+			return nil, fmt.Errorf("failed to read EBR at LBA %d: %w", lba, err)
+		}
+		if ebr[510] != 0x55 || ebr[511] != 0xaa {
+			pt.Warnings = append(pt.Warnings, fmt.Sprintf("invalid EBR signature at LBA %d", lba))
+			break
+		}
+		if p, _ := mbrEntry(ebr[446:462], lba); p != nil {
+			p.Number = next
+			next++
+			pt.Partitions = append(pt.Partitions, p)
+		}
+		link := ebr[462:478]
+		if link[4] == 0 {
+			break
+		}
+		lba = extStart + binary.LittleEndian.Uint32(link[8:])
+	}
+	return pt, nil
+}
+
+// mbrEntry decodes a 16 byte partition entry whose start is relative to
+// base; it returns nil for empty entries.
+func mbrEntry(e []byte, base uint32) (*Partition, uint32) {
+	typ := e[4]
+	start := binary.LittleEndian.Uint32(e[8:])
+	count := binary.LittleEndian.Uint32(e[12:])
+	if typ == 0 || count == 0 {
+		return nil, 0
+	}
+	start += base
+	return &Partition{
+		Offset:     int64(start) * 512,
+		Size:       int64(count) * 512,
+		Type:       fmt.Sprintf("%#02x", typ),
+		TypeName:   mbrTypes[typ],
+		Attributes: uint64(e[0]),
+	}, start
+}
+
+// Apply fills a MediaInfo and its volumes from the partition table.
+// Existing volumes are matched by partition number (from their device
+// name) or offset; partitions without a volume get a new one. Extended
+// partitions are containers and get no volume.
+func (pt PartitionTable) Apply(mi *MediaInfo) {
+	mi.PartitionName = partitionMapName(pt.Scheme)
+	mi.DiskID = pt.DiskID
+	for _, p := range pt.Partitions {
+		if p.TypeName == "Extended" {
+			continue
+		}
+		var vi *VolumeInfo
+		for _, v := range mi.Volumes {
+			if (v.Offset != 0 && v.Offset == p.Offset) ||
+				(v.Offset == 0 && v.DevName != "" && partitionIndex(v.DevName) == p.Number) {
+				vi = v
+				break
+			}
+		}
+		if vi == nil {
+			vi = &VolumeInfo{Size: p.Size}
+			if mi.DevName != "" {
+				vi.DevName = partitionDevName(mi.DevName, p.Number)
+			}
+			mi.Volumes = append(mi.Volumes, vi)
+		}
+		vi.PartitionNumber = p.Number
+		vi.Offset = p.Offset
+		vi.PartitionType = p.Type
+		vi.PartitionUUID = p.UUID
+		vi.PartitionLabel = p.Name
+		vi.Attributes = p.Attributes
+		if vi.Content == "" {
+			vi.Content = p.TypeName
+		}
+		if vi.Size == 0 {
+			vi.Size = p.Size
+		}
+	}
+}
+
+// partitionDevName derives the device name of a partition from the disk's:
+// disk5 -> disk5s1 (macOS), sdb -> sdb1, mmcblk0/nvme0n1 -> mmcblk0p1.
+func partitionDevName(disk string, n int) string {
+	switch {
+	case strings.HasPrefix(disk, "disk"):
+		return fmt.Sprintf("%ss%d", disk, n)
+	case disk != "" && disk[len(disk)-1] >= '0' && disk[len(disk)-1] <= '9':
+		return fmt.Sprintf("%sp%d", disk, n)
+	}
+	return fmt.Sprintf("%s%d", disk, n)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// testPartition is a partition for makeGPT and makeMBR, in 512-byte sectors.
+type testPartition struct {
+	typ         string // GPT type GUID, or MBR type byte as "0c"
+	uuid, name  string // GPT only
+	first, size uint64
+	attrs       uint64
+}
+
+// putGUID writes a GUID in the mixed-endian layout formatGUID reads.
+func putGUID(b []byte, s string) {
+	raw, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(raw) != 16 {
+		panic("invalid GUID " + s)
+	}
+	binary.LittleEndian.PutUint32(b[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(b[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(b[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(b[8:], raw[8:])
+}
+
+// makeGPT returns a disk image of size bytes with a protective MBR and a
+// primary and backup GPT of 128 entries.
+func makeGPT(size int64, diskGUID string, parts []testPartition) []byte {
+	const ss = 512
+	img := make([]byte, size)
+	lastLBA := uint64(size/ss) - 1
+	binary.LittleEndian.PutUint32(img[446+8:], 1)
+	img[446+4] = 0xee
+	binary.LittleEndian.PutUint32(img[446+12:], uint32(lastLBA))
+	img[510], img[511] = 0x55, 0xaa
+
+	entries := make([]byte, 128*128)
+	for i, p := range parts {
+		e := entries[i*128:]
+		putGUID(e[0:], p.typ)
+		putGUID(e[16:], p.uuid)
+		binary.LittleEndian.PutUint64(e[32:], p.first)
+		binary.LittleEndian.PutUint64(e[40:], p.first+p.size-1)
+		binary.LittleEndian.PutUint64(e[48:], p.attrs)
+		for j, c := range utf16.Encode([]rune(p.name)) {
+			binary.LittleEndian.PutUint16(e[56+2*j:], c)
+		}
+	}
+	header := func(my, alt, entriesLBA uint64) {
+		h := img[my*ss : my*ss+92]
+		copy(h, "EFI PART")
+		binary.LittleEndian.PutUint32(h[8:], 0x00010000)
+		binary.LittleEndian.PutUint32(h[12:], 92)
+		binary.LittleEndian.PutUint64(h[24:], my)
+		binary.LittleEndian.PutUint64(h[32:], alt)
+		binary.LittleEndian.PutUint64(h[40:], 34)
+		binary.LittleEndian.PutUint64(h[48:], lastLBA-33)
+		putGUID(h[56:], diskGUID)
+		binary.LittleEndian.PutUint64(h[72:], entriesLBA)
+		binary.LittleEndian.PutUint32(h[80:], 128)
+		binary.LittleEndian.PutUint32(h[84:], 128)
+		binary.LittleEndian.PutUint32(h[88:], crc32.ChecksumIEEE(entries))
+		copy(img[entriesLBA*ss:], entries)
+		binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h))
+	}
+	header(1, lastLBA, 2)
+	header(lastLBA, 1, lastLBA-32)
+	return img
+}
+
+// makeMBR returns a disk image of size bytes with an MBR; partitions after
+// an extended one are logical and get an EBR each.
+func makeMBR(size int64, parts []testPartition) []byte {
+	img := make([]byte, size)
+	binary.LittleEndian.PutUint32(img[440:], 0x1234abcd)
+	img[510], img[511] = 0x55, 0xaa
+	entry := func(e []byte, typ string, start, count uint64) {
+		t, _ := hex.DecodeString(typ)
+		e[4] = t[0]
+		binary.LittleEndian.PutUint32(e[8:], uint32(start))
+		binary.LittleEndian.PutUint32(e[12:], uint32(count))
+	}
+	var ext *testPartition
+	var prevEBR uint64
+	logical := 0
+	for i := range parts {
+		p := &parts[i]
+		if ext == nil {
+			e := img[446+16*i:]
+			entry(e, p.typ, p.first, p.size)
+			e[0] = byte(p.attrs)
+			if p.typ == "05" || p.typ == "0f" {
+				ext = p
+			}
+			continue
+		}
+		// the EBR sits in the sector before its logical partition
+		ebr := p.first - 1
+		b := img[ebr*512:]
+		entry(b[446:], p.typ, 1, p.size)
+		b[510], b[511] = 0x55, 0xaa
+		if logical > 0 {
+			entry(img[prevEBR*512+462:], "05", ebr-ext.first, p.size+1)
+		}
+		prevEBR = ebr
+		logical++
+	}
+	return img
+}
+
+const (
+	testDiskGUID = "5B3C9E2A-1D47-4F0B-9A61-3E2D8C7B6A50"
+	testEFIGUID  = "0E239BC6-F960-3107-89CF-1C97F78BB46B"
+	testDataGUID = "6ABA678A-0FF6-3876-83B7-FE44B24110EB"
+)
+
+func testGPTImage() []byte {
+	return makeGPT(8<<20, testDiskGUID, []testPartition{
+		{typ: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", uuid: testEFIGUID, name: "EFI System Partition", first: 2048, size: 4096, attrs: 0x04},
+		{typ: "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7", uuid: testDataGUID, name: "DATA", first: 6144, size: 8192},
+	})
+}
+
+func TestReadPartitionTableGPT(t *testing.T) {
+	img := testGPTImage()
+	pt, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.Scheme != "gpt" || pt.DiskID != testDiskGUID || pt.SectorSize != 512 {
+		t.Errorf("got scheme %q, disk ID %q, sector size %d", pt.Scheme, pt.DiskID, pt.SectorSize)
+	}
+	if len(pt.Warnings) != 0 {
+		t.Errorf("unexpected warnings %q", pt.Warnings)
+	}
+	want := []Partition{
+		{Number: 1, Offset: 2048 * 512, Size: 4096 * 512, Type: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+			TypeName: "EFI", UUID: testEFIGUID, Name: "EFI System Partition", Attributes: 0x04},
+		{Number: 2, Offset: 6144 * 512, Size: 8192 * 512, Type: "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7",
+			TypeName: "Microsoft Basic Data", UUID: testDataGUID, Name: "DATA"},
+	}
+	if len(pt.Partitions) != len(want) {
+		t.Fatalf("got %d partitions, want %d", len(pt.Partitions), len(want))
+	}
+	for i, p := range pt.Partitions {
+		if *p != want[i] {
+			t.Errorf("partition %d is %+v, want %+v", i+1, *p, want[i])
+		}
+	}
+	if !pt.Partitions[0].Bootable() || pt.Partitions[1].Bootable() {
+		t.Error("only the first partition should be legacy BIOS bootable")
+	}
+}
+
+func TestReadPartitionTableGPTBackup(t *testing.T) {
+	img := testGPTImage()
+	img[512+100] ^= 0xff // in the primary header's CRC'd area
+	img[512+16] ^= 0xff
+	pt, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pt.Partitions) != 2 || len(pt.Warnings) != 1 || !strings.Contains(pt.Warnings[0], "using the backup") {
+		t.Errorf("got %d partitions and warnings %q", len(pt.Partitions), pt.Warnings)
+	}
+}
+
+func TestReadPartitionTableGPTEntrySize(t *testing.T) {
+	// a crafted header asking for 1024 entries of almost 4 GiB each
+	img := testGPTImage()
+	for _, lba := range []int64{1, int64(len(img))/512 - 1} {
+		h := img[lba*512 : lba*512+92]
+		binary.LittleEndian.PutUint32(h[80:], 1024)
+		binary.LittleEndian.PutUint32(h[84:], 0xfffffff8)
+		binary.LittleEndian.PutUint32(h[16:], 0)
+		binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h))
+	}
+	if _, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img))); err == nil {
+		t.Error("got no error for an entry size of 0xfffffff8")
+	}
+}
+
+func TestReadPartitionTableMBR(t *testing.T) {
+	img := makeMBR(8<<20, []testPartition{
+		{typ: "0c", first: 2048, size: 4096, attrs: 0x80},
+		{typ: "0f", first: 8192, size: 8192},
+		{typ: "83", first: 8193, size: 2047},
+		{typ: "07", first: 10241, size: 4095},
+	})
+	pt, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.Scheme != "dos" || pt.DiskID != "1234abcd" {
+		t.Errorf("got scheme %q, disk ID %q", pt.Scheme, pt.DiskID)
+	}
+	if len(pt.Warnings) != 0 {
+		t.Errorf("unexpected warnings %q", pt.Warnings)
+	}
+	want := []Partition{
+		{Number: 1, Offset: 2048 * 512, Size: 4096 * 512, Type: "0x0c", TypeName: "DOS_FAT_32", Attributes: 0x80},
+		{Number: 2, Offset: 8192 * 512, Size: 8192 * 512, Type: "0x0f", TypeName: "Extended"},
+		{Number: 5, Offset: 8193 * 512, Size: 2047 * 512, Type: "0x83", TypeName: "Linux"},
+		{Number: 6, Offset: 10241 * 512, Size: 4095 * 512, Type: "0x07", TypeName: "Windows_NTFS"},
+	}
+	if len(pt.Partitions) != len(want) {
+		t.Fatalf("got %d partitions, want %d", len(pt.Partitions), len(want))
+	}
+	for i, p := range pt.Partitions {
+		if *p != want[i] {
+			t.Errorf("partition %d is %+v, want %+v", i+1, *p, want[i])
+		}
+	}
+}
+
+func TestReadPartitionTableNone(t *testing.T) {
+	img := make([]byte, 1<<20)
+	if _, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img))); err == nil {
+		t.Error("got no error for a blank disk")
+	}
+}
+
+func TestPartitionTableApply(t *testing.T) {
+	img := testGPTImage()
+	pt, err := ReadPartitionTable(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sdb1 is known from sysfs, sdb2 is not
+	sdb1 := &VolumeInfo{DevName: "sdb1", Size: 4096 * 512}
+	mi := &MediaInfo{DevName: "sdb", Volumes: []*VolumeInfo{sdb1}}
+	pt.Apply(mi)
+	if mi.PartitionName != "guid_partition_map_type" || mi.DiskID != testDiskGUID {
+		t.Errorf("got partition map %q, disk ID %q", mi.PartitionName, mi.DiskID)
+	}
+	if len(mi.Volumes) != 2 || mi.Volumes[0] != sdb1 {
+		t.Fatalf("got %d volumes, want sdb1 and a new one", len(mi.Volumes))
+	}
+	if sdb1.Offset != 2048*512 || sdb1.PartitionUUID != testEFIGUID || sdb1.PartitionLabel != "EFI System Partition" || sdb1.Content != "EFI" {
+		t.Errorf("sdb1 is %+v", sdb1)
+	}
+	if vi := mi.Volumes[1]; vi.DevName != "sdb2" || vi.Size != 8192*512 || vi.PartitionNumber != 2 {
+		t.Errorf("sdb2 is %+v", vi)
+	}
+}
+
+func TestPartitionDevName(t *testing.T) {
+	for disk, want := range map[string]string{
+		"disk5":   "disk5s1",
+		"sdb":     "sdb1",
+		"mmcblk0": "mmcblk0p1",
+		"nvme0n1": "nvme0n1p1",
+	} {
+		if got := partitionDevName(disk, 1); got != want {
+			t.Errorf("partitionDevName(%q, 1) = %q, want %q", disk, got, want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodePlist decodes an XML property list (as produced by `ioreg -a` or
+// `system_profiler -xml`) into generic Go values, like json.Unmarshal into any:
+//   - dict    -> map[string]any
+//   - array   -> []any
+//   - string  -> string
+//   - integer -> int64 (uint64 if it does not fit)
+//   - real    -> float64
+//   - true/false -> bool
+//   - data    -> []byte
+//   - date    -> time.Time
+func DecodePlist(r io.Reader) (any, error) {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("plist has no root element")
+			}
+			return nil, fmt.Errorf("failed to read plist: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "plist" {
+			return nil, fmt.Errorf("unexpected plist root element <%s>", se.Name.Local)
+		}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read plist: %w", err)
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				return decodePlistValue(d, t, "plist")
+			case xml.EndElement:
+				return nil, fmt.Errorf("empty plist")
+			}
+		}
+	}
+}
+
+func decodePlistValue(d *xml.Decoder, se xml.StartElement, path string) (any, error) {
+	switch se.Name.Local {
+	case "dict":
+		m := make(map[string]any)
+		key := ""
+		hasKey := false
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if hasKey {
+						return nil, fmt.Errorf("%s: key %q has no value", path, key)
+					}
+					if key, err = plistText(d, path); err != nil {
+						return nil, err
+					}
+					hasKey = true
+					continue
+				}
+				if !hasKey {
+					return nil, fmt.Errorf("%s: <%s> without a key", path, t.Name.Local)
+				}
+				v, err := decodePlistValue(d, t, fmt.Sprintf("%s[%s]", path, key))
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+				hasKey = false
+			case xml.EndElement:
+				if hasKey {
+					return nil, fmt.Errorf("%s: key %q has no value", path, key)
+				}
+				return m, nil
+			}
+		}
+	case "array":
+		a := make([]any, 0)
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := decodePlistValue(d, t, fmt.Sprintf("%s[%d]", path, len(a)))
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			case xml.EndElement:
+				return a, nil
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return se.Name.Local == "true", nil
+	}
+
+	s, err := plistText(d, path)
+	if err != nil {
+		return nil, err
+	}
+	switch se.Name.Local {
+	case "string":
+		return s, nil
+	case "integer":
+		// decimal, so "010" is 10 and not octal; CoreFoundation also
+		// reads hex with a 0x prefix
+		s = strings.TrimSpace(s)
+		base := 10
+		if digits := strings.TrimPrefix(s, "-"); strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+			base = 0
+		}
+		if v, err := strconv.ParseInt(s, base, 64); err == nil {
+			return v, nil
+		}
+		v, err := strconv.ParseUint(s, base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s (%s): %w", path, s, err)
+		}
+		return v, nil
+	case "real":
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s (%s): %w", path, s, err)
+		}
+		return v, nil
+	case "data":
+		v, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		return v, nil
+	case "date":
+		v, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s (%s): %w", path, s, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported plist element <%s>", path, se.Name.Local)
+}
+
+// plistText reads the character data up to the end of the current element.
+func plistText(d *xml.Decoder, path string) (string, error) {
+	var buf strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			buf.Write(t)
+		case xml.StartElement:
+			return "", fmt.Errorf("%s: unexpected <%s> in text element", path, t.Name.Local)
+		case xml.EndElement:
+			return buf.String(), nil
+		}
+	}
+}
+
+// plistUint converts a decoded plist (or JSON) number to uint64.
+func plistUint(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	case float64:
+		return uint64(n), true
+	case string:
+		u, err := strconv.ParseUint(strings.TrimSpace(n), 0, 64)
+		return u, err == nil
+	}
+	return 0, false
+}
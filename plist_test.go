@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodePlist(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>Flash &amp; Disk</string>
+	<key>port</key>
+	<integer>010</integer>
+	<key>negative</key>
+	<integer>-3</integer>
+	<key>hex</key>
+	<integer>0x14100000</integer>
+	<key>registry</key>
+	<integer>18446744073709551615</integer>
+	<key>ratio</key>
+	<real>0.5</real>
+	<key>removable</key>
+	<true/>
+	<key>internal</key>
+	<false/>
+	<key>data</key>
+	<data>
+	AAEC
+	</data>
+	<key>date</key>
+	<date>2024-03-01T12:00:00Z</date>
+	<key>items</key>
+	<array>
+		<string>a</string>
+		<dict/>
+	</array>
+</dict>
+</plist>`
+	got, err := DecodePlist(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"name":      "Flash & Disk",
+		"port":      int64(10),
+		"negative":  int64(-3),
+		"hex":       int64(0x14100000),
+		"registry":  uint64(18446744073709551615),
+		"ratio":     0.5,
+		"removable": true,
+		"internal":  false,
+		"data":      []byte{0, 1, 2},
+		"date":      time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		"items":     []any{"a", map[string]any{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDecodePlistErrors(t *testing.T) {
+	for _, doc := range []string{
+		`<plist><integer>12a</integer></plist>`,
+		`<plist><integer>0x</integer></plist>`,
+		`<plist><data>!!</data></plist>`,
+		`<plist><dict><key>a</key></dict></plist>`,
+		`<plist><set/></plist>`,
+		`<plist><string>unterminated`,
+	} {
+		if v, err := DecodePlist(strings.NewReader(doc)); err == nil {
+			t.Errorf("DecodePlist(%q) = %#v, want an error", doc, v)
+		}
+	}
+}
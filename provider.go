@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Provider discovers USB storage devices.
+type Provider interface {
+	Discover(ctx context.Context) ([]*USBInfo, error)
+}
+
+// TopologyProvider discovers the whole USB tree, hubs and all, not just the
+// storage devices.
+type TopologyProvider interface {
+	Topology(ctx context.Context) ([]*USBBus, error)
+}
+
+// Enricher adds to what a Provider discovered, e.g. mount state or registry
+// data.
+type Enricher interface {
+	Enrich(ctx context.Context, uis []*USBInfo) error
+}
+
+// ProviderOptions configures the providers created from the registry.
+type ProviderOptions struct {
+	Runner CommandRunner // nil means ExecRunner
+	Root   string        // sysfs root, empty means "/"
+	Paths  []string      // snapshot files
+	Stdin  io.Reader     // for the "-" snapshot; nil means os.Stdin
+	// snapshots lets a snapshot provider and its topology share one read
+	// of Paths, which stdin cannot give twice; nil reads them every time.
+	snapshots *snapshotCache
+}
+
+// ProviderInfo describes a registered provider.
+type ProviderInfo struct {
+	Name        string
+	Description string
+	Platforms   []string // GOOS values it runs on; empty means all
+	// Available tells why the provider cannot run here, e.g. because its
+	// tool is not installed; nil means it can.
+	Available func(opts ProviderOptions) error
+	New       func(opts ProviderOptions) Provider
+	// Enrichers are what AutoProvider and NewProvider combine the provider
+	// with; may be nil.
+	Enrichers func(opts ProviderOptions) []Enricher
+	// NewTopology creates the matching topology provider; nil if there is
+	// none.
+	NewTopology func(opts ProviderOptions) TopologyProvider
+}
+
+// Supported tells whether the provider runs on the given GOOS.
+func (pi ProviderInfo) Supported(goos string) bool {
+	if len(pi.Platforms) == 0 {
+		return true
+	}
+	return containsString(pi.Platforms, goos)
+}
+
+// providers is the registry in order of preference.
+var providers = []ProviderInfo{
+	{
+		Name:        "snapshot",
+		Description: "captured system_profiler (JSON, plist or text) or lsblk reports",
+		Available: func(opts ProviderOptions) error {
+			if len(opts.Paths) == 0 {
+				return fmt.Errorf("no snapshot files given")
+			}
+			return nil
+		},
+		New: func(opts ProviderOptions) Provider {
+			return SnapshotBackend{Paths: opts.Paths, Stdin: opts.Stdin, cache: opts.snapshots}
+		},
+		NewTopology: func(opts ProviderOptions) TopologyProvider {
+			return SnapshotBackend{Paths: opts.Paths, Stdin: opts.Stdin, cache: opts.snapshots}
+		},
+	},
+	{
+		Name:        "system_profiler",
+		Description: "macOS system_profiler SPUSBDataType",
+		Platforms:   []string{"darwin"},
+		Available:   lookPath("system_profiler"),
+		New: func(opts ProviderOptions) Provider {
+			return SystemProfilerBackend{Runner: opts.Runner}
+		},
+		Enrichers: func(opts ProviderOptions) []Enricher {
+			return []Enricher{
+				OptionalEnricher{IORegEnricher{Runner: opts.Runner}},
+				OptionalEnricher{BootEnricher{}},
+			}
+		},
+		NewTopology: func(opts ProviderOptions) TopologyProvider {
+			return SystemProfilerBackend{Runner: opts.Runner}
+		},
+	},
+	{
+		Name:        "sysfs",
+		Description: "Linux /sys/block and /sys/bus/usb",
+		Platforms:   []string{"linux"},
+		Available: func(opts ProviderOptions) error {
+			_, err := os.Stat(SysfsBackend{Root: opts.Root}.path("sys", "block"))
+			return err
+		},
+		New: func(opts ProviderOptions) Provider {
+			return SysfsBackend{Root: opts.Root}
+		},
+		Enrichers:   linuxEnrichers,
+		NewTopology: lsusbTopology,
+	},
+	{
+		Name:        "lsblk",
+		Description: "Linux lsblk --json",
+		Platforms:   []string{"linux"},
+		Available:   lookPath("lsblk"),
+		New: func(opts ProviderOptions) Provider {
+			return LsblkBackend{Runner: opts.Runner}
+		},
+		Enrichers:   linuxEnrichers,
+		NewTopology: lsusbTopology,
+	},
+	{
+		Name:        "sample",
+		Description: "sample system_profiler reports built into the program",
+		Available: func(ProviderOptions) error {
+			return fmt.Errorf("only used when asked for")
+		},
+		New: func(ProviderOptions) Provider {
+			return SampleBackend{}
+		},
+		NewTopology: func(ProviderOptions) TopologyProvider {
+			return SampleBackend{}
+		},
+	},
+}
+
+func lookPath(tool string) func(ProviderOptions) error {
+	return func(opts ProviderOptions) error {
+		if opts.Runner != nil {
+			return nil // canned output, the tool need not exist
+		}
+		_, err := exec.LookPath(tool)
+		return err
+	}
+}
+
+func lsusbTopology(opts ProviderOptions) TopologyProvider {
+	return LsusbBackend{Runner: opts.Runner}
+}
+
+func linuxEnrichers(opts ProviderOptions) []Enricher {
+	return []Enricher{
+		OptionalEnricher{MountEnricher{}},
+		OptionalEnricher{UdevEnricher{Runner: opts.Runner}},
+		OptionalEnricher{FSProbeEnricher{DevDir: devDir(opts)}},
+		OptionalEnricher{BootEnricher{DevDir: devDir(opts)}},
+	}
+}
+
+// devDir is where the device nodes are below the sysfs root, "" for /dev.
+func devDir(opts ProviderOptions) string {
+	if opts.Root == "" {
+		return ""
+	}
+	return filepath.Join(opts.Root, "dev")
+}
+
+// RegisterProvider adds a provider to the registry, replacing one of the
+// same name.
+func RegisterProvider(pi ProviderInfo) {
+	for i, p := range providers {
+		if p.Name == pi.Name {
+			providers[i] = pi
+			return
+		}
+	}
+	providers = append(providers, pi)
+}
+
+// Providers returns the registered providers in order of preference.
+func Providers() []ProviderInfo {
+	return append([]ProviderInfo(nil), providers...)
+}
+
+// NewProvider creates the named provider, combined with its enrichers.
+func NewProvider(name string, opts ProviderOptions) (Provider, error) {
+	pi, err := FindProvider(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pi.Build(opts), nil
+}
+
+// AutoProvider picks the first registered provider that runs on this
+// platform and is available, combined with its enrichers.
+func AutoProvider(opts ProviderOptions) (Provider, error) {
+	return NewProvider("auto", opts)
+}
+
+// FindProvider looks up a provider by name; "auto" or "" picks the first
+// one that runs on this platform and is available.
+func FindProvider(name string, opts ProviderOptions) (ProviderInfo, error) {
+	if name != "" && name != "auto" {
+		names := make([]string, 0, len(providers))
+		for _, pi := range providers {
+			if pi.Name == name {
+				return pi, nil
+			}
+			names = append(names, pi.Name)
+		}
+		return ProviderInfo{}, fmt.Errorf("unknown provider %q, known are: %s", name, strings.Join(names, ", "))
+	}
+	reasons := make([]string, 0, len(providers))
+	for _, pi := range providers {
+		if !pi.Supported(runtime.GOOS) {
+			continue
+		}
+		if pi.Available != nil {
+			if err := pi.Available(opts); err != nil {
+				reasons = append(reasons, fmt.Sprintf("%s: %v", pi.Name, err))
+				continue
+			}
+		}
+		return pi, nil
+	}
+	return ProviderInfo{}, fmt.Errorf("no provider available on %s (%s)", runtime.GOOS, strings.Join(reasons, "; "))
+}
+
+// Build creates the provider combined with its enrichers.
+func (pi ProviderInfo) Build(opts ProviderOptions) Provider {
+	p := pi.New(opts)
+	if pi.Enrichers == nil {
+		return p
+	}
+	return &MultiProvider{Providers: []Provider{p}, Enrichers: pi.Enrichers(opts)}
+}
+
+// OptionalEnricher is an enricher whose failure does not fail discovery;
+// the lack of its tool is not even reported as a partial result.
+type OptionalEnricher struct {
+	Enricher
+}
+
+// PartialError is returned along with the results of a MultiProvider when
+// some of its providers or enrichers failed but others succeeded.
+type PartialError struct {
+	Errs []error
+}
+
+func (e *PartialError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		msgs[i] = err.Error()
+	}
+	return "partial discovery: " + strings.Join(msgs, "; ")
+}
+
+// MultiProvider merges what several providers discover into one result and
+// runs enrichers over it.
+type MultiProvider struct {
+	Providers []Provider
+	Enrichers []Enricher
+}
+
+// Discover runs all providers in order and merges their results with
+// MergeUSBInfos, so earlier providers win. It fails only if every provider
+// fails or an enricher that is not an OptionalEnricher does; other errors
+// come back as a *PartialError along with the results.
+func (m *MultiProvider) Discover(ctx context.Context) ([]*USBInfo, error) {
+	var uis []*USBInfo
+	var errs []error
+	for _, p := range m.Providers {
+		found, err := p.Discover(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		uis = MergeUSBInfos(uis, found)
+	}
+	if uis == nil {
+		if len(errs) == 1 {
+			return nil, errs[0]
+		}
+		return nil, &PartialError{Errs: errs}
+	}
+	for _, e := range m.Enrichers {
+		err := e.Enrich(ctx, uis)
+		if err == nil {
+			continue
+		}
+		if _, ok := e.(OptionalEnricher); !ok {
+			return nil, err
+		}
+		if errors.Is(err, ErrToolMissing) {
+			debugf("skipping enricher: %v\n", err)
+			continue
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return uis, &PartialError{Errs: errs}
+	}
+	return uis, nil
+}
+
+// MergeUSBInfos merges the devices found by another provider into uis. A
+// device found by both, matched within the same source by location ID or
+// else by vendor, product and serial number, gets its empty fields filled
+// in, and so do its media and volumes, matched by device name; the other
+// devices are appended.
+func MergeUSBInfos(uis, more []*USBInfo) []*USBInfo {
+	if uis == nil {
+		uis = make([]*USBInfo, 0, len(more))
+	}
+	for _, src := range more {
+		var dst *USBInfo
+		for _, ui := range uis {
+			if sameUSBDevice(ui, src) {
+				dst = ui
+				break
+			}
+		}
+		if dst == nil {
+			uis = append(uis, src)
+			continue
+		}
+		mergeUSBInfo(dst, src)
+	}
+	return uis
+}
+
+func sameUSBDevice(a, b *USBInfo) bool {
+	if a.Source != b.Source {
+		return false // the same port on different machines
+	}
+	if a.LocationID != 0 && b.LocationID != 0 {
+		return a.LocationID == b.LocationID
+	}
+	return a.SerialNumber != "" && a.SerialNumber == b.SerialNumber &&
+		a.VendorID == b.VendorID && a.ProductID == b.ProductID
+}
+
+// fill sets *dst to src if it is still the zero value.
+func fill[T comparable](dst *T, src T) {
+	var zero T
+	if *dst == zero {
+		*dst = src
+	}
+}
+
+func mergeUSBInfo(dst, src *USBInfo) {
+	fill(&dst.Name, src.Name)
+	fill(&dst.ProductID, src.ProductID)
+	fill(&dst.VendorID, src.VendorID)
+	fill(&dst.SerialNumber, src.SerialNumber)
+	fill(&dst.Manufacturer, src.Manufacturer)
+	fill(&dst.LocationID, src.LocationID)
+	fill(&dst.Speed, src.Speed)
+	fill(&dst.RegistryID, src.RegistryID)
+	fill(&dst.PortNum, src.PortNum)
+	if dst.Class == 0 && dst.SubClass == 0 && dst.Protocol == 0 {
+		dst.Class, dst.SubClass, dst.Protocol = src.Class, src.SubClass, src.Protocol
+	}
+	if len(dst.Interfaces) == 0 {
+		dst.Interfaces = src.Interfaces
+	}
+	fill(&dst.Driver, src.Driver)
+	fill(&dst.Descriptors, src.Descriptors)
+	fill(&dst.Source, src.Source)
+	dst.Warnings = append(dst.Warnings, src.Warnings...)
+	for _, sm := range src.Media {
+		var dm *MediaInfo
+		for _, mi := range dst.Media {
+			if mi.DevName != "" && mi.DevName == sm.DevName {
+				dm = mi
+				break
+			}
+		}
+		if dm == nil {
+			dst.Media = append(dst.Media, sm)
+			continue
+		}
+		mergeMediaInfo(dm, sm)
+	}
+}
+
+func mergeMediaInfo(dst, src *MediaInfo) {
+	fill(&dst.Name, src.Name)
+	fill(&dst.PartitionName, src.PartitionName)
+	fill(&dst.Size, src.Size)
+	fill(&dst.DiskID, src.DiskID)
+	if len(dst.Links) == 0 {
+		dst.Links = src.Links
+	}
+	fill(&dst.Boot, src.Boot)
+	for _, sv := range src.Volumes {
+		var dv *VolumeInfo
+		for _, vi := range dst.Volumes {
+			if (vi.DevName != "" && vi.DevName == sv.DevName) || (vi.UUID != "" && vi.UUID == sv.UUID) {
+				dv = vi
+				break
+			}
+		}
+		if dv == nil {
+			dst.Volumes = append(dst.Volumes, sv)
+			continue
+		}
+		mergeVolumeInfo(dv, sv)
+	}
+}
+
+func mergeVolumeInfo(dst, src *VolumeInfo) {
+	fill(&dst.Name, src.Name)
+	fill(&dst.DevName, src.DevName)
+	fill(&dst.Size, src.Size)
+	fill(&dst.FileSystem, src.FileSystem)
+	fill(&dst.UUID, src.UUID)
+	if !dst.Mounted && src.Mounted {
+		dst.Mounted = true
+		dst.MountPoint = src.MountPoint
+		dst.Free = src.Free
+		dst.Writable = src.Writable
+		dst.MountOptions = src.MountOptions
+	}
+	fill(&dst.DevNum, src.DevNum)
+	fill(&dst.Content, src.Content)
+	fill(&dst.PartitionNumber, src.PartitionNumber)
+	fill(&dst.Offset, src.Offset)
+	fill(&dst.PartitionType, src.PartitionType)
+	fill(&dst.PartitionUUID, src.PartitionUUID)
+	fill(&dst.PartitionLabel, src.PartitionLabel)
+	fill(&dst.Attributes, src.Attributes)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// staticProvider discovers the same devices every time.
+type staticProvider []*USBInfo
+
+func (p staticProvider) Discover(ctx context.Context) ([]*USBInfo, error) {
+	return p, nil
+}
+
+func TestMultiProviderOptionalEnricher(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		err         error
+		wantPartial bool
+	}{
+		{"tool missing", &CommandError{Name: "ioreg", Err: ErrToolMissing}, false},
+		{"non-zero exit", &CommandError{Name: "ioreg", Err: ErrNonZeroExit, ExitCode: 1}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				return nil, tt.err
+			})
+			m := &MultiProvider{
+				Providers: []Provider{staticProvider{{Name: "Stick", LocationID: 0x14100000}}},
+				Enrichers: []Enricher{OptionalEnricher{IORegEnricher{Runner: runner}}},
+			}
+			uis, err := m.Discover(context.Background())
+			if len(uis) != 1 {
+				t.Fatalf("got %d devices, want 1", len(uis))
+			}
+			var perr *PartialError
+			if got := errors.As(err, &perr); got != tt.wantPartial {
+				t.Fatalf("got error %v, want a partial error: %t", err, tt.wantPartial)
+			}
+			if tt.wantPartial && !errors.Is(perr.Errs[0], ErrNonZeroExit) {
+				t.Errorf("partial error is %v", perr.Errs[0])
+			}
+		})
+	}
+}
+
+func TestProviderEnrichersOptional(t *testing.T) {
+	// a single failing enricher must not lose what the provider found
+	for _, pi := range Providers() {
+		if pi.Enrichers == nil {
+			continue
+		}
+		for _, e := range pi.Enrichers(ProviderOptions{}) {
+			if _, ok := e.(OptionalEnricher); !ok {
+				t.Errorf("%s: enricher %T is not optional", pi.Name, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RedactMode is how a Redactor replaces identifying values.
+type RedactMode string
+
+const (
+	RedactDrop RedactMode = "drop" // remove the value
+	RedactMask RedactMode = "mask" // keep its shape, hide its characters
+	RedactHMAC RedactMode = "hmac" // a keyed pseudonym of the same shape
+)
+
+// RedactKeyEnv holds the key of RedactHMAC pseudonyms.
+const RedactKeyEnv = "USBINFO_REDACT_KEY"
+
+// Redactor removes identifying values from the model before it is
+// rendered: serial numbers, disk IDs, volume and partition UUIDs, volume
+// names and partition labels, user names in mount points and snapshot
+// paths, and the same values in the raw descriptors, device links and
+// warnings. The same value always gets the same replacement, and with
+// RedactHMAC and the same key it does so across runs, so a device can be
+// followed through reports without being identified. A nil *Redactor
+// leaves everything as it is; a Redactor literal without a Mode drops.
+type Redactor struct {
+	Mode RedactMode
+	Key  []byte // for RedactHMAC
+
+	seen map[string]string // value -> replacement, for scrubbing text
+	text *strings.Replacer // built from seen on demand
+}
+
+// NewRedactor returns a Redactor for a mode; RedactHMAC needs a key.
+func NewRedactor(mode RedactMode, key []byte) (*Redactor, error) {
+	switch mode {
+	case RedactDrop, RedactMask:
+	case RedactHMAC:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("hmac redaction needs a key in $%s", RedactKeyEnv)
+		}
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q, supported are: drop, mask, hmac", mode)
+	}
+	return &Redactor{Mode: mode, Key: key, seen: make(map[string]string)}, nil
+}
+
+// Redact replaces the identifying values of sticks and of the devices of
+// buses in place.
+func (r *Redactor) Redact(uis []*USBInfo, buses []*USBBus) {
+	r.walk(uis, buses, true)
+}
+
+// Learn records the identifying values of sticks and buses without
+// replacing them, for Text to scrub them from what was derived from them,
+// such as the changes of a diff.
+func (r *Redactor) Learn(uis []*USBInfo, buses []*USBBus) {
+	r.walk(uis, buses, false)
+}
+
+// Text replaces the values redacted or learnt so far in free text, in
+// upper and lower case too.
+func (r *Redactor) Text(s string) string {
+	if r == nil || len(r.seen) == 0 {
+		return s
+	}
+	if r.text == nil {
+		values := make([]string, 0, 3*len(r.seen))
+		repl := make(map[string]string, 3*len(r.seen))
+		for v, rv := range r.seen {
+			for _, c := range []func(string) string{func(s string) string { return s }, strings.ToLower, strings.ToUpper} {
+				if _, ok := repl[c(v)]; !ok {
+					values = append(values, c(v))
+					repl[c(v)] = c(rv)
+				}
+			}
+		}
+		// longer values first, so that none is left half replaced after a
+		// shorter one that it contains; then in a stable order
+		sort.Slice(values, func(i, j int) bool {
+			if len(values[i]) != len(values[j]) {
+				return len(values[i]) > len(values[j])
+			}
+			return values[i] < values[j]
+		})
+		pairs := make([]string, 0, 2*len(values))
+		for _, v := range values {
+			pairs = append(pairs, v, repl[v])
+		}
+		r.text = strings.NewReplacer(pairs...)
+	}
+	return r.text.Replace(s)
+}
+
+func (r *Redactor) walk(uis []*USBInfo, buses []*USBBus, apply bool) {
+	if r == nil {
+		return
+	}
+	set := func(p *string, v string) {
+		if apply {
+			*p = v
+		}
+	}
+	for _, ui := range uis {
+		set(&ui.SerialNumber, r.value(ui.SerialNumber))
+		set(&ui.Source, r.path(ui.Source))
+		for _, mi := range ui.Media {
+			set(&mi.DiskID, r.value(mi.DiskID))
+			for _, vi := range mi.Volumes {
+				set(&vi.UUID, r.value(vi.UUID))
+				set(&vi.PartitionUUID, r.value(vi.PartitionUUID))
+				set(&vi.MountPoint, r.mountPoint(vi))
+				set(&vi.Name, r.label(vi.Name, vi.Content))
+				set(&vi.PartitionLabel, r.label(vi.PartitionLabel, vi.Content))
+			}
+		}
+		if d := ui.Descriptors; d != nil {
+			if i := d.Device.SerialNumberIndex; i != 0 && d.Strings[i] != "" {
+				if apply {
+					d.Strings[i] = r.value(d.Strings[i])
+				} else {
+					r.value(d.Strings[i])
+				}
+			}
+			if d.BOS != nil {
+				for _, c := range d.BOS.Capabilities {
+					if c.Type == capContainerID {
+						r.containerID(c, apply)
+					}
+				}
+			}
+		}
+	}
+	WalkUSBDevices(buses, func(_ *USBBus, d *USBDevice, _ int) bool {
+		set(&d.SerialNumber, r.value(d.SerialNumber))
+		return true
+	})
+	for _, b := range buses {
+		set(&b.Source, r.path(b.Source))
+	}
+	r.text = nil
+	if !apply {
+		return
+	}
+	// text fields last, once all values are known
+	for _, ui := range uis {
+		for i, w := range ui.Warnings {
+			ui.Warnings[i] = r.Text(w)
+		}
+		for _, mi := range ui.Media {
+			for i, l := range mi.Links {
+				mi.Links[i] = r.Text(l)
+			}
+		}
+	}
+	WalkUSBDevices(buses, func(_ *USBBus, d *USBDevice, _ int) bool {
+		for i, w := range d.Warnings {
+			d.Warnings[i] = r.Text(w)
+		}
+		return true
+	})
+}
+
+// value returns the replacement of an identifying value, "" for "".
+func (r *Redactor) value(s string) string {
+	if s == "" {
+		return ""
+	}
+	rv, ok := r.seen[s]
+	if !ok {
+		rv = r.replace(s)
+		r.remember(s, rv)
+	}
+	return rv
+}
+
+// remember records the replacement of a value for Text.
+func (r *Redactor) remember(s, rv string) {
+	if r.seen == nil {
+		r.seen = make(map[string]string)
+	}
+	r.seen[s] = rv
+}
+
+// label returns the replacement of a volume name or partition label, which
+// users choose, unless it only names the partition's content, such as EFI.
+// Text scrubs it where warnings quote it and in by-label links, not
+// everywhere: short labels such as "USB" are common words too.
+func (r *Redactor) label(s, content string) string {
+	if s == "" || s == content {
+		return s
+	}
+	rv := r.replace(s)
+	r.remember(strconv.Quote(s), strconv.Quote(rv))
+	for _, dir := range []string{"/by-label/", "/by-partlabel/"} {
+		r.remember(dir+s, dir+rv)
+	}
+	return rv
+}
+
+// mountPoint redacts the user name in a volume's mount point, and its
+// name, by which macOS and desktop environments name mount points; with
+// RedactDrop "volume" takes its place.
+func (r *Redactor) mountPoint(vi *VolumeInfo) string {
+	mp := r.path(vi.MountPoint)
+	if vi.Name == "" || vi.Name == vi.Content || path.Base(mp) != vi.Name {
+		return mp
+	}
+	rv := r.replace(vi.Name)
+	if rv == "" {
+		rv = "volume"
+	}
+	mp = path.Join(path.Dir(mp), rv)
+	r.remember(vi.MountPoint, mp)
+	return mp
+}
+
+func (r *Redactor) replace(s string) string {
+	switch r.Mode {
+	case RedactMask:
+		return r.reshape(s, strings.Repeat("x", len(s)))
+	case RedactHMAC:
+		return r.reshape(s, r.digits(s, len(s)))
+	}
+	return ""
+}
+
+// reshape replaces the letters and digits of s, in order, by those of
+// with, keeping the punctuation and the case of s if it has only one.
+func (r *Redactor) reshape(s, with string) string {
+	upper := strings.ToUpper(s) == s
+	var buf strings.Builder
+	i := 0
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			buf.WriteRune(c)
+			continue
+		}
+		d := with[i]
+		i++
+		if upper {
+			buf.WriteString(strings.ToUpper(string(d)))
+		} else {
+			buf.WriteByte(d)
+		}
+	}
+	return buf.String()
+}
+
+// digits returns n hex digits of the HMAC-SHA256 of s.
+func (r *Redactor) digits(s string, n int) string {
+	var buf strings.Builder
+	for i := 0; buf.Len() < n; i++ {
+		mac := hmac.New(sha256.New, r.Key)
+		mac.Write([]byte{byte(i)})
+		mac.Write([]byte(s))
+		buf.WriteString(hex.EncodeToString(mac.Sum(nil)))
+	}
+	return buf.String()[:n]
+}
+
+// userPath matches the user name in home directories and in the mount
+// points desktop environments create: /Users/<user>, /home/<user>,
+// /media/<user>/<volume> and /run/media/<user>/<volume>.
+var userPath = regexp.MustCompile(`^(/Users|/home)/([^/]+)(/|$)|^(/media|/run/media)/([^/]+)/`)
+
+// path replaces the user name in a path; RedactDrop puts "user" in its
+// place, as the path would not make sense without.
+func (r *Redactor) path(p string) string {
+	m := userPath.FindStringSubmatchIndex(p)
+	if m == nil {
+		return p
+	}
+	start, end := m[4], m[5]
+	if start < 0 {
+		start, end = m[10], m[11]
+	}
+	user := p[start:end]
+	if user == "Shared" && strings.HasPrefix(p, "/Users/") {
+		return p
+	}
+	rv := r.replace(user)
+	if rv == "" {
+		rv = "user"
+	}
+	// scrub the home directory from text, not the bare user name that
+	// could be any word
+	r.remember(p[:end], p[:start]+rv)
+	return p[:start] + rv + p[end:]
+}
+
+// containerID redacts a BOS container ID, both the GUID and the bytes it
+// was decoded from: zeros for RedactDrop and RedactMask, the start of
+// the HMAC for RedactHMAC.
+func (r *Redactor) containerID(c *DeviceCapability, apply bool) {
+	if c.ContainerID == "" {
+		return
+	}
+	var b [16]byte
+	rv := ""
+	switch r.Mode {
+	case RedactMask:
+		rv = r.replace(c.ContainerID)
+	case RedactHMAC:
+		mac := hmac.New(sha256.New, r.Key)
+		mac.Write([]byte(c.ContainerID))
+		copy(b[:], mac.Sum(nil))
+		rv = formatGUID(b[:])
+	}
+	r.remember(c.ContainerID, rv)
+	if !apply {
+		return
+	}
+	if len(c.Data) >= 17 {
+		copy(c.Data[1:17], b[:])
+	}
+	c.ContainerID = rv
+}
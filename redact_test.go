@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testRedactStick() *USBInfo {
+	return &USBInfo{
+		Name:         "Ultra",
+		SerialNumber: "4C530001230512105341",
+		Source:       "/home/alice/snapshots/ultra.json",
+		Media: []*MediaInfo{{
+			DevName: "sdb",
+			DiskID:  "5B3C9E2A-1D47-4F0B-9A61-3E2D8C7B6A50",
+			Links:   []string{"/dev/disk/by-label/Holidays", "/dev/disk/by-id/usb-SanDisk_Ultra_4C530001230512105341-0:0"},
+			Volumes: []*VolumeInfo{
+				{DevName: "sdb1", Name: "EFI", Content: "EFI", PartitionLabel: "EFI", UUID: "1111-2222"},
+				{DevName: "sdb2", Name: "Holidays", PartitionLabel: "Photos", Content: "Microsoft Basic Data",
+					UUID: "3E8C-1A2B", Mounted: true, MountPoint: "/media/alice/Holidays"},
+			},
+		}},
+		Warnings: []string{`sdb2 label mismatch: "Holidays" vs. "HOLIDAYS" from udev`},
+	}
+}
+
+func TestRedactorLiteral(t *testing.T) {
+	// the zero value of the unexported fields must do
+	for _, mode := range []RedactMode{"", RedactDrop, RedactMask, RedactHMAC} {
+		r := &Redactor{Mode: mode, Key: []byte("k")}
+		ui := testRedactStick()
+		r.Redact([]*USBInfo{ui}, nil)
+		if strings.Contains(ui.SerialNumber, "4C53") {
+			t.Errorf("%q: serial number %q not redacted", mode, ui.SerialNumber)
+		}
+		_ = r.Text("Holidays")
+	}
+}
+
+func TestRedactorMask(t *testing.T) {
+	r, err := NewRedactor(RedactMask, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui := testRedactStick()
+	r.Redact([]*USBInfo{ui}, nil)
+	mi := ui.Media[0]
+	efi, data := mi.Volumes[0], mi.Volumes[1]
+	for _, c := range []struct{ what, got, want string }{
+		{"serial number", ui.SerialNumber, "XXXXXXXXXXXXXXXXXXXX"},
+		{"source", ui.Source, "/home/xxxxx/snapshots/ultra.json"},
+		{"disk ID", mi.DiskID, "XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX"},
+		{"UUID", data.UUID, "XXXX-XXXX"},
+		// labels that name the content identify nobody
+		{"EFI name", efi.Name, "EFI"},
+		{"EFI partition label", efi.PartitionLabel, "EFI"},
+		{"name", data.Name, "xxxxxxxx"},
+		{"partition label", data.PartitionLabel, "xxxxxx"},
+		{"mount point", data.MountPoint, "/media/xxxxx/xxxxxxxx"},
+		{"label link", mi.Links[0], "/dev/disk/by-label/xxxxxxxx"},
+		{"ID link", mi.Links[1], "/dev/disk/by-id/usb-SanDisk_Ultra_XXXXXXXXXXXXXXXXXXXX-0:0"},
+		{"warning", ui.Warnings[0], `sdb2 label mismatch: "xxxxxxxx" vs. "XXXXXXXX" from udev`},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s is %q, want %q", c.what, c.got, c.want)
+		}
+	}
+	if got := r.Text("failed to statfs /media/alice/Holidays"); got != "failed to statfs /media/xxxxx/xxxxxxxx" {
+		t.Errorf("Text scrubbed the mount point to %q", got)
+	}
+}
+
+func TestRedactorDrop(t *testing.T) {
+	r, _ := NewRedactor(RedactDrop, nil)
+	ui := testRedactStick()
+	r.Redact([]*USBInfo{ui}, nil)
+	data := ui.Media[0].Volumes[1]
+	if ui.SerialNumber != "" || data.UUID != "" || data.Name != "" {
+		t.Errorf("got serial %q, UUID %q, name %q", ui.SerialNumber, data.UUID, data.Name)
+	}
+	if data.MountPoint != "/media/user/volume" {
+		t.Errorf("mount point is %q", data.MountPoint)
+	}
+}
+
+func TestRedactorHMAC(t *testing.T) {
+	if _, err := NewRedactor(RedactHMAC, nil); err == nil {
+		t.Error("got no error without a key")
+	}
+	redact := func(key string) *USBInfo {
+		r, err := NewRedactor(RedactHMAC, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ui := testRedactStick()
+		r.Redact([]*USBInfo{ui}, nil)
+		return ui
+	}
+	a, b, c := redact("one"), redact("one"), redact("two")
+	if a.SerialNumber != b.SerialNumber || a.Media[0].Volumes[1].Name != b.Media[0].Volumes[1].Name {
+		t.Error("the same key gave different pseudonyms")
+	}
+	if a.SerialNumber == c.SerialNumber {
+		t.Error("different keys gave the same pseudonym")
+	}
+	if len(a.SerialNumber) != 20 || a.SerialNumber == "4C530001230512105341" || strings.ToUpper(a.SerialNumber) != a.SerialNumber {
+		t.Errorf("pseudonym %q does not have the shape of the serial number", a.SerialNumber)
+	}
+}
+
+func TestRedactorNil(t *testing.T) {
+	var r *Redactor
+	ui := testRedactStick()
+	r.Redact([]*USBInfo{ui}, nil)
+	if ui.SerialNumber != "4C530001230512105341" || r.Text("x") != "x" {
+		t.Error("a nil Redactor changed something")
+	}
+}
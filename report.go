@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"time"
+)
+
+// reportFullPercent is how full a mounted volume must be to be warned about.
+const reportFullPercent = 90
+
+// Report is what the report command renders: the sticks, the USB topology
+// they are in, and what looked wrong while gathering them.
+type Report struct {
+	Title     string
+	Generated time.Time
+	Sources   []string // snapshot files, or the host name for the live system
+	Sticks    []*USBInfo
+	Buses     []*USBBus // nil if the provider knows no topology
+	Warnings  []ReportWarning
+}
+
+// ReportWarning is an entry of the warnings section of a report.
+type ReportWarning struct {
+	Subject string // the stick, volume or step the warning is about
+	Message string
+}
+
+// newReport collects the sources of the sticks and buses and warns about
+// merge inconsistencies and volumes that are nearly full.
+func newReport(title string, uis []*USBInfo, buses []*USBBus) *Report {
+	r := &Report{Title: title, Generated: time.Now(), Sticks: uis, Buses: buses}
+	seen := make(map[string]bool)
+	addSource := func(s string) {
+		if s == "" {
+			s, _ = os.Hostname()
+			if s == "" {
+				s = "this system"
+			}
+		}
+		if !seen[s] {
+			seen[s] = true
+			r.Sources = append(r.Sources, s)
+		}
+	}
+	for _, ui := range uis {
+		addSource(ui.Source)
+		for _, w := range ui.Warnings {
+			r.warn(stickLabel(ui), "%s", w)
+		}
+		for _, mi := range ui.Media {
+			for _, vi := range mi.Volumes {
+				if volumeFull(vi) {
+					subject := vi.DevName
+					if vi.Name != "" {
+						subject += " (" + vi.Name + ")"
+					}
+					r.warn(subject, "%d%% full, %s free", usedPercent(vi), humanSize(vi.Free))
+				}
+			}
+		}
+	}
+	for _, b := range buses {
+		addSource(b.Source)
+	}
+	WalkUSBDevices(buses, func(b *USBBus, d *USBDevice, _ int) bool {
+		for _, w := range d.Warnings {
+			r.warn(b.Name+" "+orDash(d.Name), "%s", w)
+		}
+		return true
+	})
+	return r
+}
+
+func (r *Report) warn(subject, format string, args ...any) {
+	r.Warnings = append(r.Warnings, ReportWarning{Subject: subject, Message: fmt.Sprintf(format, args...)})
+}
+
+// stickLabel names a stick in a report: its name and its USBKey.
+func stickLabel(ui *USBInfo) string {
+	return orDash(ui.Name) + " (" + USBKey(ui) + ")"
+}
+
+// usedPercent is how full a mounted volume is, 0 if unmounted or unknown.
+func usedPercent(vi *VolumeInfo) int {
+	if !vi.Mounted || vi.Size <= 0 || vi.Free > vi.Size {
+		return 0
+	}
+	return int((vi.Size - vi.Free) * 100 / vi.Size)
+}
+
+func volumeFull(vi *VolumeInfo) bool {
+	return usedPercent(vi) >= reportFullPercent
+}
+
+var reportHTML = htmltemplate.Must(htmltemplate.New("report").
+	Funcs(htmltemplate.FuncMap(templateFuncs)).
+	Funcs(htmltemplate.FuncMap{"usedPercent": usedPercent, "volumeFull": volumeFull, "stickLabel": stickLabel}).
+	Parse(reportHTMLText))
+
+// writeHTMLReport writes the report as a single HTML page with its CSS and
+// JavaScript inline.
+func writeHTMLReport(w io.Writer, r *Report) error {
+	return reportHTML.Execute(w, r)
+}
+
+const reportHTMLText = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="generator" content="usbinfo">
+<title>{{.Title}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 2em auto; max-width: 72em; padding: 0 1em; }
+h1 { font-size: 1.6em; margin-bottom: 0.2em; }
+h2 { font-size: 1.2em; border-bottom: 1px solid #ddd; padding-bottom: 0.2em; margin-top: 2em; }
+.meta { color: #666; }
+code, .mono { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 0.95em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #eee; vertical-align: top; }
+th { background: #f5f5f5; }
+table.sortable th { cursor: pointer; user-select: none; }
+table.sortable th::after { content: " \2195"; color: #bbb; }
+table.sortable th[aria-sort=ascending]::after { content: " \2191"; color: #222; }
+table.sortable th[aria-sort=descending]::after { content: " \2193"; color: #222; }
+td.num, th.num { text-align: right; }
+.bar { display: inline-block; width: 10em; height: 0.8em; background: #e8e8e8; border-radius: 0.2em; overflow: hidden; vertical-align: middle; }
+.bar span { display: block; height: 100%; background: #4a90d9; }
+.bar.full span { background: #d9534f; }
+ul.tree, ul.tree ul { list-style: none; padding-left: 1.4em; margin: 0; }
+ul.tree { padding-left: 0; }
+ul.tree li { margin: 0.15em 0; }
+ul.tree summary { cursor: pointer; }
+ul.tree .leaf { padding-left: 1.1em; }
+.tag { font-size: 0.8em; color: #fff; background: #888; border-radius: 0.3em; padding: 0 0.35em; margin-left: 0.3em; }
+.storage > summary, .storage > .leaf { font-weight: bold; }
+.storage .tag { background: #4a90d9; }
+.dim { color: #888; }
+.warnings li { margin: 0.2em 0; }
+.ok { color: #3c763d; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}} from {{range $i, $s := .Sources}}{{if $i}}, {{end}}<code>{{$s}}</code>{{end}}.
+{{len .Sticks}} USB stick{{if ne (len .Sticks) 1}}s{{end}}{{with .Warnings}}, {{len .}} warning{{if ne (len .) 1}}s{{end}}{{end}}.</p>
+
+<h2 id="warnings">Warnings</h2>
+{{with .Warnings}}<ul class="warnings">
+{{range .}}<li><strong>{{.Subject}}</strong>: {{.Message}}</li>
+{{end}}</ul>
+{{else}}<p class="ok">None.</p>
+{{end}}
+<h2 id="storage">USB storage</h2>
+{{if .Sticks}}<table class="sortable">
+<thead><tr><th>Disk</th><th>Name</th><th>ID</th><th>Serial</th><th class="num" data-type="number">Size</th><th>Volumes</th><th class="num" data-type="number">Free</th><th>Speed</th><th>Source</th></tr></thead>
+<tbody>
+{{range .Sticks}}<tr><td class="mono">{{range $i, $m := .Media}}{{if $i}}, {{end}}{{$m.DevName}}{{end}}</td><td>{{.Name}}</td><td class="mono">{{id .}}</td><td class="mono">{{.SerialNumber}}</td><td class="num" data-value="{{size .}}">{{humanize (size .)}}</td><td>{{volumeNames .}}</td><td class="num" data-value="{{free .}}">{{humanize (free .)}}</td><td>{{.Speed}}</td><td>{{.Source}}</td></tr>
+{{end}}</tbody>
+</table>
+{{else}}<p class="dim">No USB storage found.</p>
+{{end}}
+<h2 id="volumes">Volumes</h2>
+{{if .Sticks}}<table class="sortable">
+<thead><tr><th>Volume</th><th>Name</th><th>Stick</th><th>File system</th><th class="num" data-type="number">Size</th><th data-type="number">Used</th><th>Mount point</th></tr></thead>
+<tbody>
+{{range $ui := .Sticks}}{{range .Media}}{{range .Volumes}}<tr><td class="mono">{{.DevName}}</td><td>{{.Name}}</td><td>{{stickLabel $ui}}</td><td>{{.FileSystem}}</td><td class="num" data-value="{{.Size}}">{{humanize .Size}}</td>{{if .Mounted}}{{$p := usedPercent .}}<td data-value="{{$p}}"><span class="bar{{if volumeFull .}} full{{end}}" title="{{humanize .Free}} free"><span style="width: {{$p}}%"></span></span> {{$p}}%</td><td class="mono">{{.MountPoint}}{{if not .Writable}} <span class="dim">(read-only)</span>{{end}}</td>{{else}}<td data-value="-1" class="dim">-</td><td class="dim">not mounted</td>{{end}}</tr>
+{{end}}{{end}}{{end}}</tbody>
+</table>
+{{else}}<p class="dim">No volumes found.</p>
+{{end}}
+<h2 id="topology">USB topology</h2>
+{{if .Buses}}<p><button type="button" onclick="toggleTree(true)">Expand all</button> <button type="button" onclick="toggleTree(false)">Collapse all</button></p>
+<ul class="tree">
+{{range .Buses}}<li><details open><summary><strong>{{.Name}}</strong>{{with .HostController}} <span class="dim">{{.}}</span>{{end}}{{with .Speed}} <span class="dim">{{.}}</span>{{end}}{{with .Source}} <span class="dim">[{{.}}]</span>{{end}}</summary>
+{{with .Devices}}<ul>
+{{range .}}{{template "device" .}}{{end}}</ul>
+{{end}}</details></li>
+{{end}}</ul>
+{{else}}<p class="dim">The USB topology is not available.</p>
+{{end}}
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  var body = table.tBodies[0];
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, col) {
+    th.addEventListener("click", function () {
+      var asc = th.getAttribute("aria-sort") !== "ascending";
+      Array.prototype.forEach.call(table.tHead.rows[0].cells, function (h) { h.removeAttribute("aria-sort"); });
+      th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+      var num = th.dataset.type === "number";
+      var key = function (row) {
+        var cell = row.cells[col];
+        var v = cell.dataset.value !== undefined ? cell.dataset.value : cell.textContent.trim();
+        return num ? Number(v) : v;
+      };
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = key(a), y = key(b);
+        var d = num ? x - y : x.localeCompare(y, undefined, {numeric: true});
+        return asc ? d : -d;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+function toggleTree(open) {
+  document.querySelectorAll("ul.tree details").forEach(function (d) { d.open = open; });
+}
+</script>
+</body>
+</html>
+{{define "device"}}<li{{if .Storage}} class="storage"{{end}}>{{if or .Devices .Storage}}<details open><summary>{{template "deviceLabel" .}}</summary>
+<ul>
+{{with .Storage}}{{range .Media}}<li><details open><summary><span class="mono">{{.DevName}}</span> {{humanize .Size}}{{with .PartitionName}} <span class="dim">{{.}}</span>{{end}}{{if .Boot}}{{if .Boot.Bootable}}<span class="tag">bootable</span>{{end}}{{end}}</summary>
+<ul>
+{{range .Volumes}}<li class="leaf"><span class="mono">{{.DevName}}</span>{{with .Name}} &ldquo;{{.}}&rdquo;{{end}} {{humanize .Size}}{{with .FileSystem}} <span class="dim">{{.}}</span>{{end}}{{if .Mounted}} at <span class="mono">{{.MountPoint}}</span>{{else}} <span class="dim">not mounted</span>{{end}}</li>
+{{end}}</ul>
+</details></li>
+{{end}}{{end}}{{range .Devices}}{{template "device" .}}{{end}}</ul>
+</details>{{else}}<span class="leaf">{{template "deviceLabel" .}}</span>{{end}}</li>
+{{end}}{{define "deviceLabel"}}{{or .Name "-"}} <span class="mono dim">{{printf "%04x:%04x" .VendorID .ProductID}}</span>{{with .Speed}} <span class="dim">{{.}}</span>{{end}}{{if .IsHub}}<span class="tag">hub</span>{{end}}{{if .Storage}}<span class="tag">storage</span>{{end}}{{end}}`
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// CommandRunner runs an external command and returns its standard output.
+// It exists so that backends shelling out to system tools can be fed canned
+// output in tests.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// RunnerFunc adapts a function to a CommandRunner, e.g. a fake returning
+// fixture output.
+type RunnerFunc func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+func (f RunnerFunc) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return f(ctx, name, args...)
+}
+
+// The kinds of CommandError, to be told apart with errors.Is.
+var (
+	ErrToolMissing    = errors.New("tool not installed")
+	ErrNonZeroExit    = errors.New("non-zero exit status")
+	ErrOutputTooLarge = errors.New("output too large")
+	ErrBadOutput      = errors.New("bad output")
+)
+
+// CommandError is the error of a command that could not be run, failed or
+// produced output that could not be parsed.
+type CommandError struct {
+	Name     string
+	Args     []string
+	Err      error  // ErrToolMissing, ErrNonZeroExit, ... or a context error
+	ExitCode int    // ErrNonZeroExit only
+	Stderr   string // what the command wrote to stderr, if anything
+	Cause    error  // underlying error, e.g. a JSON syntax error
+}
+
+func (e *CommandError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %v", e.Name, e.Err)
+	if errors.Is(e.Err, ErrNonZeroExit) {
+		fmt.Fprintf(&buf, " %d", e.ExitCode)
+	}
+	if e.Cause != nil {
+		fmt.Fprintf(&buf, ": %v", e.Cause)
+	}
+	if e.Stderr != "" {
+		fmt.Fprintf(&buf, ": %s", e.Stderr)
+	}
+	return buf.String()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// DefaultMaxOutput caps what ExecRunner reads from a command's stdout.
+	DefaultMaxOutput = 64 << 20
+	// maxStderr caps the stderr kept for CommandError.
+	maxStderr = 4096
+)
+
+// ExecRunner runs commands on the local system.
+type ExecRunner struct {
+	Timeout   time.Duration // 0 means only the context's deadline applies
+	MaxOutput int64         // 0 means DefaultMaxOutput
+}
+
+func (r ExecRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	// a command that writes too much is killed rather than left blocked on
+	// a full pipe
+	ctx, kill := context.WithCancel(ctx)
+	defer kill()
+	max := r.MaxOutput
+	if max <= 0 {
+		max = DefaultMaxOutput
+	}
+	stdout := &limitedBuffer{max: max, overflow: kill}
+	stderr := &limitedBuffer{max: maxStderr}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+
+	cerr := &CommandError{Name: name, Args: args, Stderr: strings.TrimSpace(stderr.String())}
+	var exitErr *exec.ExitError
+	switch {
+	case stdout.overflowed:
+		cerr.Err = ErrOutputTooLarge
+		cerr.Cause = fmt.Errorf("more than %d bytes", max)
+	case err == nil:
+		return stdout.Bytes(), nil
+	case errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist):
+		cerr.Err = ErrToolMissing
+		cerr.Cause = err
+	case ctx.Err() != nil:
+		cerr.Err = ctx.Err()
+	case errors.As(err, &exitErr):
+		cerr.Err = ErrNonZeroExit
+		cerr.ExitCode = exitErr.ExitCode()
+	default:
+		cerr.Err = err
+	}
+	return nil, cerr
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the
+// rest, calling overflow (if set) once when that happens. It does not embed
+// bytes.Buffer, whose ReadFrom io.Copy would use instead of Write.
+type limitedBuffer struct {
+	buf        bytes.Buffer
+	max        int64
+	overflow   func()
+	overflowed bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.buf.Len()); int64(len(p)) > room {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		if !b.overflowed && b.overflow != nil {
+			b.overflow()
+		}
+		b.overflowed = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
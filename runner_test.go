@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestExecRunner(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	ctx := context.Background()
+	out, err := ExecRunner{}.Run(ctx, "sh", "-c", "echo hello")
+	if err != nil || string(out) != "hello\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	_, err = ExecRunner{}.Run(ctx, "usbinfo-no-such-tool")
+	if !errors.Is(err, ErrToolMissing) {
+		t.Errorf("got %v, want %v", err, ErrToolMissing)
+	}
+
+	_, err = ExecRunner{}.Run(ctx, "sh", "-c", "echo oops >&2; exit 3")
+	var cerr *CommandError
+	if !errors.As(err, &cerr) || !errors.Is(err, ErrNonZeroExit) || cerr.ExitCode != 3 || cerr.Stderr != "oops" {
+		t.Errorf("got %#v, want exit status 3 with stderr", err)
+	}
+
+	_, err = ExecRunner{MaxOutput: 1024}.Run(ctx, "sh", "-c", "while :; do echo 0123456789; done")
+	if !errors.Is(err, ErrOutputTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrOutputTooLarge)
+	}
+}
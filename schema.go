@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// schemaDescriptions documents the types of DocumentSchema, by $defs name.
+var schemaDescriptions = map[string]string{
+	"Document":  "USB storage devices found by usbinfo, and optionally the USB topology they sit in",
+	"Device":    "a USB storage device",
+	"Media":     "a disk of a USB storage device",
+	"Volume":    "a partition or file system of a disk",
+	"Partition": "where a volume is in the partition table",
+	"Boot":      "what a firmware would boot from the disk",
+	"OS":        "the operating system an installer media carries",
+	"Bus":       "a USB host controller and the devices behind it",
+	"USBDevice": "a node of the USB topology; storage names the key of an entry in devices",
+	"HexID":     "a numeric ID; read from a hex string or an integer too",
+	"Size":      "a size in bytes, with a humanized form for display",
+}
+
+// DocumentSchema returns the JSON Schema (draft 2020-12) of Document. It is
+// generated from the Go types, so the two cannot drift apart: fields are
+// required unless they are omitted when empty.
+func DocumentSchema() map[string]any {
+	g := schemaGen{defs: make(map[string]any)}
+	g.ref(reflect.TypeOf(Document{}))
+	root := g.defs["Document"].(map[string]any)
+	delete(g.defs, "Document")
+	s := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "usbinfo inventory",
+		"$defs":   g.defs,
+	}
+	for k, v := range root {
+		s[k] = v
+	}
+	s["properties"].(map[string]any)["schema_version"] = map[string]any{
+		"type": "integer", "const": SchemaVersion,
+	}
+	return s
+}
+
+type schemaGen struct {
+	defs map[string]any
+}
+
+// ref returns the schema of a type, registering structs under $defs.
+func (g schemaGen) ref(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.ref(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": g.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"propertyNames":        map[string]any{"pattern": "^[0-9]+$"},
+			"additionalProperties": g.ref(t.Elem()),
+		}
+	case reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "JSON")
+		if _, ok := g.defs[name]; !ok {
+			g.defs[name] = nil // placeholder for recursive types
+			g.defs[name] = g.object(t, name)
+		}
+		return map[string]any{"$ref": "#/$defs/" + name}
+	}
+	panic("no JSON schema for " + t.String())
+}
+
+func (g schemaGen) object(t reflect.Type, name string) map[string]any {
+	props := make(map[string]any)
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		props[tag] = g.ref(f.Type)
+		if opts != "omitempty" {
+			required = append(required, tag)
+		}
+	}
+	s := map[string]any{"type": "object", "properties": props, "required": required}
+	if t == reflect.TypeOf(HexID{}) {
+		// as accepted by HexID.UnmarshalJSON
+		s["required"] = []string{}
+		props["hex"] = map[string]any{"type": "string", "pattern": "^0[xX][0-9a-fA-F]+$"}
+		s = map[string]any{"oneOf": []any{
+			s,
+			props["hex"],
+			map[string]any{"type": "integer", "minimum": 0},
+		}}
+	}
+	if d, ok := schemaDescriptions[name]; ok {
+		s["description"] = d
+	}
+	return s
+}
+
+// SchemaError is a value of a document that does not match DocumentSchema.
+type SchemaError struct {
+	Path    string // e.g. "$.devices[0].vendor_id"
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists everything wrong with a document.
+type ValidationError struct {
+	Errs []SchemaError
+}
+
+func (e *ValidationError) Error() string {
+	msg := "invalid document: " + e.Errs[0].Error()
+	if len(e.Errs) > 1 {
+		msg += fmt.Sprintf(" (and %d more)", len(e.Errs)-1)
+	}
+	return msg
+}
+
+// ValidateDocument checks a JSON document against DocumentSchema and
+// returns a *ValidationError with every mismatch found.
+func ValidateDocument(b []byte) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var x any
+	if err := d.Decode(&x); err != nil {
+		return fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+	s := DocumentSchema()
+	v := schemaValidator{defs: s["$defs"].(map[string]any)}
+	v.validate(s, x, "$")
+	if len(v.errs) > 0 {
+		return &ValidationError{Errs: v.errs}
+	}
+	return nil
+}
+
+// schemaValidator implements the parts of JSON Schema DocumentSchema uses.
+type schemaValidator struct {
+	defs map[string]any
+	errs []SchemaError
+}
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) validate(s map[string]any, x any, path string) {
+	if ref, ok := s["$ref"].(string); ok {
+		s = v.defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+	}
+	if alts, ok := s["oneOf"].([]any); ok {
+		v.oneOf(alts, x, path)
+		return
+	}
+	if t, ok := s["type"].(string); ok && !schemaTypeMatches(t, x) {
+		v.fail(path, "expected %s, got %s", t, schemaType(x))
+		return
+	}
+	if c, ok := s["const"]; ok && fmt.Sprint(x) != fmt.Sprint(c) {
+		v.fail(path, "must be %v, got %v", c, x)
+	}
+	if lo, ok := s["minimum"].(int); ok {
+		if n, ok := x.(json.Number); ok && strings.HasPrefix(n.String(), "-") && lo >= 0 {
+			v.fail(path, "must be at least %d, got %s", lo, n)
+		}
+	}
+	if p, ok := s["pattern"].(string); ok {
+		if str, ok := x.(string); ok && !regexp.MustCompile(p).MatchString(str) {
+			v.fail(path, "%q does not match %s", str, p)
+		}
+	}
+	switch x := x.(type) {
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, e := range x {
+				v.validate(items, e, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]any:
+		v.object(s, x, path)
+	}
+}
+
+func (v *schemaValidator) object(s map[string]any, x map[string]any, path string) {
+	if req, ok := s["required"].([]string); ok {
+		for _, k := range req {
+			if _, ok := x[k]; !ok {
+				v.fail(path, "missing property %q", k)
+			}
+		}
+	}
+	keys := make([]string, 0, len(x))
+	for k := range x {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	props, _ := s["properties"].(map[string]any)
+	for _, k := range keys {
+		p := path + "." + k
+		if ps, ok := props[k].(map[string]any); ok {
+			v.validate(ps, x[k], p)
+			continue
+		}
+		if pn, ok := s["propertyNames"].(map[string]any); ok {
+			v.validate(pn, k, p)
+		}
+		if as, ok := s["additionalProperties"].(map[string]any); ok {
+			v.validate(as, x[k], p)
+		}
+		// other unknown properties are allowed, for documents written by
+		// newer versions of the same schema
+	}
+}
+
+// oneOf validates against the alternative of the right type, so errors are
+// about that and not about all of them.
+func (v *schemaValidator) oneOf(alts []any, x any, path string) {
+	types := make([]string, 0, len(alts))
+	for _, a := range alts {
+		a := a.(map[string]any)
+		t, _ := a["type"].(string)
+		if schemaTypeMatches(t, x) {
+			v.validate(a, x, path)
+			return
+		}
+		types = append(types, t)
+	}
+	v.fail(path, "expected %s, got %s", strings.Join(types, " or "), schemaType(x))
+}
+
+func schemaTypeMatches(t string, x any) bool {
+	got := schemaType(x)
+	return got == t || (t == "number" && got == "integer")
+}
+
+// schemaType is the JSON Schema type of a value decoded with UseNumber.
+func schemaType(x any) string {
+	switch x := x.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(x.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", x)
+}
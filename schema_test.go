@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testDocumentMap returns the samples exported as a document, decoded into
+// maps for editing.
+func testDocumentMap(t *testing.T) map[string]any {
+	t.Helper()
+	uis, err := SampleBackend{}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewDocument(uis, nil).Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestValidateDocument(t *testing.T) {
+	device := func(m map[string]any) map[string]any {
+		return m["devices"].([]any)[0].(map[string]any)
+	}
+	for _, tt := range []struct {
+		name string
+		edit func(m map[string]any)
+		want []string // errors, empty for a valid document
+	}{
+		{"valid", func(m map[string]any) {}, nil},
+		{"unknown property", func(m map[string]any) { device(m)["added_later"] = true }, nil},
+		{"hex string ID", func(m map[string]any) { device(m)["vendor_id"] = "0x1f75" }, nil},
+		{"integer ID", func(m map[string]any) { device(m)["vendor_id"] = 8053 }, nil},
+		{"wrong type", func(m map[string]any) { device(m)["name"] = 42 },
+			[]string{"$.devices[0].name: expected string, got integer"}},
+		{"missing field", func(m map[string]any) { delete(device(m), "serial_number") },
+			[]string{`$.devices[0]: missing property "serial_number"`}},
+		{"unknown schema version", func(m map[string]any) { m["schema_version"] = 99 },
+			[]string{"$.schema_version: must be 1, got 99"}},
+		{"missing schema version", func(m map[string]any) { delete(m, "schema_version") },
+			[]string{`$: missing property "schema_version"`}},
+		{"bad hex", func(m map[string]any) { device(m)["vendor_id"] = map[string]any{"hex": "1f75", "value": 8053} },
+			[]string{`$.devices[0].vendor_id.hex: "1f75" does not match ^0[xX][0-9a-fA-F]+$`}},
+		{"negative ID", func(m map[string]any) { device(m)["vendor_id"] = -1 },
+			[]string{"$.devices[0].vendor_id: must be at least 0, got -1"}},
+		{"ID of the wrong type", func(m map[string]any) { device(m)["vendor_id"] = true },
+			[]string{"$.devices[0].vendor_id: expected object or string or integer, got boolean"}},
+		{"several errors", func(m map[string]any) { device(m)["name"] = nil; device(m)["speed"] = 1.5 },
+			[]string{"$.devices[0].name: expected string, got null", "$.devices[0].speed: expected string, got number"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testDocumentMap(t)
+			tt.edit(m)
+			b, err := json.Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ValidateDocument(b)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("got %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("got %v, want a ValidationError", err)
+			}
+			var got []string
+			for _, e := range verr.Errs {
+				got = append(got, e.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateDocumentNotJSON(t *testing.T) {
+	err := ValidateDocument([]byte("{"))
+	var verr *ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Errorf("got %v, want a decoding error", err)
+	}
+}
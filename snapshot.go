@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SnapshotBackend reads USB storage devices from captured reports instead of
+// the live system, e.g. collected from many machines. Each path is a file, a
+// directory (its regular files), a glob pattern or "-" for stdin; see
+// ParseSnapshot for the formats.
+type SnapshotBackend struct {
+	Paths []string
+	Stdin io.Reader // nil means os.Stdin
+	cache *snapshotCache
+}
+
+// snapshotCache holds the documents of the first read of a SnapshotBackend.
+type snapshotCache struct {
+	once sync.Once
+	docs []snapshotDoc
+	err  error
+}
+
+// maxSnapshotSize caps what is read of a single snapshot.
+const maxSnapshotSize = 64 << 20
+
+// snapshotDoc is a snapshot read into memory.
+type snapshotDoc struct {
+	label string
+	data  []byte
+}
+
+// Discover reads every snapshot and returns the USB storage devices of all
+// of them, each labelled with the snapshot it came from in USBInfo.Source.
+func (s SnapshotBackend) Discover(ctx context.Context) ([]*USBInfo, error) {
+	docs, err := s.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return discoverSnapshots(ctx, docs)
+}
+
+// Topology returns the USB buses of every system_profiler snapshot; lsblk
+// snapshots have none.
+func (s SnapshotBackend) Topology(ctx context.Context) ([]*USBBus, error) {
+	docs, err := s.documents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotTopology(ctx, docs)
+}
+
+func (s SnapshotBackend) documents(ctx context.Context) ([]snapshotDoc, error) {
+	if s.cache == nil {
+		return s.readDocuments(ctx)
+	}
+	s.cache.once.Do(func() {
+		s.cache.docs, s.cache.err = s.readDocuments(ctx)
+	})
+	return s.cache.docs, s.cache.err
+}
+
+func (s SnapshotBackend) readDocuments(ctx context.Context) ([]snapshotDoc, error) {
+	paths, err := expandSnapshotPaths(s.Paths)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]snapshotDoc, 0, len(paths))
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, label, err := s.read(p)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, snapshotDoc{label: label, data: b})
+	}
+	return docs, nil
+}
+
+func discoverSnapshots(ctx context.Context, docs []snapshotDoc) ([]*USBInfo, error) {
+	uis := make([]*USBInfo, 0)
+	for _, d := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ui, err := ParseSnapshot(d.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot %s: %w", d.label, err)
+		}
+		for _, u := range ui {
+			if u.Source == "" {
+				u.Source = d.label
+			}
+		}
+		uis = append(uis, ui...)
+	}
+	return uis, nil
+}
+
+func snapshotTopology(ctx context.Context, docs []snapshotDoc) ([]*USBBus, error) {
+	buses := make([]*USBBus, 0)
+	for _, d := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		bs, err := parseSnapshotTopology(d.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot %s: %w", d.label, err)
+		}
+		for _, b := range bs {
+			if b.Source == "" {
+				b.Source = d.label
+			}
+		}
+		buses = append(buses, bs...)
+	}
+	return buses, nil
+}
+
+// parseSnapshotTopology returns the USB buses of a system_profiler snapshot
+// or a Document, if it has them.
+func parseSnapshotTopology(b []byte) ([]*USBBus, error) {
+	if _, buses, ok, err := parseDocument(b); ok {
+		return buses, err
+	}
+	data, err := decodeSnapshot(b)
+	if err != nil || data == nil {
+		return nil, err // lsblk has no topology
+	}
+	bs, err := FindUSBTopology(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find USB topology: %w", err)
+	}
+	return bs, nil
+}
+
+// SampleBackend serves the sample system_profiler reports built into the
+// program, for trying it out without a Mac or a USB stick.
+type SampleBackend struct{}
+
+// The samples are the fixtures in testdata, see the fixture command.
+//
+//go:embed testdata/*.json
+var sampleFixtures embed.FS
+
+var sampleSnapshots = loadSamples(
+	"noPartition",    // an un-partitioned USB stick
+	"GPTPartitioned", // a GPT partitioned USB stick
+	"MBRPartitioned", // an MBR partitioned USB stick
+)
+
+func loadSamples(names ...string) []snapshotDoc {
+	docs := make([]snapshotDoc, len(names))
+	for i, name := range names {
+		b, err := sampleFixtures.ReadFile("testdata/" + name + ".json")
+		if err != nil {
+			panic(err) // embedded
+		}
+		docs[i] = snapshotDoc{label: "sample:" + name, data: b}
+	}
+	return docs
+}
+
+func (SampleBackend) Discover(ctx context.Context) ([]*USBInfo, error) {
+	return discoverSnapshots(ctx, sampleSnapshots)
+}
+
+func (SampleBackend) Topology(ctx context.Context) ([]*USBBus, error) {
+	return snapshotTopology(ctx, sampleSnapshots)
+}
+
+func (s SnapshotBackend) read(path string) ([]byte, string, error) {
+	var r io.Reader
+	label := path
+	if path == "-" {
+		label = "stdin"
+		r = s.Stdin
+		if r == nil {
+			r = os.Stdin
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := io.ReadAll(io.LimitReader(r, maxSnapshotSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read snapshot %s: %w", label, err)
+	}
+	if len(b) > maxSnapshotSize {
+		return nil, "", fmt.Errorf("snapshot %s larger than %d bytes", label, maxSnapshotSize)
+	}
+	return b, label, nil
+}
+
+// expandSnapshotPaths resolves directories and glob patterns into files, in
+// a stable order.
+func expandSnapshotPaths(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no snapshots given")
+	}
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p == "-" {
+			files = append(files, p)
+			continue
+		}
+		if strings.ContainsAny(p, "*?[") {
+			matches, err := filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snapshot pattern %q: %w", p, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no snapshots match %q", p)
+			}
+			sort.Strings(matches)
+			files = append(files, matches...)
+			continue
+		}
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+		}
+		n := len(files)
+		for _, e := range entries {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(p, e.Name()))
+			}
+		}
+		if len(files) == n {
+			return nil, fmt.Errorf("no snapshots in directory %s", p)
+		}
+	}
+	return files, nil
+}
+
+// Snapshot formats, as told by DetectSnapshotFormat.
+const (
+	FormatJSON  = "json"  // system_profiler -json SPUSBDataType, lsblk --json or a Document
+	FormatPlist = "plist" // system_profiler -xml SPUSBDataType
+	FormatText  = "text"  // system_profiler SPUSBDataType
+	FormatYAML  = "yaml"  // a Document as written by -o yaml
+)
+
+// DetectSnapshotFormat tells the format of a snapshot from its first bytes.
+func DetectSnapshotFormat(b []byte) (string, error) {
+	b = bytes.TrimLeft(b, " \t\r\n\ufeff")
+	switch {
+	case len(b) == 0:
+		return "", fmt.Errorf("empty snapshot")
+	case b[0] == '{' || b[0] == '[':
+		return FormatJSON, nil
+	case bytes.HasPrefix(b, []byte("<?xml")) || bytes.HasPrefix(b, []byte("<!DOCTYPE plist")) ||
+		bytes.HasPrefix(b, []byte("<plist")):
+		return FormatPlist, nil
+	case bytes.HasPrefix(b, []byte("USB:")):
+		return FormatText, nil
+	case bytes.HasPrefix(b, []byte("---")) || bytes.HasPrefix(b, []byte("schema_version:")) || b[0] == '#':
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unknown snapshot format")
+}
+
+// ParseSnapshot parses a snapshot in any of the supported formats.
+func ParseSnapshot(b []byte) ([]*USBInfo, error) {
+	if uis, _, ok, err := parseDocument(b); ok {
+		return uis, err
+	}
+	if isLsblkJSON(b) {
+		return ParseLsblk(bytes.NewReader(b))
+	}
+	data, err := decodeSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	return FindUSBStickInfo(data)
+}
+
+// parseDocument decodes a snapshot that is a Document, in JSON or YAML;
+// ok is false for the tools' output.
+func parseDocument(b []byte) (uis []*USBInfo, buses []*USBBus, ok bool, err error) {
+	format, err := DetectSnapshotFormat(b)
+	switch {
+	case err != nil:
+		return nil, nil, false, nil // reported by the other parsers
+	case format == FormatYAML:
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, nil, true, err
+		}
+	case format != FormatJSON || !isDocumentJSON(b):
+		return nil, nil, false, nil
+	}
+	doc, err := DecodeDocument(b)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	uis, buses, err = doc.Model()
+	return uis, buses, true, err
+}
+
+// yamlToJSON converts a YAML document to JSON, for the decoder and the
+// validator of documents, which only read JSON.
+func yamlToJSON(b []byte) ([]byte, error) {
+	v, err := DecodeYAML(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// isLsblkJSON tells lsblk --json output from system_profiler's.
+func isLsblkJSON(b []byte) bool {
+	var probe struct {
+		BlockDevices json.RawMessage `json:"blockdevices"`
+	}
+	return json.Unmarshal(b, &probe) == nil && probe.BlockDevices != nil
+}
+
+// decodeSnapshot decodes a system_profiler snapshot in any format into the
+// shape of the -json output; it returns nil for lsblk snapshots.
+func decodeSnapshot(b []byte) (any, error) {
+	format, err := DetectSnapshotFormat(b)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatPlist:
+		return systemProfilerPlist(b)
+	case FormatText:
+		return ParseSystemProfilerText(bytes.NewReader(b))
+	}
+	if isLsblkJSON(b) {
+		return nil, nil
+	}
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	return data, nil
+}
+
+// systemProfilerPlist turns `system_profiler -xml` output, an array of data
+// type reports, into the shape of the -json output.
+func systemProfilerPlist(b []byte) (any, error) {
+	v, err := DecodePlist(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	reports, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("plist root (%T) is not an array of reports", v)
+	}
+	for _, r := range reports {
+		m, ok := r.(map[string]any)
+		if ok && m["_dataType"] == "SPUSBDataType" {
+			items, _ := m["_items"].([]any)
+			return map[string]any{"SPUSBDataType": items}, nil
+		}
+	}
+	return nil, fmt.Errorf("plist has no SPUSBDataType report")
+}
+
+// spTextKeys maps the labels of the system_profiler text report to the keys
+// of its -json output.
+var spTextKeys = map[string]string{
+	"Product ID":             "product_id",
+	"Vendor ID":              "vendor_id",
+	"Version":                "bcd_device",
+	"Serial Number":          "serial_num",
+	"Speed":                  "device_speed",
+	"Manufacturer":           "manufacturer",
+	"Location ID":            "location_id",
+	"Current Available (mA)": "bus_power",
+	"Current Required (mA)":  "bus_power_used",
+	"Host Controller Driver": "host_controller",
+	"Capacity":               "size_in_bytes",
+	"Available":              "free_space_in_bytes",
+	"Removable Media":        "removable_media",
+	"BSD Name":               "bsd_name",
+	"Partition Map Type":     "partition_map_type",
+	"S.M.A.R.T. status":      "smart_status",
+	"File System":            "file_system",
+	"Writable":               "writable",
+	"Mount Point":            "mount_point",
+	"Content":                "iocontent",
+	"Volume UUID":            "volume_uuid",
+}
+
+// spTextSpeeds maps the speeds of the text report to the -json ones.
+var spTextSpeeds = map[string]string{
+	"Up to 1.5 Mb/s": "low_speed",
+	"Up to 12 Mb/s":  "full_speed",
+	"Up to 480 Mb/s": "high_speed",
+	"Up to 5 Gb/s":   "super_speed",
+	"Up to 10 Gb/s":  "super_speed_plus",
+	"Up to 20 Gb/s":  "super_speed_plus_by2",
+}
+
+// spTextNode is a "Name:" section of the text report.
+type spTextNode struct {
+	name     string
+	indent   int
+	values   map[string]string
+	children []*spTextNode
+}
+
+// ParseSystemProfilerText parses the text report of `system_profiler
+// SPUSBDataType`, whose nesting is only given by indentation, into the shape
+// of the -json output.
+func ParseSystemProfilerText(r io.Reader) (any, error) {
+	root := &spTextNode{indent: -1}
+	stack := []*spTextNode{root}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			continue
+		}
+		indent := len(line) - len(text)
+		for stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		top := stack[len(stack)-1]
+		if strings.HasSuffix(text, ":") {
+			node := &spTextNode{name: strings.TrimSuffix(text, ":"), indent: indent, values: make(map[string]string)}
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+			continue
+		}
+		k, v, ok := strings.Cut(text, ": ")
+		if !ok || top == root {
+			return nil, fmt.Errorf("line %d: unexpected %q", n, text)
+		}
+		top.values[k] = strings.TrimSpace(v)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read text report: %w", err)
+	}
+	if len(root.children) != 1 || root.children[0].name != "USB" {
+		return nil, fmt.Errorf("text report has no USB section")
+	}
+	buses := make([]any, 0)
+	for _, b := range root.children[0].children {
+		bus, err := b.toJSON()
+		if err != nil {
+			return nil, err
+		}
+		buses = append(buses, bus)
+	}
+	return map[string]any{"SPUSBDataType": buses}, nil
+}
+
+// toJSON converts a section into the map the -json output has for it:
+// "Media" and "Volumes" subsections become arrays, other subsections are
+// the devices attached, in "_items".
+func (n *spTextNode) toJSON() (map[string]any, error) {
+	m := map[string]any{"_name": n.name}
+	for k, v := range n.values {
+		key, ok := spTextKeys[k]
+		if !ok {
+			key = k
+		}
+		switch key {
+		case "size_in_bytes", "free_space_in_bytes":
+			// "63.91 GB (63,909,113,344 bytes)"
+			lp, rp := strings.LastIndexByte(v, '('), strings.LastIndex(v, " bytes)")
+			if lp < 0 || rp < lp {
+				return nil, fmt.Errorf("%s: invalid %s %q", n.name, k, v)
+			}
+			size, err := strconv.ParseInt(strings.ReplaceAll(v[lp+1:rp], ",", ""), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s %q: %w", n.name, k, v, err)
+			}
+			m[key] = float64(size)
+		case "device_speed":
+			if s, ok := spTextSpeeds[v]; ok {
+				v = s
+			}
+			m[key] = v
+		case "partition_map_type":
+			m[key] = spTextPartitionMap(v)
+		case "writable", "removable_media":
+			m[key] = strings.ToLower(v)
+		default:
+			m[key] = v
+		}
+	}
+	for _, c := range n.children {
+		key := ""
+		switch c.name {
+		case "Media":
+			key = "Media"
+		case "Volumes":
+			key = "volumes"
+		}
+		if key == "" {
+			item, err := c.toJSON()
+			if err != nil {
+				return nil, err
+			}
+			items, _ := m["_items"].([]any)
+			m["_items"] = append(items, item)
+			continue
+		}
+		list := make([]any, 0, len(c.children))
+		for _, cc := range c.children {
+			item, err := cc.toJSON()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		m[key] = list
+	}
+	return m, nil
+}
+
+// spTextPartitionMap maps e.g. "GPT (GUID Partition Table)" to the -json
+// "guid_partition_map_type".
+func spTextPartitionMap(v string) string {
+	switch {
+	case strings.HasPrefix(v, "GPT"):
+		return "guid_partition_map_type"
+	case strings.HasPrefix(v, "MBR"):
+		return "master_boot_record_partition_map_type"
+	case strings.HasPrefix(v, "APM"):
+		return "apple_partition_map_type"
+	}
+	return "unknown_partition_map_type"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testVolume is what TestParseSnapshotTestdata checks of a volume.
+type testVolume struct {
+	Name, DevName, FileSystem, UUID, MountPoint string
+	Size, Free                                  int64
+	Mounted, Writable                           bool
+}
+
+func TestParseSnapshotTestdata(t *testing.T) {
+	for _, tt := range []struct {
+		file                string
+		name, manufacturer  string
+		vendorID, productID uint16
+		serial              string
+		locationID          uint32
+		speed               string
+		media               MediaInfo
+		volumes             []testVolume
+	}{
+		{
+			file: "noPartition.json", name: "PenDrive", manufacturer: "Innostor",
+			vendorID: 0x1f75, productID: 0x0917, serial: "000000000000005309",
+			locationID: 0x40120000, speed: "high_speed",
+			media: MediaInfo{DevName: "disk5", PartitionName: "unknown_partition_map_type", Size: 63909113344},
+		},
+		{
+			file: "GPTPartitioned.json", name: "PenDrive", manufacturer: "Innostor",
+			vendorID: 0x1f75, productID: 0x0917, serial: "000000000000004010",
+			locationID: 0x40110000, speed: "high_speed",
+			media: MediaInfo{DevName: "disk5", PartitionName: "guid_partition_map_type", Size: 63909113344},
+			volumes: []testVolume{
+				{Name: "EFI", DevName: "disk5s1", FileSystem: "MS-DOS FAT32", Size: 209715200,
+					UUID: "0E239BC6-F960-3107-89CF-1C97F78BB46B"},
+				{Name: "OEL9", DevName: "disk5s2", FileSystem: "MS-DOS FAT32", Size: 63697846272,
+					UUID: "6ABA678A-0FF6-3876-83B7-FE44B24110EB", Mounted: true, MountPoint: "/Volumes/OEL9",
+					Free: 62491787264, Writable: true},
+			},
+		},
+		{
+			file: "MBRPartitioned.json", name: "Flash Disk", manufacturer: "USB",
+			vendorID: 0x058f, productID: 0x6387, serial: "59402D7A",
+			locationID: 0x40110000, speed: "high_speed",
+			media: MediaInfo{DevName: "disk5", PartitionName: "master_boot_record_partition_map_type", Size: 1930428416},
+			volumes: []testVolume{
+				{Name: "TEST", DevName: "disk5s1", FileSystem: "MS-DOS FAT16", Size: 1929379840,
+					UUID: "182684DE-533E-394C-A563-1D491C94108A", Mounted: true, MountPoint: "/Volumes/TEST", Free: 1926168576, Writable: true},
+			},
+		},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			uis, err := ParseSnapshot(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(uis) != 1 {
+				t.Fatalf("got %d sticks, want 1", len(uis))
+			}
+			ui := uis[0]
+			if ui.Name != tt.name || ui.Manufacturer != tt.manufacturer || ui.SerialNumber != tt.serial {
+				t.Errorf("got name %q, manufacturer %q, serial %q", ui.Name, ui.Manufacturer, ui.SerialNumber)
+			}
+			if ui.VendorID != tt.vendorID || ui.ProductID != tt.productID {
+				t.Errorf("ID is %04x:%04x, want %04x:%04x", ui.VendorID, ui.ProductID, tt.vendorID, tt.productID)
+			}
+			if ui.LocationID != tt.locationID || ui.Speed != tt.speed {
+				t.Errorf("got location ID %#08x, speed %q", ui.LocationID, ui.Speed)
+			}
+			if len(ui.Media) != 1 {
+				t.Fatalf("got %d media, want 1", len(ui.Media))
+			}
+			mi := ui.Media[0]
+			if mi.DevName != tt.media.DevName || mi.PartitionName != tt.media.PartitionName || mi.Size != tt.media.Size {
+				t.Errorf("got media %q with %q of %d bytes", mi.DevName, mi.PartitionName, mi.Size)
+			}
+			if len(mi.Volumes) != len(tt.volumes) {
+				t.Fatalf("got %d volumes, want %d", len(mi.Volumes), len(tt.volumes))
+			}
+			for i, vi := range mi.Volumes {
+				got := testVolume{
+					Name: vi.Name, DevName: vi.DevName, FileSystem: vi.FileSystem, UUID: vi.UUID,
+					MountPoint: vi.MountPoint, Size: vi.Size, Free: vi.Free, Mounted: vi.Mounted, Writable: vi.Writable,
+				}
+				if got != tt.volumes[i] {
+					t.Errorf("volume %d is %+v, want %+v", i+1, got, tt.volumes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetUSBInfoMissingID(t *testing.T) {
+	_, err := GetUSBInfo(map[string]any{"_name": "Stick", "vendor_id": "0x1f75"}, "SPUSBDataType[0]")
+	if err == nil {
+		t.Error("got no error for a device without a product ID")
+	}
+}
+
+func TestSampleSnapshots(t *testing.T) {
+	// the sample provider embeds testdata
+	if len(sampleSnapshots) != 3 {
+		t.Fatalf("got %d samples, want 3", len(sampleSnapshots))
+	}
+	for _, s := range sampleSnapshots {
+		if _, err := ParseSnapshot(s.data); err != nil {
+			t.Errorf("%s: %v", s.label, err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "syscall"
+
+// ST_RDONLY from statvfs(3)
+const stRdOnly = 0x1
+
+func statfsFree(path string) (int64, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), st.Flags&stRdOnly != 0, nil
+}
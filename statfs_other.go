@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func statfsFree(path string) (int64, bool, error) {
+	return 0, false, fmt.Errorf("statfs is not supported on %s", runtime.GOOS)
+}
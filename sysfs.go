@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SysfsBackend discovers USB storage devices on Linux by walking
+// /sys/block and resolving each block device to its USB parent device under
+// /sys/bus/usb/devices.
+type SysfsBackend struct {
+	// Root is prepended to all sysfs paths, so tests can point it at a fake
+	// directory tree. Empty means "/".
+	Root string
+}
+
+func (s SysfsBackend) path(elem ...string) string {
+	root := s.Root
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// Discover returns one USBInfo per USB device that has at least one block
+// device, with its disks as media and their partitions as volumes.
+func (s SysfsBackend) Discover(ctx context.Context) ([]*USBInfo, error) {
+	blockDir := s.path("sys", "block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", blockDir, err)
+	}
+	devicesDir := s.path("sys", "devices")
+	if real, err := filepath.EvalSymlinks(devicesDir); err == nil {
+		devicesDir = real
+	}
+	uis := make([]*USBInfo, 0)
+	byDev := make(map[string]*USBInfo)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		link := filepath.Join(blockDir, e.Name())
+		real, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", link, err)
+		}
+		usbDir := findUSBDeviceDir(real, devicesDir)
+		if usbDir == "" {
+			continue // not behind USB
+		}
+		ui, ok := byDev[usbDir]
+		if !ok {
+			if ui, err = s.readUSBDevice(usbDir); err != nil {
+				return nil, err
+			}
+			byDev[usbDir] = ui
+			uis = append(uis, ui)
+		}
+		mi, err := s.readBlockDevice(real, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		ui.Media = append(ui.Media, mi)
+	}
+	return uis, nil
+}
+
+// findUSBDeviceDir walks up from a block device's sysfs directory to the
+// closest USB device directory, i.e. the one carrying idVendor.
+func findUSBDeviceDir(dir, stop string) string {
+	for dir != stop && len(dir) > len(stop) {
+		if _, err := os.Stat(filepath.Join(dir, "idVendor")); err == nil {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+	return ""
+}
+
+func (s SysfsBackend) readUSBDevice(dir string) (*USBInfo, error) {
+	ui := &USBInfo{
+		SerialNumber: readSysfsString(dir, "serial"),
+		Manufacturer: readSysfsString(dir, "manufacturer"),
+		Name:         readSysfsString(dir, "product"),
+	}
+	for _, f := range []struct {
+		name string
+		val  *uint16
+	}{
+		{"idVendor", &ui.VendorID},
+		{"idProduct", &ui.ProductID},
+	} {
+		str := readSysfsString(dir, f.name)
+		val, err := strconv.ParseUint(str, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s/%s (%s): %w", dir, f.name, str, err)
+		}
+		*f.val = uint16(val)
+	}
+	if ui.Name == "" {
+		ui.Name = filepath.Base(dir)
+	}
+	ui.Speed = sysfsSpeed(readSysfsString(dir, "speed"))
+
+	str := readSysfsString(dir, "busnum")
+	bus, err := strconv.ParseUint(str, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s/busnum (%s): %w", dir, str, err)
+	}
+	// a location ID that does not fit is still unique enough for a key
+	loc, err := linuxLocationID(uint8(bus), readSysfsString(dir, "devpath"))
+	if err != nil {
+		ui.Warnings = append(ui.Warnings, fmt.Sprintf("location ID %#08x is approximate: %v", loc, err))
+	}
+	ui.LocationID = loc
+
+	if raw, err := os.ReadFile(filepath.Join(dir, "descriptors")); err == nil {
+		// a broken descriptors file loses the descriptors, not the device
+		if desc, err := DecodeDescriptors(raw); err != nil {
+			ui.Warnings = append(ui.Warnings, fmt.Sprintf("failed to decode descriptors: %v", err))
+		} else {
+			ui.Descriptors = desc
+			ui.Class = desc.Device.Class
+			ui.SubClass = desc.Device.SubClass
+			ui.Protocol = desc.Device.Protocol
+			if len(desc.Configs) > 0 {
+				ui.Interfaces = desc.Configs[0].Interfaces
+			}
+		}
+	}
+	return ui, nil
+}
+
+func (s SysfsBackend) readBlockDevice(dir, name string) (*MediaInfo, error) {
+	size, err := readSysfsSectors(dir)
+	if err != nil {
+		return nil, err
+	}
+	mi := &MediaInfo{
+		Name:    strings.TrimSpace(readSysfsString(dir, "device/vendor") + " " + readSysfsString(dir, "device/model")),
+		DevName: name,
+		Size:    size,
+	}
+	if mi.Name == "" {
+		mi.Name = name
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, e := range entries {
+		pDir := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(pDir, "partition")); err != nil {
+			continue
+		}
+		size, err := readSysfsSectors(pDir)
+		if err != nil {
+			return nil, err
+		}
+		// no Name: sysfs does not know file system labels, and a default
+		// name would keep udev and the probes from filling in the label
+		vi := &VolumeInfo{
+			DevName: e.Name(),
+			Size:    size,
+			DevNum:  readSysfsString(pDir, "dev"),
+		}
+		// like size, start is in 512-byte sectors
+		if start, err := strconv.ParseInt(readSysfsString(pDir, "start"), 10, 64); err == nil {
+			vi.Offset = start * 512
+		}
+		mi.Volumes = append(mi.Volumes, vi)
+	}
+	sort.SliceStable(mi.Volumes, func(i, j int) bool {
+		return partitionIndex(mi.Volumes[i].DevName) < partitionIndex(mi.Volumes[j].DevName)
+	})
+	return mi, nil
+}
+
+// readSysfsSectors reads the size of a block device, which sysfs always
+// reports in 512-byte sectors regardless of the logical block size.
+func readSysfsSectors(dir string) (int64, error) {
+	str := readSysfsString(dir, "size")
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s/size (%s): %w", dir, str, err)
+	}
+	return val * 512, nil
+}
+
+// readSysfsString returns the trimmed content of a sysfs attribute, or "" if
+// it does not exist (e.g. devices without a serial number).
+func readSysfsString(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// partitionIndex returns the trailing partition number of a device name such
+// as "sdb2" or "mmcblk0p10", so that sdb10 sorts after sdb9.
+func partitionIndex(name string) int {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(name[i:])
+	return n
+}
+
+// sysfsSpeed maps the sysfs speed in Mbit/s to the system_profiler naming.
+func sysfsSpeed(mbps string) string {
+	switch mbps {
+	case "":
+		return ""
+	case "1.5":
+		return "low_speed"
+	case "12":
+		return "full_speed"
+	case "480":
+		return "high_speed"
+	case "5000":
+		return "super_speed"
+	case "10000", "20000":
+		return "super_speed_plus"
+	}
+	return mbps + "_mbps"
+}
+
+// linuxLocationID builds a macOS style location ID from a Linux bus number
+// and port path ("1.4" for port 4 of the hub on root port 1): the bus number
+// in the top byte followed by one nibble per port. Ports above 15 and hubs
+// deeper than six levels do not fit; they are clamped and dropped, and the
+// error says so along with the location ID built from the rest.
+func linuxLocationID(bus uint8, devpath string) (uint32, error) {
+	loc := uint32(bus) << 24
+	if devpath == "" || devpath == "0" {
+		return loc, nil // root hub
+	}
+	var err error
+	ports := strings.Split(devpath, ".")
+	if len(ports) > 6 {
+		ports = ports[:6]
+		err = fmt.Errorf("port path %s is too deep", devpath)
+	}
+	for i, p := range ports {
+		port, perr := strconv.ParseUint(p, 10, 8)
+		switch {
+		case perr != nil:
+			return loc, fmt.Errorf("invalid port %q in %s: %w", p, devpath, perr)
+		case port > 15 && err == nil:
+			err = fmt.Errorf("port %d in %s does not fit in a nibble", port, devpath)
+			fallthrough
+		case port > 15:
+			port = 15
+		}
+		loc |= uint32(port) << (20 - 4*i)
+	}
+	return loc, err
+}
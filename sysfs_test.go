@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSysfsTree creates files below root from a map of slash separated
+// paths to contents; contents starting with "->" make symbolic links.
+func writeSysfsTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if strings.HasPrefix(content, "->") {
+			err = os.Symlink(filepath.FromSlash(content[2:]), p)
+		} else {
+			err = os.WriteFile(p, []byte(content+"\n"), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func fakeSysfs(t *testing.T, devpath string) string {
+	root := t.TempDir()
+	usb := "sys/devices/pci0000:00/0000:00:14.0/usb2/2-" + devpath
+	disk := usb + "/2-" + devpath + ":1.0/host6/target6:0:0/6:0:0:0/block/sdb"
+	writeSysfsTree(t, root, map[string]string{
+		usb + "/idVendor":     "0781",
+		usb + "/idProduct":    "5581",
+		usb + "/serial":       "4C530001230512105341",
+		usb + "/manufacturer": "SanDisk",
+		usb + "/product":      "Ultra",
+		usb + "/speed":        "5000",
+		usb + "/busnum":       "2",
+		usb + "/devpath":      devpath,
+
+		disk + "/size":          "60063744",
+		disk + "/device/vendor": "SanDisk ",
+		disk + "/device/model":  "Ultra           ",
+		// listed out of order, sdb10 sorts last
+		disk + "/sdb10/partition": "10",
+		disk + "/sdb10/size":      "2048",
+		disk + "/sdb10/start":     "4096",
+		disk + "/sdb10/dev":       "8:26",
+		disk + "/sdb2/partition":  "2",
+		disk + "/sdb2/size":       "2048",
+		disk + "/sdb2/start":      "2048",
+		disk + "/sdb2/dev":        "8:18",
+
+		// a SATA disk, which is not behind USB
+		"sys/devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda/size": "1000215216",
+
+		"sys/block/sdb": "->../devices/pci0000:00/0000:00:14.0/usb2/2-" + devpath + "/2-" + devpath + ":1.0/host6/target6:0:0/6:0:0:0/block/sdb",
+		"sys/block/sda": "->../devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda",
+	})
+	return root
+}
+
+func TestSysfsDiscover(t *testing.T) {
+	uis, err := SysfsBackend{Root: fakeSysfs(t, "1.4")}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uis) != 1 {
+		t.Fatalf("got %d devices, want 1", len(uis))
+	}
+	ui := uis[0]
+	if ui.VendorID != 0x0781 || ui.ProductID != 0x5581 {
+		t.Errorf("ID is %04x:%04x, want 0781:5581", ui.VendorID, ui.ProductID)
+	}
+	if ui.Name != "Ultra" || ui.Manufacturer != "SanDisk" || ui.SerialNumber != "4C530001230512105341" {
+		t.Errorf("got name %q, manufacturer %q, serial %q", ui.Name, ui.Manufacturer, ui.SerialNumber)
+	}
+	if ui.Speed != "super_speed" {
+		t.Errorf("speed is %q, want super_speed", ui.Speed)
+	}
+	if ui.LocationID != 0x02140000 {
+		t.Errorf("location ID is %#08x, want 0x02140000", ui.LocationID)
+	}
+	if len(ui.Warnings) != 0 {
+		t.Errorf("unexpected warnings %q", ui.Warnings)
+	}
+	if len(ui.Media) != 1 {
+		t.Fatalf("got %d media, want 1", len(ui.Media))
+	}
+	mi := ui.Media[0]
+	if mi.DevName != "sdb" || mi.Name != "SanDisk Ultra" || mi.Size != 60063744*512 {
+		t.Errorf("got media %q %q of %d bytes", mi.DevName, mi.Name, mi.Size)
+	}
+	var got []string
+	for _, vi := range mi.Volumes {
+		got = append(got, vi.DevName)
+	}
+	if strings.Join(got, " ") != "sdb2 sdb10" {
+		t.Fatalf("volumes are %q, want sdb2 and sdb10", got)
+	}
+	vi := mi.Volumes[0]
+	if vi.Size != 2048*512 || vi.Offset != 2048*512 || vi.DevNum != "8:18" {
+		t.Errorf("sdb2 has size %d, offset %d, device number %q", vi.Size, vi.Offset, vi.DevNum)
+	}
+	if vi.Name != "" {
+		t.Errorf("sdb2 is named %q, want no name before a label is known", vi.Name)
+	}
+}
+
+func TestSysfsDiscoverHighPort(t *testing.T) {
+	// ports above 15 do not fit in a location ID, but must not lose the device
+	uis, err := SysfsBackend{Root: fakeSysfs(t, "1.17")}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uis) != 1 {
+		t.Fatalf("got %d devices, want 1", len(uis))
+	}
+	if uis[0].LocationID != 0x021f0000 {
+		t.Errorf("location ID is %#08x, want 0x021f0000", uis[0].LocationID)
+	}
+	if len(uis[0].Warnings) != 1 {
+		t.Errorf("warnings are %q, want one about the location ID", uis[0].Warnings)
+	}
+}
+
+func TestLinuxLocationID(t *testing.T) {
+	for _, tt := range []struct {
+		bus     uint8
+		devpath string
+		want    uint32
+		wantErr bool
+	}{
+		{1, "", 0x01000000, false},
+		{1, "0", 0x01000000, false},
+		{2, "3", 0x02300000, false},
+		{2, "1.4", 0x02140000, false},
+		{3, "1.2.3.4.5.6", 0x03123456, false},
+		{3, "1.2.3.4.5.6.7", 0x03123456, true},
+		{2, "16", 0x02f00000, true},
+		{2, "1.x", 0x02100000, true},
+	} {
+		got, err := linuxLocationID(tt.bus, tt.devpath)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("linuxLocationID(%d, %q) = %#08x, %v; want %#08x, error %t",
+				tt.bus, tt.devpath, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSysfsDiscoverBadDescriptors(t *testing.T) {
+	// a truncated descriptors file must not lose the device
+	root := fakeSysfs(t, "1.4")
+	writeSysfsTree(t, root, map[string]string{
+		"sys/devices/pci0000:00/0000:00:14.0/usb2/2-1.4/descriptors": "\x12\x01\x00\x02",
+	})
+	uis, err := SysfsBackend{Root: root}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uis) != 1 {
+		t.Fatalf("got %d devices, want 1", len(uis))
+	}
+	if uis[0].Descriptors != nil || len(uis[0].Warnings) != 1 || !strings.Contains(uis[0].Warnings[0], "descriptors") {
+		t.Errorf("got descriptors %v and warnings %q", uis[0].Descriptors, uis[0].Warnings)
+	}
+}
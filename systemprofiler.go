@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DefaultSystemProfilerTimeout bounds a system_profiler run, which takes a
+// few seconds on a machine with many USB devices.
+const DefaultSystemProfilerTimeout = 30 * time.Second
+
+// SystemProfilerBackend discovers USB storage devices on macOS from
+// `system_profiler -json SPUSBDataType`.
+type SystemProfilerBackend struct {
+	Runner  CommandRunner // nil means ExecRunner
+	Timeout time.Duration // 0 means DefaultSystemProfilerTimeout
+}
+
+// Discover runs system_profiler and returns the USB storage devices found.
+// Failures are *CommandErrors: ErrToolMissing when not on macOS,
+// ErrNonZeroExit with stderr, or ErrBadOutput when the JSON does not parse.
+func (s SystemProfilerBackend) Discover(ctx context.Context) ([]*USBInfo, error) {
+	jd, err := s.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uis, err := FindUSBStickInfo(jd)
+	if err != nil {
+		return nil, &CommandError{Name: "system_profiler", Args: systemProfilerArgs, Err: ErrBadOutput, Cause: err}
+	}
+	return uis, nil
+}
+
+// Topology runs system_profiler and returns all USB buses and devices.
+func (s SystemProfilerBackend) Topology(ctx context.Context) ([]*USBBus, error) {
+	jd, err := s.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buses, err := FindUSBTopology(jd)
+	if err != nil {
+		return nil, &CommandError{Name: "system_profiler", Args: systemProfilerArgs, Err: ErrBadOutput, Cause: err}
+	}
+	return buses, nil
+}
+
+var systemProfilerArgs = []string{"-json", "SPUSBDataType"}
+
+func (s SystemProfilerBackend) run(ctx context.Context) (any, error) {
+	runner := s.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultSystemProfilerTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := runner.Run(ctx, "system_profiler", systemProfilerArgs...)
+	if err != nil {
+		return nil, err
+	}
+	var jd any
+	if err := json.Unmarshal(out, &jd); err != nil {
+		return nil, &CommandError{Name: "system_profiler", Args: systemProfilerArgs, Err: ErrBadOutput, Cause: err}
+	}
+	return jd, nil
+}
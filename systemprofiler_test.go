@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSystemProfilerBackend(t *testing.T) {
+	sample, err := os.ReadFile("testdata/GPTPartitioned.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotArgs []string
+	runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		gotArgs = append([]string{name}, args...)
+		return sample, nil
+	})
+	uis, err := SystemProfilerBackend{Runner: runner}.Discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"system_profiler", "-json", "SPUSBDataType"}; !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("ran %q, want %q", gotArgs, want)
+	}
+	if len(uis) != 1 || uis[0].SerialNumber != "000000000000004010" {
+		t.Errorf("got %d devices", len(uis))
+	}
+	buses, err := SystemProfilerBackend{Runner: runner}.Topology(context.Background())
+	if err != nil || len(buses) == 0 {
+		t.Errorf("got %d buses, error %v", len(buses), err)
+	}
+}
+
+func TestSystemProfilerBackendErrors(t *testing.T) {
+	kinds := []error{ErrToolMissing, ErrNonZeroExit, ErrBadOutput}
+	for _, tt := range []struct {
+		name string
+		out  []byte
+		err  error
+		want error
+	}{
+		{"tool missing", nil, &CommandError{Name: "system_profiler", Err: ErrToolMissing, Cause: os.ErrNotExist}, ErrToolMissing},
+		{"non-zero exit", nil, &CommandError{Name: "system_profiler", Err: ErrNonZeroExit, ExitCode: 1}, ErrNonZeroExit},
+		{"bad JSON", []byte(`{"SPUSBDataType": [`), nil, ErrBadOutput},
+		{"unexpected JSON", []byte(`{"SPUSBDataType": 42}`), nil, ErrBadOutput},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+				return tt.out, tt.err
+			})
+			_, err := SystemProfilerBackend{Runner: runner}.Discover(context.Background())
+			var cerr *CommandError
+			if !errors.As(err, &cerr) || cerr.Name != "system_profiler" {
+				t.Fatalf("got %v, want a system_profiler CommandError", err)
+			}
+			for _, kind := range kinds {
+				if got := errors.Is(err, kind); got != (kind == tt.want) {
+					t.Errorf("errors.Is(%v, %v) = %t", err, kind, got)
+				}
+			}
+		})
+	}
+}
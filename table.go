@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// listColumn is a column of the list table.
+type listColumn struct {
+	name   string
+	header string
+	value  func(ui *USBInfo) string // as displayed; "" shows as "-"
+	// numeric columns only: the sort key, and what CSV and TSV get instead
+	// of the humanized value
+	number func(ui *USBInfo) int64
+}
+
+var listColumns = []*listColumn{
+	{name: "disk", header: "DISK", value: func(ui *USBInfo) string {
+		return joinMedia(ui, func(mi *MediaInfo) string { return mi.DevName })
+	}},
+	{name: "id", header: "ID", value: func(ui *USBInfo) string {
+		return fmt.Sprintf("%04x:%04x", ui.VendorID, ui.ProductID)
+	}},
+	{name: "vendor", header: "VENDOR", value: func(ui *USBInfo) string {
+		return fmt.Sprintf("%04x", ui.VendorID)
+	}},
+	{name: "product", header: "PRODUCT", value: func(ui *USBInfo) string {
+		return fmt.Sprintf("%04x", ui.ProductID)
+	}},
+	{name: "manufacturer", header: "MANUFACTURER", value: func(ui *USBInfo) string { return ui.Manufacturer }},
+	{name: "serial", header: "SERIAL", value: func(ui *USBInfo) string { return ui.SerialNumber }},
+	{name: "size", header: "SIZE", number: mediaSize, value: func(ui *USBInfo) string {
+		return humanSize(mediaSize(ui))
+	}},
+	{name: "name", header: "NAME", value: func(ui *USBInfo) string { return ui.Name }},
+	{name: "volumes", header: "VOLUMES", value: func(ui *USBInfo) string {
+		return joinVolumes(ui, func(vi *VolumeInfo) string {
+			v := vi.Name
+			if v == "" {
+				v = vi.DevName
+			}
+			if vi.Mounted {
+				v += "@" + vi.MountPoint
+			}
+			return v
+		})
+	}},
+	{name: "mounts", header: "MOUNT POINTS", value: func(ui *USBInfo) string {
+		return joinVolumes(ui, func(vi *VolumeInfo) string {
+			if !vi.Mounted {
+				return ""
+			}
+			return vi.MountPoint
+		})
+	}},
+	{name: "free", header: "FREE", number: freeSpace, value: func(ui *USBInfo) string {
+		if !anyMounted(ui) {
+			return ""
+		}
+		return humanSize(freeSpace(ui))
+	}},
+	{name: "speed", header: "SPEED", value: func(ui *USBInfo) string { return ui.Speed }},
+	{name: "location", header: "LOCATION", value: func(ui *USBInfo) string {
+		if ui.LocationID == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%#08x", ui.LocationID)
+	}},
+	{name: "source", header: "SOURCE", value: func(ui *USBInfo) string { return ui.Source }},
+}
+
+// defaultListColumns are the columns of list without -columns.
+const defaultListColumns = "disk,id,serial,size,name,volumes,source"
+
+func listColumnNames() []string {
+	names := make([]string, 0, len(listColumns))
+	for _, col := range listColumns {
+		names = append(names, col.name)
+	}
+	return names
+}
+
+func findListColumn(name string) (*listColumn, error) {
+	for _, col := range listColumns {
+		if col.name == name {
+			return col, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown column %q, known are: %s", name, strings.Join(listColumnNames(), ", "))
+}
+
+// parseListColumns parses a comma separated list of column names.
+func parseListColumns(s string) ([]*listColumn, error) {
+	cols := make([]*listColumn, 0)
+	for _, name := range strings.Split(s, ",") {
+		col, err := findListColumn(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+func joinMedia(ui *USBInfo, f func(mi *MediaInfo) string) string {
+	vs := make([]string, 0, len(ui.Media))
+	for _, mi := range ui.Media {
+		if v := f(mi); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	return strings.Join(vs, ",")
+}
+
+func joinVolumes(ui *USBInfo, f func(vi *VolumeInfo) string) string {
+	return joinMedia(ui, func(mi *MediaInfo) string {
+		vs := make([]string, 0, len(mi.Volumes))
+		for _, vi := range mi.Volumes {
+			if v := f(vi); v != "" {
+				vs = append(vs, v)
+			}
+		}
+		return strings.Join(vs, ",")
+	})
+}
+
+func mediaSize(ui *USBInfo) int64 {
+	var n int64
+	for _, mi := range ui.Media {
+		n += mi.Size
+	}
+	return n
+}
+
+func freeSpace(ui *USBInfo) int64 {
+	var n int64
+	for _, mi := range ui.Media {
+		for _, vi := range mi.Volumes {
+			if vi.Mounted {
+				n += vi.Free
+			}
+		}
+	}
+	return n
+}
+
+func anyMounted(ui *USBInfo) bool {
+	for _, mi := range ui.Media {
+		for _, vi := range mi.Volumes {
+			if vi.Mounted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listSortKey is a column to sort by.
+type listSortKey struct {
+	col  *listColumn
+	desc bool
+}
+
+// parseListSortKeys parses a comma separated list of column names, each
+// descending if prefixed with "-".
+func parseListSortKeys(s string) ([]listSortKey, error) {
+	keys := make([]listSortKey, 0)
+	for _, k := range strings.Split(s, ",") {
+		k = strings.TrimSpace(k)
+		col, err := findListColumn(strings.TrimPrefix(k, "-"))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, listSortKey{col: col, desc: strings.HasPrefix(k, "-")})
+	}
+	return keys, nil
+}
+
+// sortUSBInfos sorts stably by the keys: numeric columns by number, the
+// others by their displayed value.
+func sortUSBInfos(uis []*USBInfo, keys []listSortKey) {
+	sort.SliceStable(uis, func(i, j int) bool {
+		for _, k := range keys {
+			var c int
+			if k.col.number != nil {
+				a, b := k.col.number(uis[i]), k.col.number(uis[j])
+				switch {
+				case a < b:
+					c = -1
+				case a > b:
+					c = 1
+				}
+			} else {
+				c = strings.Compare(k.col.value(uis[i]), k.col.value(uis[j]))
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// writeTable writes an aligned table. If width is positive, the widest
+// columns are truncated, with an ellipsis, until the table fits.
+func writeTable(w io.Writer, cols []*listColumn, uis []*USBInfo, width int) error {
+	const gap = 2
+	rows := make([][]string, 0, len(uis)+1)
+	header := make([]string, 0, len(cols))
+	for _, col := range cols {
+		header = append(header, col.header)
+	}
+	rows = append(rows, header)
+	for _, ui := range uis {
+		row := make([]string, 0, len(cols))
+		for _, col := range cols {
+			row = append(row, orDash(col.value(ui)))
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(cols))
+	total := gap * (len(cols) - 1)
+	for i := range cols {
+		for _, row := range rows {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		total += widths[i]
+	}
+	// shrink the widest column that can give, never numbers nor below its
+	// header or a few characters
+	for width > 0 && total > width {
+		widest := -1
+		for i, col := range cols {
+			lo := utf8.RuneCountInString(header[i])
+			if lo < 8 {
+				lo = 8
+			}
+			if col.number == nil && widths[i] > lo && (widest < 0 || widths[i] > widths[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+		widths[widest]--
+		total--
+	}
+
+	var buf strings.Builder
+	for _, row := range rows {
+		buf.Reset()
+		for i, cell := range row {
+			cell = truncate(cell, widths[i])
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			switch {
+			case cols[i].number != nil:
+				buf.WriteString(pad + cell)
+			case i < len(row)-1:
+				buf.WriteString(cell + pad)
+			default:
+				buf.WriteString(cell) // no trailing blanks
+			}
+			if i < len(row)-1 {
+				buf.WriteString(strings.Repeat(" ", gap))
+			}
+		}
+		buf.WriteString("\n")
+		if _, err := io.WriteString(w, buf.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to n runes, ending it with an ellipsis if cut.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// writeDelimited writes the columns as CSV, or TSV with a tab as comma,
+// quoted as spreadsheets expect. Numeric columns are written as numbers.
+func writeDelimited(w io.Writer, cols []*listColumn, uis []*USBInfo, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	rec := make([]string, len(cols))
+	for i, col := range cols {
+		rec[i] = col.name
+	}
+	if err := cw.Write(rec); err != nil {
+		return err
+	}
+	for _, ui := range uis {
+		for i, col := range cols {
+			rec[i] = col.value(ui)
+			if col.number != nil && rec[i] != "" {
+				rec[i] = strconv.FormatInt(col.number(ui), 10)
+			}
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
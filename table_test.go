@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testTableSticks() []*USBInfo {
+	return []*USBInfo{
+		{Name: "Ultra", VendorID: 0x0781, ProductID: 0x5581, SerialNumber: "4C530001230512105341",
+			Media: []*MediaInfo{{DevName: "sdb", Size: 30752636928, Volumes: []*VolumeInfo{
+				{DevName: "sdb1", Name: "EFI", Mounted: true, MountPoint: "/media/EFI", Free: 200000000},
+				{DevName: "sdb2", Name: "DATA"},
+			}}}},
+		{Name: `Stick, "the big one"`, VendorID: 0x1f75, ProductID: 0x0917, SerialNumber: "line\nbreak",
+			Media: []*MediaInfo{{DevName: "sdc", Size: 128035676160}}},
+		{Name: "DataTraveler", VendorID: 0x0951, ProductID: 0x1666,
+			Media: []*MediaInfo{{DevName: "sdd", Size: 7756087296}}},
+	}
+}
+
+func TestSortUSBInfos(t *testing.T) {
+	for _, tt := range []struct {
+		keys string
+		want string // disks in order
+	}{
+		{"size", "sdd sdb sdc"},
+		{"-size", "sdc sdb sdd"},
+		{"vendor", "sdb sdd sdc"},
+		{"free,-disk", "sdd sdc sdb"},
+		{"serial,name", "sdd sdb sdc"}, // no serial sorts first
+	} {
+		keys, err := parseListSortKeys(tt.keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uis := testTableSticks()
+		sortUSBInfos(uis, keys)
+		var got []string
+		for _, ui := range uis {
+			got = append(got, ui.Media[0].DevName)
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("sorted by %s: got %q, want %s", tt.keys, got, tt.want)
+		}
+	}
+	if _, err := parseListSortKeys("size,colour"); err == nil {
+		t.Error("got no error for an unknown sort key")
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	cols, err := parseListColumns("disk,id,size,name,volumes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, cols, testTableSticks(), 0); err != nil {
+		t.Fatal(err)
+	}
+	want := `DISK  ID             SIZE  NAME                  VOLUMES
+sdb   0781:5581   30.8 GB  Ultra                 EFI@/media/EFI,DATA
+sdc   1f75:0917  128.0 GB  Stick, "the big one"  -
+sdd   0951:1666    7.8 GB  DataTraveler          -
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteTableTruncated(t *testing.T) {
+	cols, err := parseListColumns("disk,size,name,volumes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, cols, testTableSticks(), 40); err != nil {
+		t.Fatal(err)
+	}
+	// the widest text columns give, down to their header or 8 characters;
+	// sizes are never cut
+	want := `DISK      SIZE  NAME         VOLUMES
+sdb    30.8 GB  Ultra        EFI@/media…
+sdc   128.0 GB  Stick, "th…  -
+sdd     7.8 GB  DataTravel…  -
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if n := len([]rune(line)); n > 40 {
+			t.Errorf("%q is %d characters wide", line, n)
+		}
+	}
+}
+
+func TestWriteDelimited(t *testing.T) {
+	cols, err := parseListColumns("disk,serial,size,name,free")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		comma rune
+		want  string
+	}{
+		{',', `disk,serial,size,name,free
+sdb,4C530001230512105341,30752636928,Ultra,200000000
+sdc,"line
+break",128035676160,"Stick, ""the big one""",
+sdd,,7756087296,DataTraveler,
+`},
+		{'\t', `disk	serial	size	name	free
+sdb	4C530001230512105341	30752636928	Ultra	200000000
+sdc	"line
+break"	128035676160	"Stick, ""the big one"""	
+sdd		7756087296	DataTraveler	
+`},
+	} {
+		var buf bytes.Buffer
+		if err := writeDelimited(&buf, cols, testTableSticks(), tt.comma); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("with %q as comma got\n%s\nwant\n%s", tt.comma, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helpers available to -template, in addition to
+// text/template's builtins.
+var templateFuncs = template.FuncMap{
+	// humanize formats a byte count in decimal units, like the Finder
+	"humanize": humanSize,
+	// hex formats an ID with the digits its type has, e.g. 0x1f75 for a vendor ID
+	"hex": func(v any) (string, error) {
+		switch v := v.(type) {
+		case uint8:
+			return fmt.Sprintf("0x%02x", v), nil
+		case uint16:
+			return fmt.Sprintf("0x%04x", v), nil
+		case uint32:
+			return fmt.Sprintf("0x%08x", v), nil
+		case uint64, int, int64:
+			return fmt.Sprintf("%#x", v), nil
+		}
+		return "", fmt.Errorf("hex: not an integer: %T", v)
+	},
+	// id formats a stick's vendor and product ID as 1f75:0917
+	"id": func(ui *USBInfo) string {
+		return fmt.Sprintf("%04x:%04x", ui.VendorID, ui.ProductID)
+	},
+	"join": func(ss []string, sep string) string {
+		return strings.Join(ss, sep)
+	},
+	// volumes lists the volumes of all media of a stick
+	"volumes": func(ui *USBInfo) []*VolumeInfo {
+		vis := make([]*VolumeInfo, 0)
+		for _, mi := range ui.Media {
+			vis = append(vis, mi.Volumes...)
+		}
+		return vis
+	},
+	// volumeNames joins the names of the volumes of a stick with commas
+	"volumeNames": func(ui *USBInfo) string {
+		return joinVolumes(ui, func(vi *VolumeInfo) string { return vi.Name })
+	},
+	// mountPoints joins the mount points of a stick with commas
+	"mountPoints": func(ui *USBInfo) string {
+		return joinVolumes(ui, func(vi *VolumeInfo) string {
+			if !vi.Mounted {
+				return ""
+			}
+			return vi.MountPoint
+		})
+	},
+	// firstMounted returns the first mounted volume of a stick, or nil
+	"firstMounted": func(ui *USBInfo) *VolumeInfo {
+		for _, mi := range ui.Media {
+			for _, vi := range mi.Volumes {
+				if vi.Mounted {
+					return vi
+				}
+			}
+		}
+		return nil
+	},
+	// size is the size of all media of a stick, free the free space of its
+	// mounted volumes
+	"size": mediaSize,
+	"free": freeSpace,
+}
+
+// parseTemplate parses a -template, named after where it came from for
+// error messages.
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	ui := &USBInfo{Name: "Ultra", VendorID: 0x0781, ProductID: 0x5581, LocationID: 0x02140000,
+		Warnings: []string{"one", "two"},
+		Media: []*MediaInfo{{DevName: "sdb", Size: 30752636928, Volumes: []*VolumeInfo{
+			{DevName: "sdb1", Name: "EFI"},
+			{DevName: "sdb2", Name: "DATA", Mounted: true, MountPoint: "/media/DATA", Free: 1500000000},
+		}}}}
+	for _, tt := range []struct{ text, want string }{
+		{`{{id .}}`, "0781:5581"},
+		{`{{hex .VendorID}} {{hex .LocationID}}`, "0x0781 0x02140000"},
+		{`{{with index .Media 0}}{{hex .Size}}{{end}}`, "0x729000000"},
+		{`{{humanize (size .)}}, {{humanize (free .)}}`, "30.8 GB, 1.5 GB"},
+		{`{{join .Warnings "; "}}`, "one; two"},
+		{`{{volumeNames .}}`, "EFI,DATA"},
+		{`{{mountPoints .}}`, "/media/DATA"},
+		{`{{range volumes .}}{{.DevName}} {{end}}`, "sdb1 sdb2 "},
+		{`{{with firstMounted .}}{{.DevName}}{{end}}`, "sdb2"},
+	} {
+		tmpl, err := parseTemplate("test", tt.text)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.text, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, ui); err != nil || buf.String() != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.text, buf.String(), err, tt.want)
+		}
+	}
+
+	tmpl, err := parseTemplate("test", `{{hex .Name}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, ui); err == nil || !strings.Contains(err.Error(), "not an integer") {
+		t.Errorf("got %v for hex of a string", err)
+	}
+}
+
+func TestTemplateCLI(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		code int
+		want string // in stdout, or in stderr for a failure
+	}{
+		{[]string{"-s", "sample", "-template", "{{range .}}{{id .}} {{volumeNames .}}\n{{end}}", "list"}, ExitOK,
+			"1f75:0917 EFI,OEL9\n058f:6387 TEST\n"},
+		{[]string{"-s", "sample", "-template", "{{range .}}{{.Name}", "list"}, ExitUsage, "template:1:"},
+		{[]string{"-s", "sample", "-template", "{{nosuch .}}", "list"}, ExitUsage, `function "nosuch" not defined`},
+		{[]string{"-s", "sample", "-template", "{{.}}", "-o", "json", "list"}, ExitUsage, "exclusive"},
+		{[]string{"-s", "sample", "-o", "template", "list"}, ExitUsage, "needs -template"},
+		{[]string{"-s", "sample", "-template", "{{range .}}{{hex .Name}}{{end}}", "list"}, ExitError, "not an integer"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(tt.args, nil, &stdout, &stderr)
+		out := stdout.String()
+		if code != ExitOK {
+			out = stderr.String()
+		}
+		if code != tt.code || !strings.Contains(out, tt.want) {
+			t.Errorf("%q exited with %d, output %q; want %d and %q", tt.args, code, out, tt.code, tt.want)
+		}
+	}
+}
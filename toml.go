@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// EncodeTOML writes v, anything encoding/json marshals to an object, as a
+// TOML document. Objects of scalars become inline tables, arrays of
+// larger objects arrays of tables. TOML has no null, so null values are
+// left out.
+func EncodeTOML(w io.Writer, v any) error {
+	tree, err := orderedTree(v)
+	if err != nil {
+		return err
+	}
+	m, ok := tree.(orderedMap)
+	if !ok {
+		return fmt.Errorf("toml: the document must be an object, not %T", tree)
+	}
+	var buf bytes.Buffer
+	if err := writeTOMLTable(&buf, m, ""); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// writeTOMLTable writes the key/value pairs of a table, then its sub-tables
+// under headers with the dotted path.
+func writeTOMLTable(buf *bytes.Buffer, m orderedMap, path string) error {
+	for _, f := range m {
+		if f.value != nil && tomlInline(f.value) {
+			v, err := tomlValue(f.value)
+			if err != nil {
+				return fmt.Errorf("toml: %s: %w", tomlPath(path, f.key), err)
+			}
+			fmt.Fprintf(buf, "%s = %s\n", tomlKey(f.key), v)
+		}
+	}
+	for _, f := range m {
+		if f.value == nil || tomlInline(f.value) {
+			continue
+		}
+		p := tomlPath(path, f.key)
+		switch v := f.value.(type) {
+		case orderedMap:
+			fmt.Fprintf(buf, "\n[%s]\n", p)
+			if err := writeTOMLTable(buf, v, p); err != nil {
+				return err
+			}
+		case []any:
+			for i, e := range v {
+				t, ok := e.(orderedMap)
+				if !ok {
+					return fmt.Errorf("toml: %s[%d]: %T in an array of tables", p, i, e)
+				}
+				fmt.Fprintf(buf, "\n[[%s]]\n", p)
+				if err := writeTOMLTable(buf, t, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tomlPath is the dotted path of a key below a table.
+func tomlPath(path, key string) string {
+	if path == "" {
+		return tomlKey(key)
+	}
+	return path + "." + tomlKey(key)
+}
+
+// tomlInline tells whether a value is written on its key's line: scalars,
+// objects of scalars, and arrays of those. Other arrays hold objects only,
+// as a Document has no arrays of arrays.
+func tomlInline(v any) bool {
+	switch v := v.(type) {
+	case orderedMap:
+		for _, f := range v {
+			switch f.value.(type) {
+			case orderedMap, []any:
+				return false
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if !tomlInline(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func tomlValue(v any) (string, error) {
+	switch v := v.(type) {
+	case bool:
+		return fmt.Sprint(v), nil
+	case json.Number:
+		return v.String(), nil
+	case string:
+		return tomlString(v), nil
+	case orderedMap:
+		parts := make([]string, 0, len(v))
+		for _, f := range v {
+			if f.value == nil {
+				continue
+			}
+			s, err := tomlValue(f.value)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, tomlKey(f.key)+" = "+s)
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			s, err := tomlValue(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case nil:
+		return "", fmt.Errorf("null in an array, which TOML cannot express")
+	}
+	return "", fmt.Errorf("unexpected %T", v)
+}
+
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKey.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString writes a basic string, escaping what TOML requires and using
+// only the escapes it knows.
+func tomlString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
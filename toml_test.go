@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeTOML(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+		Tags []int  `json:"tags"`
+	}
+	v := struct {
+		Title  string         `json:"title"`
+		Nil    *int           `json:"nil"`
+		Weird  string         `json:"weird key"`
+		Inline map[string]int `json:"inline"`
+		Items  []item         `json:"items"`
+		Table  struct {
+			Sub struct {
+				OK bool `json:"ok"`
+			} `json:"sub"`
+		} `json:"table"`
+	}{
+		Title:  "a \"quoted\"\tline\n\x01",
+		Weird:  "x",
+		Inline: map[string]int{"b": 2, "a": 1},
+		Items:  []item{{"one", []int{1, 2}}, {"two", nil}},
+	}
+	var buf bytes.Buffer
+	if err := EncodeTOML(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	want := `title = "a \"quoted\"\tline\n\u0001"
+"weird key" = "x"
+inline = { a = 1, b = 2 }
+
+[[items]]
+name = "one"
+tags = [1, 2]
+
+[[items]]
+name = "two"
+
+[table]
+sub = { ok = false }
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestEncodeTOMLErrors(t *testing.T) {
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{[]int{1}, "must be an object"},
+		{map[string]any{"a": []any{1, nil}}, "toml: a: null in an array"},
+		{map[string]any{"a": []any{map[string]any{"b": []int{1}}, 2}}, "toml: a[1]: json.Number in an array of tables"},
+	} {
+		err := EncodeTOML(&bytes.Buffer{}, tt.v)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("EncodeTOML(%v) = %v, want %q", tt.v, err, tt.want)
+		}
+	}
+}
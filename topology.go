@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// USBBus is a USB host controller (root hub) and the devices behind it.
+type USBBus struct {
+	Name           string
+	Number         int    // Linux bus number, 0 on macOS
+	HostController string // macOS host controller, Linux driver
+	Speed          string
+	Devices        []*USBDevice
+	Source         string // snapshot the bus was read from, if not the live system
+}
+
+func (b USBBus) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sUSB Bus %q:\n", prefix, b.Name)
+	if b.Source != "" {
+		fmt.Fprintf(&buf, "%s  Source: %s\n", prefix, b.Source)
+	}
+	if b.HostController != "" {
+		fmt.Fprintf(&buf, "%s  Host Controller: %s\n", prefix, b.HostController)
+	}
+	if b.Speed != "" {
+		fmt.Fprintf(&buf, "%s  Speed: %s\n", prefix, b.Speed)
+	}
+	for _, d := range b.Devices {
+		fmt.Fprintf(&buf, "%s", d.ToString(prefix+indent+indent))
+	}
+	return buf.String()
+}
+
+func (b USBBus) String() string {
+	return b.ToString("")
+}
+
+// USBDevice is a node of the USB topology: any device, including hubs.
+type USBDevice struct {
+	Name          string
+	Manufacturer  string
+	SerialNumber  string
+	VendorID      uint16
+	ProductID     uint16
+	LocationID    uint32
+	Address       int
+	Port          int
+	Speed         string
+	USBVersion    string // bcdUSB, e.g. "2.10"
+	DeviceVersion string // bcdDevice, e.g. "0.01"
+	BusPower      int    // mA available
+	BusPowerUsed  int    // mA used
+	Class         uint8
+	SubClass      uint8
+	Protocol      uint8
+	Configs       []*ConfigInfo
+	Interfaces    []*InterfaceInfo // when no configuration details are known
+	Devices       []*USBDevice     // downstream devices of a hub
+	Storage       *USBInfo         // non-nil for storage devices
+	Warnings      []string         // recoverable inconsistencies, e.g. an approximate location ID
+}
+
+// IsHub tells whether the device has downstream ports.
+func (d USBDevice) IsHub() bool {
+	return d.Class == 0x09 || len(d.Devices) > 0 || d.Name == "hub_device"
+}
+
+// AllInterfaces returns the interfaces of all configurations, or the bare
+// interface list if there are no configurations.
+func (d USBDevice) AllInterfaces() []*InterfaceInfo {
+	if len(d.Configs) == 0 {
+		return d.Interfaces
+	}
+	ifs := make([]*InterfaceInfo, 0)
+	for _, c := range d.Configs {
+		ifs = append(ifs, c.Interfaces...)
+	}
+	return ifs
+}
+
+func (d USBDevice) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sUSB Device %q:\n", prefix, d.Name)
+	fmt.Fprintf(&buf, "%s  Product ID: %#04x\n", prefix, d.ProductID)
+	fmt.Fprintf(&buf, "%s  Vendor ID: %#04x\n", prefix, d.VendorID)
+	if d.SerialNumber != "" {
+		fmt.Fprintf(&buf, "%s  Serial Number: %s\n", prefix, d.SerialNumber)
+	}
+	if d.Manufacturer != "" {
+		fmt.Fprintf(&buf, "%s  Manufacturer: %s\n", prefix, d.Manufacturer)
+	}
+	fmt.Fprintf(&buf, "%s  Location ID: %#08x / %d\n", prefix, d.LocationID, d.Address)
+	fmt.Fprintf(&buf, "%s  Port: %d\n", prefix, d.Port)
+	if d.Speed != "" {
+		fmt.Fprintf(&buf, "%s  Speed: %s\n", prefix, d.Speed)
+	}
+	if d.BusPower != 0 {
+		fmt.Fprintf(&buf, "%s  Bus Power: %d mA (%d mA used)\n", prefix, d.BusPower, d.BusPowerUsed)
+	}
+	for _, c := range d.Configs {
+		fmt.Fprintf(&buf, "%s", c.ToString(prefix+indent))
+	}
+	if len(d.Configs) == 0 {
+		for _, i := range d.Interfaces {
+			fmt.Fprintf(&buf, "%s", i.ToString(prefix+indent))
+		}
+	}
+	if d.Storage != nil {
+		for _, m := range d.Storage.Media {
+			fmt.Fprintf(&buf, "%s", m.ToString(prefix+indent+indent))
+		}
+	}
+	for _, c := range d.Devices {
+		fmt.Fprintf(&buf, "%s", c.ToString(prefix+indent+indent))
+	}
+	return buf.String()
+}
+
+func (d USBDevice) String() string {
+	return d.ToString("")
+}
+
+// ConfigInfo is a USB configuration with its interfaces.
+type ConfigInfo struct {
+	Value      uint8
+	Name       string
+	Attributes uint8
+	MaxPower   int // mA
+	Interfaces []*InterfaceInfo
+}
+
+func (c ConfigInfo) ToString(prefix string) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%sConfiguration %d", prefix, c.Value)
+	if c.Name != "" {
+		fmt.Fprintf(&buf, " %q", c.Name)
+	}
+	fmt.Fprintf(&buf, ": attributes %#02x, max power %d mA\n", c.Attributes, c.MaxPower)
+	for _, i := range c.Interfaces {
+		fmt.Fprintf(&buf, "%s", i.ToString(prefix+indent))
+	}
+	return buf.String()
+}
+
+func (c ConfigInfo) String() string {
+	return c.ToString("")
+}
+
+// EndpointInfo is a USB endpoint of an interface.
+type EndpointInfo struct {
+	Address       uint8
+	Attributes    uint8
+	MaxPacketSize uint16
+	Interval      uint8
+}
+
+// Direction returns "IN" or "OUT".
+func (e EndpointInfo) Direction() string {
+	if e.Address&0x80 != 0 {
+		return "IN"
+	}
+	return "OUT"
+}
+
+// TransferType returns the transfer type encoded in the attributes.
+func (e EndpointInfo) TransferType() string {
+	return [...]string{"Control", "Isochronous", "Bulk", "Interrupt"}[e.Attributes&0x03]
+}
+
+func (e EndpointInfo) ToString(prefix string) string {
+	return fmt.Sprintf("%sEndpoint %#02x: EP %d %s %s, max packet %d, interval %d\n", prefix,
+		e.Address, e.Address&0x0f, e.Direction(), e.TransferType(), e.MaxPacketSize&0x7ff, e.Interval)
+}
+
+func (e EndpointInfo) String() string {
+	return e.ToString("")
+}
+
+// FindUSBTopology builds the full device tree from a system_profiler
+// SPUSBDataType document, keeping all devices rather than just storage.
+func FindUSBTopology(data any) ([]*USBBus, error) {
+	d, ok := data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("data (%T) is not map[string]interface{} type", data)
+	}
+	dt, ok := d["SPUSBDataType"]
+	if !ok {
+		return nil, fmt.Errorf("data missing SPUSBDataType entry: %+v", data)
+	}
+	dta, ok := dt.([]any)
+	if !ok {
+		return nil, fmt.Errorf("data[SPUSBDataType] (%T) is not []interface{} type", dt)
+	}
+	buses := make([]*USBBus, 0)
+	for i, dti := range dta {
+		path := fmt.Sprintf("data[SPUSBDataType][%d]", i)
+		dtiMap, ok := dti.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s (%T) is not map[string]interface{} type", path, dti)
+		}
+		bus := &USBBus{}
+		bus.Name, _ = dtiMap["_name"].(string)
+		bus.HostController, _ = dtiMap["host_controller"].(string)
+		if it, ok := dtiMap["_items"]; ok {
+			devs, err := getUSBDevices(it, path+"[_items]", 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s[_items]: %w", path, err)
+			}
+			bus.Devices = devs
+		}
+		buses = append(buses, bus)
+	}
+	return buses, nil
+}
+
+func getUSBDevices(items any, path string, depth int) ([]*USBDevice, error) {
+	ita, ok := items.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s (%T) is not []interface{} type", path, items)
+	}
+	devs := make([]*USBDevice, 0)
+	for i, item := range ita {
+		iPath := fmt.Sprintf("%s[%d]", path, i)
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s (%T) is not map[string]interface{} type", iPath, item)
+		}
+		dev := &USBDevice{}
+		dev.Name, _ = itemMap["_name"].(string)
+		dev.Manufacturer, _ = itemMap["manufacturer"].(string)
+		dev.SerialNumber, _ = itemMap["serial_num"].(string)
+		dev.Speed, _ = itemMap["device_speed"].(string)
+		dev.DeviceVersion, _ = itemMap["bcd_device"].(string)
+		var err error
+		if s, ok := itemMap["vendor_id"].(string); ok {
+			if dev.VendorID, err = parseVendorID(s); err != nil {
+				return nil, fmt.Errorf("failed to parse %s[vendor_id] (%s): %w", iPath, s, err)
+			}
+		}
+		if s, ok := itemMap["product_id"].(string); ok {
+			val, err := strconv.ParseUint(s, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s[product_id] (%s): %w", iPath, s, err)
+			}
+			dev.ProductID = uint16(val)
+		}
+		if s, ok := itemMap["location_id"].(string); ok {
+			if dev.LocationID, dev.Address, err = parseLocationID(s); err != nil {
+				return nil, fmt.Errorf("failed to parse %s[location_id] (%s): %w", iPath, s, err)
+			}
+			dev.Port = LocationPort(dev.LocationID, depth)
+		}
+		for key, val := range map[string]*int{"bus_power": &dev.BusPower, "bus_power_used": &dev.BusPowerUsed} {
+			if s, ok := itemMap[key].(string); ok {
+				if *val, err = strconv.Atoi(s); err != nil {
+					return nil, fmt.Errorf("failed to parse %s[%s] (%s): %w", iPath, key, s, err)
+				}
+			}
+		}
+		if _, ok := itemMap["Media"]; ok {
+			if dev.Storage, err = GetUSBInfo(itemMap, iPath); err != nil {
+				return nil, err
+			}
+		}
+		if it, ok := itemMap["_items"]; ok {
+			if dev.Devices, err = getUSBDevices(it, iPath+"[_items]", depth+1); err != nil {
+				return nil, fmt.Errorf("failed to parse %s[_items]: %w", iPath, err)
+			}
+		}
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
+
+// LocationPort returns the port number at the given hub depth (0 for a port
+// of the root hub) of a location ID, which holds the bus in its top byte and
+// one nibble per port below it.
+func LocationPort(loc uint32, depth int) int {
+	if depth < 0 || depth > 5 {
+		return 0
+	}
+	return int(loc>>(20-4*uint(depth))) & 0x0f
+}
+
+// LocationPorts returns the port path of a location ID, e.g. [1 4] for
+// port 4 of the hub on root port 1.
+func LocationPorts(loc uint32) []int {
+	ports := make([]int, 0)
+	for depth := 0; depth < 6; depth++ {
+		p := LocationPort(loc, depth)
+		if p == 0 {
+			break
+		}
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+// WalkUSBDevices calls fn for every device of the buses, depth first; fn
+// returning false skips the device's subtree.
+func WalkUSBDevices(buses []*USBBus, fn func(bus *USBBus, dev *USBDevice, depth int) bool) {
+	var walk func(bus *USBBus, devs []*USBDevice, depth int)
+	walk = func(bus *USBBus, devs []*USBDevice, depth int) {
+		for _, d := range devs {
+			if fn(bus, d, depth) {
+				walk(bus, d.Devices, depth+1)
+			}
+		}
+	}
+	for _, b := range buses {
+		walk(b, b.Devices, 0)
+	}
+}
+
+// AttachStorage links storage infos found by any backend to the topology
+// devices with the same location ID, or else the same vendor, product and
+// serial number, on a bus from the same source. It returns the storage
+// infos that found no device.
+func AttachStorage(buses []*USBBus, uis []*USBInfo) []*USBInfo {
+	unmatched := make([]*USBInfo, 0)
+	for _, ui := range uis {
+		var match *USBDevice
+		WalkUSBDevices(buses, func(bus *USBBus, d *USBDevice, _ int) bool {
+			if match != nil {
+				return false
+			}
+			if bus.Source != ui.Source {
+				return true // same location in another snapshot
+			}
+			switch {
+			case ui.LocationID != 0 && d.LocationID == ui.LocationID:
+				match = d
+			case ui.LocationID == 0 && ui.SerialNumber != "" && d.SerialNumber == ui.SerialNumber &&
+				d.VendorID == ui.VendorID && d.ProductID == ui.ProductID:
+				match = d
+			}
+			return true
+		})
+		if match == nil {
+			unmatched = append(unmatched, ui)
+			continue
+		}
+		match.Storage = ui
+	}
+	return unmatched
+}
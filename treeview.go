@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// treeStyle is what the lines of a tree are drawn with.
+type treeStyle struct {
+	branch string // a child with more siblings after it
+	last   string // the last child
+	pipe   string // continues the line of a parent with more children
+	space  string
+}
+
+var (
+	unicodeTree = treeStyle{branch: "├── ", last: "└── ", pipe: "│   ", space: "    "}
+	asciiTree   = treeStyle{branch: "|-- ", last: "`-- ", pipe: "|   ", space: "    "}
+)
+
+// treeOptions control writeTree.
+type treeOptions struct {
+	ASCII bool // draw with ASCII rather than box-drawing characters
+	Color bool // highlight storage devices with ANSI escapes
+}
+
+// treeNode is a line of the tree and the lines below it.
+type treeNode struct {
+	text     string
+	storage  bool
+	children []*treeNode
+}
+
+// writeTree draws the buses, their hubs and devices, and the media and
+// volumes of storage devices as a tree.
+func writeTree(w io.Writer, buses []*USBBus, opts treeOptions) error {
+	style := unicodeTree
+	if opts.ASCII {
+		style = asciiTree
+	}
+	var buf strings.Builder
+	for i, b := range buses {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		root := busNode(b)
+		buf.WriteString(root.text + "\n")
+		writeTreeChildren(&buf, root.children, "", style, opts)
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func writeTreeChildren(buf *strings.Builder, nodes []*treeNode, prefix string, style treeStyle, opts treeOptions) {
+	for i, n := range nodes {
+		branch, more := style.branch, style.pipe
+		if i == len(nodes)-1 {
+			branch, more = style.last, style.space
+		}
+		text := n.text
+		if n.storage && opts.Color {
+			text = "\x1b[1;36m" + text + "\x1b[0m"
+		}
+		buf.WriteString(prefix + branch + text + "\n")
+		writeTreeChildren(buf, n.children, prefix+more, style, opts)
+	}
+}
+
+func busNode(b *USBBus) *treeNode {
+	parts := []string{b.Name}
+	if b.HostController != "" {
+		parts[0] += " (" + b.HostController + ")"
+	}
+	if b.Speed != "" {
+		parts = append(parts, b.Speed)
+	}
+	if b.Source != "" {
+		parts = append(parts, "["+b.Source+"]")
+	}
+	n := &treeNode{text: strings.Join(parts, "  ")}
+	for _, d := range b.Devices {
+		n.children = append(n.children, deviceNode(d))
+	}
+	return n
+}
+
+func deviceNode(d *USBDevice) *treeNode {
+	parts := []string{orDash(d.Name), fmt.Sprintf("%04x:%04x", d.VendorID, d.ProductID)}
+	if d.IsHub() {
+		parts = append(parts, "hub")
+	}
+	if d.Speed != "" {
+		parts = append(parts, d.Speed)
+	}
+	if d.BusPower != 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d mA", d.BusPowerUsed, d.BusPower))
+	}
+	n := &treeNode{}
+	if d.Storage != nil {
+		n.storage = true
+		parts = append(parts, "[storage]")
+		for _, mi := range d.Storage.Media {
+			n.children = append(n.children, mediaNode(mi))
+		}
+	}
+	n.text = strings.Join(parts, "  ")
+	for _, c := range d.Devices {
+		n.children = append(n.children, deviceNode(c))
+	}
+	return n
+}
+
+func mediaNode(mi *MediaInfo) *treeNode {
+	parts := []string{mi.DevName, humanSize(mi.Size)}
+	if mi.PartitionName != "" {
+		parts = append(parts, mi.PartitionName)
+	}
+	if mi.Boot != nil && mi.Boot.Bootable() {
+		parts = append(parts, "bootable")
+	}
+	n := &treeNode{text: strings.Join(parts, "  ")}
+	for _, vi := range mi.Volumes {
+		n.children = append(n.children, &treeNode{text: volumeLine(vi)})
+	}
+	return n
+}
+
+func volumeLine(vi *VolumeInfo) string {
+	parts := []string{vi.DevName}
+	if vi.Name != "" {
+		parts = append(parts, fmt.Sprintf("%q", vi.Name))
+	}
+	parts = append(parts, humanSize(vi.Size))
+	if vi.FileSystem != "" {
+		parts = append(parts, vi.FileSystem)
+	}
+	if vi.Mounted {
+		m := "mounted at " + vi.MountPoint + ", " + humanSize(vi.Free) + " free"
+		if !vi.Writable {
+			m += ", read-only"
+		}
+		parts = append(parts, m)
+	} else {
+		parts = append(parts, "not mounted")
+	}
+	return strings.Join(parts, "  ")
+}
+
+// unicodeLocale tells whether the locale's character set is UTF-8, by the
+// environment variables the C library consults, in order.
+func unicodeLocale() bool {
+	for _, v := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if l := os.Getenv(v); l != "" {
+			l = strings.ToLower(l)
+			return strings.Contains(l, "utf-8") || strings.Contains(l, "utf8")
+		}
+	}
+	return false
+}
+
+// isTerminal tells whether w is a character device, such as a terminal,
+// and not a file or pipe.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testTopology is a bus with a hub, a stick and a keyboard behind it, and
+// an empty bus; names carry characters the output formats must escape.
+func testTopology() []*USBBus {
+	stick := &USBInfo{
+		Name: `PenDrive "Pro"`, VendorID: 0x1f75, ProductID: 0x0917, SerialNumber: "000000000000004010",
+		Media: []*MediaInfo{{
+			DevName: "disk5", Size: 63909113344, PartitionName: "guid_partition_map_type",
+			Volumes: []*VolumeInfo{
+				{DevName: "disk5s1", Name: "EFI", Size: 209715200, FileSystem: "MS-DOS FAT32"},
+				{DevName: "disk5s2", Name: "DATA", Size: 63563087872, FileSystem: "ExFAT",
+					Mounted: true, MountPoint: "/Volumes/DATA", Free: 41234567168},
+			},
+		}},
+	}
+	return []*USBBus{
+		{Name: "USB30Bus", HostController: "AppleUSBXHCI", Speed: "super_speed", Devices: []*USBDevice{{
+			Name: "USB3.1 Hub", VendorID: 0x043e, ProductID: 0x9a44, LocationID: 0x01100000, Class: 0x09,
+			Speed: "super_speed", BusPower: 900,
+			Devices: []*USBDevice{
+				{Name: `PenDrive "Pro"`, VendorID: 0x1f75, ProductID: 0x0917, LocationID: 0x01110000,
+					Speed: "high_speed", BusPower: 500, BusPowerUsed: 200, Storage: stick},
+				{Name: "Keyboard | K120 <wired>", VendorID: 0x046d, ProductID: 0xc31c, LocationID: 0x01120000,
+					Speed: "full_speed", BusPower: 500, BusPowerUsed: 90},
+			},
+		}}},
+		{Name: "Bus 001", HostController: "xhci_hcd", Source: "host2"},
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts treeOptions
+		want string
+	}{
+		{"unicode", treeOptions{}, `USB30Bus (AppleUSBXHCI)  super_speed
+└── USB3.1 Hub  043e:9a44  hub  super_speed  0/900 mA
+    ├── PenDrive "Pro"  1f75:0917  high_speed  200/500 mA  [storage]
+    │   └── disk5  63.9 GB  guid_partition_map_type
+    │       ├── disk5s1  "EFI"  209.7 MB  MS-DOS FAT32  not mounted
+    │       └── disk5s2  "DATA"  63.6 GB  ExFAT  mounted at /Volumes/DATA, 41.2 GB free, read-only
+    └── Keyboard | K120 <wired>  046d:c31c  full_speed  90/500 mA
+
+Bus 001 (xhci_hcd)  [host2]
+`},
+		{"ascii", treeOptions{ASCII: true}, `USB30Bus (AppleUSBXHCI)  super_speed
+` + "`" + `-- USB3.1 Hub  043e:9a44  hub  super_speed  0/900 mA
+    |-- PenDrive "Pro"  1f75:0917  high_speed  200/500 mA  [storage]
+    |   ` + "`" + `-- disk5  63.9 GB  guid_partition_map_type
+    |       |-- disk5s1  "EFI"  209.7 MB  MS-DOS FAT32  not mounted
+    |       ` + "`" + `-- disk5s2  "DATA"  63.6 GB  ExFAT  mounted at /Volumes/DATA, 41.2 GB free, read-only
+    ` + "`" + `-- Keyboard | K120 <wired>  046d:c31c  full_speed  90/500 mA
+
+Bus 001 (xhci_hcd)  [host2]
+`},
+		{"color", treeOptions{ASCII: true, Color: true}, `USB30Bus (AppleUSBXHCI)  super_speed
+` + "`" + `-- USB3.1 Hub  043e:9a44  hub  super_speed  0/900 mA
+    |-- ` + "\x1b[1;36m" + `PenDrive "Pro"  1f75:0917  high_speed  200/500 mA  [storage]` + "\x1b[0m" + `
+    |   ` + "`" + `-- disk5  63.9 GB  guid_partition_map_type
+    |       |-- disk5s1  "EFI"  209.7 MB  MS-DOS FAT32  not mounted
+    |       ` + "`" + `-- disk5s2  "DATA"  63.6 GB  ExFAT  mounted at /Volumes/DATA, 41.2 GB free, read-only
+    ` + "`" + `-- Keyboard | K120 <wired>  046d:c31c  full_speed  90/500 mA
+
+Bus 001 (xhci_hcd)  [host2]
+`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeTree(&buf, testTopology(), tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// udevadm info --export-db
+
+// UdevDevice is one record of the udev database.
+type UdevDevice struct {
+	Path       string            // P: sysfs path below /sys
+	Name       string            // N: device node name below /dev
+	Links      []string          // S: symlinks below /dev
+	Properties map[string]string // E: properties
+}
+
+// DevName returns the kernel name of the device node, e.g. "sdb1".
+func (d UdevDevice) DevName() string {
+	if name := strings.TrimPrefix(d.Properties["DEVNAME"], "/dev/"); name != "" {
+		return name
+	}
+	return d.Name
+}
+
+// ParseUdevDB parses a `udevadm info --export-db` dump. Records are separated
+// by blank lines and each line is a one letter type, a colon and a value.
+func ParseUdevDB(r io.Reader) ([]*UdevDevice, error) {
+	devs := make([]*UdevDevice, 0)
+	var cur *UdevDevice
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			cur = nil
+			continue
+		}
+		typ, val, ok := strings.Cut(line, ":")
+		if !ok || len(typ) != 1 {
+			return nil, fmt.Errorf("udev database line %d is malformed: %q", n, line)
+		}
+		val = strings.TrimPrefix(val, " ")
+		if cur == nil {
+			cur = &UdevDevice{Properties: make(map[string]string)}
+			devs = append(devs, cur)
+		}
+		switch typ {
+		case "P":
+			cur.Path = val
+		case "N":
+			cur.Name = val
+		case "S":
+			cur.Links = append(cur.Links, val)
+		case "E":
+			k, v, ok := strings.Cut(val, "=")
+			if !ok {
+				return nil, fmt.Errorf("udev database line %d has a malformed property: %q", n, line)
+			}
+			cur.Properties[k] = v
+		default:
+			// L: link priority, M: name, R: and friends carry nothing we use
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read udev database: %w", err)
+	}
+	return devs, nil
+}
+
+// unescapeUdev decodes the \xNN escapes of the *_ENC properties.
+func unescapeUdev(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				buf.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// UdevEnricher fills in and cross-checks the Linux backends' results with
+// the udev database.
+type UdevEnricher struct {
+	// DBPath reads a captured dump instead of running udevadm.
+	DBPath string
+	Runner CommandRunner // nil means ExecRunner
+}
+
+// Enrich loads the udev database and merges it into uis.
+func (e UdevEnricher) Enrich(ctx context.Context, uis []*USBInfo) error {
+	var r io.Reader
+	if e.DBPath != "" {
+		f, err := os.Open(e.DBPath)
+		if err != nil {
+			return fmt.Errorf("failed to open udev database: %w", err)
+		}
+		defer f.Close()
+		r = f
+	} else {
+		runner := e.Runner
+		if runner == nil {
+			runner = ExecRunner{}
+		}
+		out, err := runner.Run(ctx, "udevadm", "info", "--export-db")
+		if err != nil {
+			return fmt.Errorf("failed to run udevadm: %w", err)
+		}
+		r = bytes.NewReader(out)
+	}
+	devs, err := ParseUdevDB(r)
+	if err != nil {
+		return err
+	}
+	MergeUdev(uis, devs)
+	return nil
+}
+
+// MergeUdev fills empty fields of uis from the udev properties of their block
+// devices, matched by device name. Values that are present on both sides but
+// disagree are kept and reported in USBInfo.Warnings.
+func MergeUdev(uis []*USBInfo, devs []*UdevDevice) {
+	byName := make(map[string]*UdevDevice, len(devs))
+	for _, d := range devs {
+		if d.Properties["SUBSYSTEM"] == "block" {
+			byName[d.DevName()] = d
+		}
+	}
+	for _, ui := range uis {
+		check := func(what string, field *string, val string) {
+			val = strings.TrimSpace(val)
+			switch {
+			case val == "":
+			case *field == "":
+				*field = val
+			case *field != val:
+				ui.Warnings = append(ui.Warnings,
+					fmt.Sprintf("%s mismatch: %q vs. %q from udev", what, *field, val))
+			}
+		}
+		checkID := func(what string, field *uint16, val string) {
+			if val == "" {
+				return
+			}
+			id, err := strconv.ParseUint(val, 16, 16)
+			if err != nil {
+				ui.Warnings = append(ui.Warnings, fmt.Sprintf("invalid %s %q from udev", what, val))
+				return
+			}
+			switch {
+			case *field == 0:
+				*field = uint16(id)
+			case *field != uint16(id):
+				ui.Warnings = append(ui.Warnings,
+					fmt.Sprintf("%s mismatch: %#04x vs. %#04x from udev", what, *field, id))
+			}
+		}
+		for _, mi := range ui.Media {
+			d, ok := byName[mi.DevName]
+			if !ok {
+				continue
+			}
+			p := d.Properties
+			if bus := p["ID_BUS"]; bus != "" && bus != "usb" {
+				ui.Warnings = append(ui.Warnings, fmt.Sprintf("udev reports %s on bus %q", mi.DevName, bus))
+			}
+			check("serial number", &ui.SerialNumber, p["ID_SERIAL_SHORT"])
+			// ID_VENDOR_ENC is the SCSI inquiry vendor, which rarely
+			// matches the USB manufacturer string
+			check("manufacturer", &ui.Manufacturer, unescapeUdev(p["ID_USB_VENDOR_ENC"]))
+			checkID("vendor ID", &ui.VendorID, p["ID_VENDOR_ID"])
+			checkID("product ID", &ui.ProductID, p["ID_MODEL_ID"])
+			check("driver", &ui.Driver, p["ID_USB_DRIVER"])
+			if pt := p["ID_PART_TABLE_TYPE"]; pt != "" {
+				name := partitionMapName(pt)
+				if mi.PartitionName == "" || mi.PartitionName == "unknown_partition_map_type" {
+					mi.PartitionName = name
+				} else if mi.PartitionName != name {
+					ui.Warnings = append(ui.Warnings, fmt.Sprintf("%s partition map mismatch: %q vs. %q from udev",
+						mi.DevName, mi.PartitionName, name))
+				}
+			}
+			if len(mi.Links) == 0 {
+				mi.Links = d.Links
+			}
+			for _, vi := range mi.Volumes {
+				vd, ok := byName[vi.DevName]
+				if !ok {
+					continue
+				}
+				vp := vd.Properties
+				label := unescapeUdev(vp["ID_FS_LABEL_ENC"])
+				if label == "" {
+					label = vp["ID_FS_LABEL"]
+				}
+				check(vi.DevName+" label", &vi.Name, label)
+				check(vi.DevName+" file system", &vi.FileSystem, fileSystemName(vp["ID_FS_TYPE"], vp["ID_FS_VERSION"]))
+				check(vi.DevName+" UUID", &vi.UUID, vp["ID_FS_UUID"])
+				if vp["MAJOR"] != "" {
+					check(vi.DevName+" device number", &vi.DevNum, vp["MAJOR"]+":"+vp["MINOR"])
+				}
+			}
+		}
+	}
+}
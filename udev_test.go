@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testUdevDB is an excerpt of `udevadm info --export-db` on systemd 252
+// with a SanDisk stick: its USB device, the disk and one partition.
+const testUdevDB = `P: /devices/pci0000:00/0000:00:14.0/usb2/2-1
+N: bus/usb/002/003
+L: 0
+E: DEVPATH=/devices/pci0000:00/0000:00:14.0/usb2/2-1
+E: SUBSYSTEM=usb
+E: DEVNAME=/dev/bus/usb/002/003
+E: DEVTYPE=usb_device
+E: ID_VENDOR_ID=0781
+E: ID_MODEL_ID=5581
+
+P: /devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host6/target6:0:0/6:0:0:0/block/sdb
+N: sdb
+L: 0
+S: disk/by-id/usb-SanDisk_Ultra_4C530001230512105341-0:0
+S: disk/by-path/pci-0000:00:14.0-usb-0:1:1.0-scsi-0:0:0:0
+E: DEVPATH=/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host6/target6:0:0/6:0:0:0/block/sdb
+E: SUBSYSTEM=block
+E: DEVNAME=/dev/sdb
+E: DEVTYPE=disk
+E: MAJOR=8
+E: MINOR=16
+E: ID_VENDOR=SanDisk_
+E: ID_VENDOR_ENC=SanDisk\x20
+E: ID_MODEL=Ultra
+E: ID_MODEL_ENC=Ultra\x20\x20\x20\x20\x20\x20\x20\x20\x20\x20\x20
+E: ID_USB_VENDOR=SanDisk_Corp.
+E: ID_USB_VENDOR_ENC=SanDisk\x20Corp.
+E: ID_USB_VENDOR_ID=0781
+E: ID_VENDOR_ID=0781
+E: ID_MODEL_ID=5581
+E: ID_SERIAL=SanDisk_Ultra_4C530001230512105341-0:0
+E: ID_SERIAL_SHORT=4C530001230512105341
+E: ID_USB_DRIVER=usb-storage
+E: ID_BUS=usb
+E: ID_PART_TABLE_UUID=5b3c9e2a-1d47-4f0b-9a61-3e2d8c7b6a50
+E: ID_PART_TABLE_TYPE=gpt
+
+P: /devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host6/target6:0:0/6:0:0:0/block/sdb/sdb1
+N: sdb1
+L: 0
+S: disk/by-uuid/67E3-17ED
+S: disk/by-label/My\x20Stick
+E: DEVPATH=/devices/pci0000:00/0000:00:14.0/usb2/2-1/2-1:1.0/host6/target6:0:0/6:0:0:0/block/sdb/sdb1
+E: SUBSYSTEM=block
+E: DEVNAME=/dev/sdb1
+E: DEVTYPE=partition
+E: MAJOR=8
+E: MINOR=17
+E: ID_FS_LABEL=My_Stick
+E: ID_FS_LABEL_ENC=My\x20Stick
+E: ID_FS_UUID=67E3-17ED
+E: ID_FS_TYPE=vfat
+E: ID_FS_VERSION=FAT32
+E: ID_BUS=usb
+`
+
+func TestParseUdevDB(t *testing.T) {
+	devs, err := ParseUdevDB(strings.NewReader(testUdevDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 3 {
+		t.Fatalf("got %d records, want 3", len(devs))
+	}
+	if got := []string{devs[0].DevName(), devs[1].DevName(), devs[2].DevName()}; !reflect.DeepEqual(got, []string{"bus/usb/002/003", "sdb", "sdb1"}) {
+		t.Errorf("device names are %q", got)
+	}
+	sdb := devs[1]
+	if !strings.HasSuffix(sdb.Path, "/block/sdb") || sdb.Name != "sdb" || len(sdb.Links) != 2 {
+		t.Errorf("sdb is %+v", *sdb)
+	}
+	if sdb.Properties["ID_SERIAL"] != "SanDisk_Ultra_4C530001230512105341-0:0" {
+		t.Errorf("ID_SERIAL is %q, values with colons must survive", sdb.Properties["ID_SERIAL"])
+	}
+
+	for _, in := range []string{"P /devices/x\n", "E: NOEQUALS\n", "XY: value\n"} {
+		if _, err := ParseUdevDB(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseUdevDB(%q) returned no error", in)
+		}
+	}
+}
+
+func TestUnescapeUdev(t *testing.T) {
+	for in, want := range map[string]string{
+		``:                    ``,
+		`SanDisk`:             `SanDisk`,
+		`SanDisk\x20`:         `SanDisk `,
+		`My\x20Stick\x2fData`: `My Stick/Data`,
+		`\xc3\xa9t\xc3\xa9`:   `été`,
+		`bad\xzz`:             `bad\xzz`,
+		`short\x2`:            `short\x2`,
+	} {
+		if got := unescapeUdev(in); got != want {
+			t.Errorf("unescapeUdev(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMergeUdev(t *testing.T) {
+	devs, err := ParseUdevDB(strings.NewReader(testUdevDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb1 := &VolumeInfo{DevName: "sdb1"}
+	mi := &MediaInfo{DevName: "sdb", PartitionName: "unknown_partition_map_type", Volumes: []*VolumeInfo{sdb1}}
+	// sysfs knows the USB strings, which differ from the SCSI inquiry ones
+	ui := &USBInfo{Manufacturer: "SanDisk Corp.", VendorID: 0x0781, Media: []*MediaInfo{mi}}
+	MergeUdev([]*USBInfo{ui}, devs)
+
+	if len(ui.Warnings) != 0 {
+		t.Errorf("unexpected warnings %q", ui.Warnings)
+	}
+	if ui.SerialNumber != "4C530001230512105341" || ui.ProductID != 0x5581 || ui.Driver != "usb-storage" {
+		t.Errorf("got serial %q, product ID %#04x, driver %q", ui.SerialNumber, ui.ProductID, ui.Driver)
+	}
+	if mi.PartitionName != "guid_partition_map_type" || len(mi.Links) != 2 {
+		t.Errorf("got partition map %q and links %q", mi.PartitionName, mi.Links)
+	}
+	if sdb1.Name != "My Stick" || sdb1.FileSystem != "MS-DOS FAT32" || sdb1.UUID != "67E3-17ED" || sdb1.DevNum != "8:17" {
+		t.Errorf("sdb1 is %+v", *sdb1)
+	}
+}
+
+func TestMergeUdevMismatch(t *testing.T) {
+	devs, err := ParseUdevDB(strings.NewReader(testUdevDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := &MediaInfo{DevName: "sdb", PartitionName: "master_boot_record_partition_map_type"}
+	ui := &USBInfo{SerialNumber: "OTHER", ProductID: 0x5567, Media: []*MediaInfo{mi}}
+	MergeUdev([]*USBInfo{ui}, devs)
+	// the values found first are kept
+	if ui.SerialNumber != "OTHER" || ui.ProductID != 0x5567 || mi.PartitionName != "master_boot_record_partition_map_type" {
+		t.Errorf("got serial %q, product ID %#04x, partition map %q", ui.SerialNumber, ui.ProductID, mi.PartitionName)
+	}
+	if len(ui.Warnings) != 3 {
+		t.Errorf("warnings are %q, want serial number, product ID and partition map", ui.Warnings)
+	}
+}
+
+func TestUdevEnricher(t *testing.T) {
+	runner := RunnerFunc(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "udevadm" {
+			t.Errorf("ran %s", name)
+		}
+		return []byte(testUdevDB), nil
+	})
+	ui := &USBInfo{Media: []*MediaInfo{{DevName: "sdb"}}}
+	if err := (UdevEnricher{Runner: runner}).Enrich(context.Background(), []*USBInfo{ui}); err != nil {
+		t.Fatal(err)
+	}
+	if ui.SerialNumber != "4C530001230512105341" {
+		t.Errorf("serial is %q", ui.SerialNumber)
+	}
+}
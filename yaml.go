@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// orderedMap is a JSON object that keeps the order of its keys, so that
+// the YAML and TOML renderings of a Document list fields as the JSON does.
+type orderedMap []orderedField
+
+type orderedField struct {
+	key   string
+	value any // nil, bool, json.Number, string, []any or orderedMap
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// orderedTree marshals v to JSON and decodes it back as a tree of
+// orderedMaps, []any and scalars, numbers as json.Number.
+func orderedTree(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return decodeOrdered(d)
+}
+
+func decodeOrdered(d *json.Decoder) (any, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		m := make(orderedMap, 0)
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, orderedField{key: k.(string), value: v})
+		}
+		_, err = d.Token() // }
+		return m, err
+	case json.Delim('['):
+		a := make([]any, 0)
+		for d.More() {
+			v, err := decodeOrdered(d)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err = d.Token() // ]
+		return a, err
+	}
+	return t, nil
+}
+
+// EncodeYAML writes v, anything encoding/json can marshal, as a block style
+// YAML document.
+func EncodeYAML(w io.Writer, v any) error {
+	tree, err := orderedTree(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	switch tree.(type) {
+	case orderedMap, []any:
+		writeYAMLBlock(&buf, tree, 0)
+	default:
+		buf.WriteString(yamlScalar(tree) + "\n")
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeYAMLBlock(buf *bytes.Buffer, v any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch v := v.(type) {
+	case orderedMap:
+		for _, f := range v {
+			buf.WriteString(pad + yamlString(f.key) + ":")
+			writeYAMLValue(buf, f.value, indent+2)
+		}
+	case []any:
+		for _, e := range v {
+			if m, ok := e.(orderedMap); ok && len(m) > 0 {
+				// the first key goes on the dash's line
+				var item bytes.Buffer
+				writeYAMLBlock(&item, m, indent+2)
+				buf.WriteString(pad + "- " + strings.TrimPrefix(item.String(), pad+"  "))
+				continue
+			}
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, e, indent+2)
+		}
+	}
+}
+
+// writeYAMLValue writes the value of a key or sequence item, from after the
+// colon or dash.
+func writeYAMLValue(buf *bytes.Buffer, v any, indent int) {
+	switch c := v.(type) {
+	case orderedMap:
+		if len(c) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+	case []any:
+		if len(c) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+	default:
+		buf.WriteString(" " + yamlScalar(v) + "\n")
+		return
+	}
+	buf.WriteString("\n")
+	writeYAMLBlock(buf, v, indent)
+}
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		return yamlString(v)
+	}
+	panic(fmt.Sprintf("yaml: unexpected %T", v))
+}
+
+var (
+	// yamlPlain is what is safe to leave unquoted: no indicators, no ": "
+	// or " #", nothing that YAML 1.1 or 1.2 would read as another type
+	yamlPlain    = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_ ./()+-]*$`)
+	yamlReserved = regexp.MustCompile(`^(?i:null|true|false|yes|no|on|off|y|n|\.inf|\.nan)$`)
+)
+
+// yamlString quotes a string unless it reads back the same plain. Serial
+// numbers like 000000005309 or names with colons are quoted.
+func yamlString(s string) string {
+	if yamlPlain.MatchString(s) && !yamlReserved.MatchString(s) && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	// Go's escapes are a subset of YAML's double quoted ones
+	return strconv.Quote(s)
+}
+
+// yamlLine is a line of a YAML document without its indentation.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlParser reads the block style subset of YAML that EncodeYAML writes,
+// plus comments, single quotes and flow sequences of scalars, which is
+// enough for files written or edited by hand.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// DecodeYAML parses a YAML document into maps, slices and scalars, with
+// numbers as json.Number.
+func DecodeYAML(b []byte) (any, error) {
+	p := &yamlParser{}
+	b = bytes.TrimPrefix(b, []byte("\ufeff"))
+	for i, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimRight(l, " \t\r")
+		t := strings.TrimLeft(l, " ")
+		if t == "" || t[0] == '#' || (i == 0 && t == "---") {
+			continue
+		}
+		if t == "---" || t == "..." {
+			if len(p.lines) > 0 {
+				return nil, fmt.Errorf("yaml: line %d: only one document is supported", i+1)
+			}
+			continue
+		}
+		if strings.HasPrefix(t, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed in indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(l) - len(t), text: t})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", l.num)
+	}
+	return v, nil
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	l := p.lines[p.pos]
+	if l.text == "-" || strings.HasPrefix(l.text, "- ") {
+		return p.sequence(indent)
+	}
+	if _, _, ok := yamlSplitKey(l.text); ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	return yamlParseScalar(l.text, l.num)
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	seq := make([]any, 0)
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !(l.text == "-" || strings.HasPrefix(l.text, "- ")) {
+			break
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+			continue
+		}
+		// an item on the dash's line continues as a block at its column
+		p.lines[p.pos] = yamlLine{num: l.num, indent: indent + len(l.text) - len(rest), text: rest}
+		v, err := p.block(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+	}
+	return seq, nil
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	m := make(orderedMap, 0)
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent {
+			break
+		}
+		key, rest, ok := yamlSplitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected a key", l.num)
+		}
+		for _, f := range m {
+			if f.key == key {
+				return nil, fmt.Errorf("yaml: line %d: duplicate key %q", l.num, key)
+			}
+		}
+		p.pos++
+		var v any
+		var err error
+		if rest == "" {
+			v, err = p.nested(indent)
+		} else {
+			v, err = yamlParseScalar(rest, l.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, orderedField{key: key, value: v})
+	}
+	return m, nil
+}
+
+// nested parses the block under a key or dash: more indented, or a
+// sequence at the same indentation as the key. Without one the value is null.
+func (p *yamlParser) nested(indent int) (any, error) {
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	switch {
+	case next.indent > indent:
+		return p.block(next.indent)
+	case next.indent == indent && (next.text == "-" || strings.HasPrefix(next.text, "- ")):
+		return p.sequence(indent)
+	}
+	return nil, nil
+}
+
+// yamlSplitKey splits "key: value" into its key and the rest.
+func yamlSplitKey(s string) (string, string, bool) {
+	var key string
+	rest := s
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		k, n, err := yamlQuoted(s)
+		if err != nil {
+			return "", "", false
+		}
+		key, rest = k, s[n:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+	} else {
+		i := strings.Index(s, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(s, ":") {
+				return "", "", false
+			}
+			i = len(s) - 1
+		}
+		key, rest = s[:i], s[i:]
+		if strings.ContainsAny(key[:1], "[{#&*!|>%@`") || strings.Contains(key, " #") {
+			return "", "", false
+		}
+	}
+	rest = strings.TrimPrefix(rest, ":")
+	if rest != "" && rest[0] != ' ' {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return key, rest, true
+}
+
+// yamlQuoted reads the quoted string at the start of s, returning it and
+// the bytes it took.
+func yamlQuoted(s string) (string, int, error) {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case q == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == q:
+			if q == '\'' {
+				return strings.ReplaceAll(s[1:i], "''", "'"), i + 1, nil
+			}
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("unsupported escape in %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?([0-9]+\.[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+)
+
+// yamlParseScalar parses a scalar or a flow collection of scalars.
+func yamlParseScalar(s string, num int) (any, error) {
+	switch {
+	case s[0] == '"' || s[0] == '\'':
+		v, n, err := yamlQuoted(s)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %v", num, err)
+		}
+		if rest := strings.TrimSpace(s[n:]); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("yaml: line %d: unexpected %q after string", num, rest)
+		}
+		return v, nil
+	case s[0] == '[':
+		return yamlFlowSequence(s, num)
+	case s == "{}":
+		return orderedMap{}, nil
+	case strings.ContainsAny(s[:1], "{&*!|>%@`"):
+		return nil, fmt.Errorf("yaml: line %d: unsupported syntax %q", num, s)
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	switch {
+	case s == "~" || s == "null" || s == "Null" || s == "NULL":
+		return nil, nil
+	case s == "true" || s == "True" || s == "TRUE":
+		return true, nil
+	case s == "false" || s == "False" || s == "FALSE":
+		return false, nil
+	case yamlInt.MatchString(s) || yamlFloat.MatchString(s):
+		return json.Number(strings.TrimPrefix(s, "+")), nil
+	}
+	return s, nil
+}
+
+// yamlFlowSequence parses [a, "b", 3] of scalars.
+func yamlFlowSequence(s string, num int) (any, error) {
+	end := strings.LastIndex(s, "]")
+	if end < 0 {
+		return nil, fmt.Errorf("yaml: line %d: unterminated sequence", num)
+	}
+	if rest := strings.TrimSpace(s[end+1:]); rest != "" && rest[0] != '#' {
+		return nil, fmt.Errorf("yaml: line %d: unexpected %q after sequence", num, rest)
+	}
+	seq := make([]any, 0)
+	in := strings.TrimSpace(s[1:end])
+	for in != "" {
+		var item string
+		if in[0] == '"' || in[0] == '\'' {
+			_, n, err := yamlQuoted(in)
+			if err != nil {
+				return nil, fmt.Errorf("yaml: line %d: %v", num, err)
+			}
+			item, in = in[:n], strings.TrimSpace(in[n:])
+		} else {
+			i := strings.IndexByte(in, ',')
+			if i < 0 {
+				i = len(in)
+			}
+			item, in = strings.TrimSpace(in[:i]), in[i:]
+		}
+		if strings.ContainsAny(item[:1], "[{") {
+			return nil, fmt.Errorf("yaml: line %d: nested flow collections are not supported", num)
+		}
+		v, err := yamlParseScalar(item, num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, v)
+		if in != "" {
+			if in[0] != ',' {
+				return nil, fmt.Errorf("yaml: line %d: expected , in sequence", num)
+			}
+			in = strings.TrimSpace(in[1:])
+		}
+	}
+	return seq, nil
+}